@@ -0,0 +1,84 @@
+package main
+
+/*
+	Copyright (C) 2015  Wolfgang Meyers
+
+    This program is free software; you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation; either version 2 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License along
+    with this program; if not, write to the Free Software Foundation, Inc.,
+    51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+*/
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/wolfgangmeyers/go-warc/warc"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Converts an ARC file to a WARC file, and verifies the result
+// by reading both files again.
+func runArc2Warc(args []string, stdout io.Writer) error {
+	flags := flag.NewFlagSet("arc2warc", flag.ContinueOnError)
+	version := flags.String("version", "1.0", "WARC version to write, 1.0 or 1.1")
+	verify := flags.Bool("verify", true, "verify the WARC file after conversion")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 2 {
+		return errors.New("expected an input and an output file")
+	}
+	input, output := flags.Arg(0), flags.Arg(1)
+	in, err := os.Open(input)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(output)
+	if err != nil {
+		return err
+	}
+	result, err := warc.ConvertARC(in, out, warc.ARCConversionOptions{
+		Version:  *version,
+		Compress: strings.HasSuffix(output, ".gz"),
+		Filename: filepath.Base(output),
+	})
+	if err != nil {
+		out.Close()
+		os.Remove(output)
+		return err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(output)
+		return err
+	}
+	fmt.Fprintf(stdout, "%v: converted %v records (%v)\n", output, result.Records, result.SourceDigest)
+	if !*verify {
+		return nil
+	}
+	if _, err := in.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	converted, err := os.Open(output)
+	if err != nil {
+		return err
+	}
+	defer converted.Close()
+	if err := warc.VerifyARCConversion(in, converted); err != nil {
+		return errors.New(fmt.Sprintf("verification of %v failed: %v", output, err))
+	}
+	fmt.Fprintf(stdout, "%v: verified\n", output)
+	return nil
+}
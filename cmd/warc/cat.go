@@ -0,0 +1,79 @@
+package main
+
+/*
+	Copyright (C) 2015  Wolfgang Meyers
+
+    This program is free software; you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation; either version 2 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License along
+    with this program; if not, write to the Free Software Foundation, Inc.,
+    51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+*/
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/wolfgangmeyers/go-warc/warc"
+	"io"
+	"os"
+)
+
+var errFound error = errors.New("found")
+
+// Writes a record, found by offset or record id, to stdout.
+func runCat(args []string, stdout io.Writer) error {
+	flags := flag.NewFlagSet("cat", flag.ContinueOnError)
+	offset := flags.Int64("offset", -1, "offset of the record, as listed by warc ls")
+	id := flags.String("id", "", "WARC-Record-ID of the record")
+	payload := flags.Bool("payload", false, "write only the block of the record")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return errors.New("expected a WARC file")
+	}
+	if (*offset < 0) == (*id == "") {
+		return errors.New("expected either -offset or -id")
+	}
+	filename := flags.Arg(0)
+	var record *warc.WARCRecord
+	if *offset >= 0 {
+		f, err := os.Open(filename)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		record, err = warc.ReadRecordAt(f, *offset)
+		if err != nil {
+			return errors.New(fmt.Sprintf("no record at offset %v: %v", *offset, err))
+		}
+	} else {
+		err := eachRecord(filename, func(r *warc.WARCRecord) error {
+			if r.GetHeader().GetRecordId() == *id {
+				record = r
+				return errFound
+			}
+			return nil
+		})
+		if err != nil && err != errFound {
+			return err
+		}
+		if record == nil {
+			return errors.New(fmt.Sprintf("no record with id %v", *id))
+		}
+	}
+	if *payload {
+		_, err := stdout.Write(record.GetPayload().GetData())
+		return err
+	}
+	_, err := record.WriteTo(stdout)
+	return err
+}
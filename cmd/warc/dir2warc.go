@@ -0,0 +1,67 @@
+package main
+
+/*
+	Copyright (C) 2015  Wolfgang Meyers
+
+    This program is free software; you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation; either version 2 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License along
+    with this program; if not, write to the Free Software Foundation, Inc.,
+    51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+*/
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/wolfgangmeyers/go-warc/warc"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Writes the files of a directory tree as resource records.
+func runDir2Warc(args []string, stdout io.Writer) error {
+	flags := flag.NewFlagSet("dir2warc", flag.ContinueOnError)
+	baseURL := flags.String("base-url", "", "URL the file paths are resolved against; by default the file:// URL of the directory")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 2 {
+		return errors.New("expected a directory and an output file")
+	}
+	dir, output := flags.Arg(0), flags.Arg(1)
+	out, err := os.Create(output)
+	if err != nil {
+		return err
+	}
+	writer, err := newWriterFor(out, output)
+	if err != nil {
+		out.Close()
+		return err
+	}
+	result, err := warc.PackageDirectory(dir, writer, warc.PackageOptions{
+		BaseURL:  *baseURL,
+		Filename: filepath.Base(output),
+		Exclude:  []string{output},
+	})
+	if err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	fmt.Fprintf(stdout, "%v: wrote %v files (%v bytes)\n", output, result.Files, result.Bytes)
+	if result.Skipped > 0 {
+		fmt.Fprintf(stdout, "%v: skipped %v entries that are not regular files\n", output, result.Skipped)
+	}
+	return nil
+}
@@ -0,0 +1,180 @@
+package main
+
+/*
+	Copyright (C) 2015  Wolfgang Meyers
+
+    This program is free software; you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation; either version 2 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License along
+    with this program; if not, write to the Free Software Foundation, Inc.,
+    51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+*/
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/wolfgangmeyers/go-warc/warc"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var RE_UNSAFE *regexp.Regexp = regexp.MustCompile("[^A-Za-z0-9._-]+")
+
+// Creates a relative file name for the payload of a record from its URL:
+// the host followed by the path, with index.html for directories and a
+// hash of the query string, if any. Unsafe characters are replaced.
+// Returns an empty string for URLs that do not give a file name.
+func payloadFilename(uri string) string {
+	name := RE_UNSAFE.ReplaceAllString(uri, "_")
+	if u, err := url.Parse(uri); err == nil && u.Host != "" {
+		parts := []string{RE_UNSAFE.ReplaceAllString(u.Host, "_")}
+		for _, segment := range strings.Split(u.Path, "/") {
+			segment = RE_UNSAFE.ReplaceAllString(segment, "_")
+			if segment != "" && segment != "." && segment != ".." {
+				parts = append(parts, segment)
+			}
+		}
+		if u.Path == "" || strings.HasSuffix(u.Path, "/") {
+			parts = append(parts, "index.html")
+		}
+		name = filepath.Join(parts...)
+		if u.RawQuery != "" {
+			hash := sha1.Sum([]byte(u.RawQuery))
+			name += "_" + hex.EncodeToString(hash[:4])
+		}
+	}
+	if name == "." || !filepath.IsLocal(name) {
+		return ""
+	}
+	return name
+}
+
+// Creates the directory holding the payload file name below dir, and
+// returns the path of the file. A payload that was written where a
+// directory is needed is moved into it as index.html, and if name itself
+// is a directory, the path of its index.html is returned. written holds
+// the paths of the payloads written so far; other files are never moved.
+func makePayloadDir(dir string, name string, written map[string]bool) (string, error) {
+	parts := strings.Split(name, string(filepath.Separator))
+	for i := 1; i < len(parts); i++ {
+		parent := filepath.Join(dir, filepath.Join(parts[:i]...))
+		info, err := os.Stat(parent)
+		if err != nil || info.IsDir() {
+			continue
+		}
+		if !written[parent] {
+			return "", errors.New(fmt.Sprintf("%v is needed as a directory, but is a file", parent))
+		}
+		// the payload is moved aside without replacing anything
+		moved := parent + ".moved"
+		for i := 2; ; i++ {
+			if _, err := os.Lstat(moved); os.IsNotExist(err) {
+				break
+			}
+			moved = parent + ".moved." + strconv.Itoa(i)
+		}
+		if err := os.Rename(parent, moved); err != nil {
+			return "", err
+		}
+		if err := os.Mkdir(parent, 0755); err != nil {
+			return "", err
+		}
+		index := filepath.Join(parent, "index.html")
+		if err := os.Rename(moved, index); err != nil {
+			return "", err
+		}
+		delete(written, parent)
+		written[index] = true
+	}
+	path := filepath.Join(dir, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", err
+	}
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		path = filepath.Join(path, "index.html")
+	}
+	return path, nil
+}
+
+// The payload of a record: the HTTP body of responses with any transfer
+// and content encoding removed, or the whole block. The body is returned
+// as stored if it cannot be decoded.
+func recordPayload(record *warc.WARCRecord) []byte {
+	data := record.GetPayload().GetData()
+	contentType, _ := record.Get("Content-Type")
+	if strings.HasPrefix(contentType, "application/http") {
+		if message, err := warc.ParseHTTPMessage(data); err == nil {
+			if body, err := message.DecodedBody(); err == nil {
+				return body
+			}
+			return message.Body
+		}
+	}
+	return data
+}
+
+// Writes the payloads of the response and resource records of a WARC
+// file to a directory, in files named after their URLs. Records whose
+// URLs do not give a file name are skipped.
+func runExtract(args []string, stdout io.Writer) error {
+	flags := flag.NewFlagSet("extract", flag.ContinueOnError)
+	dir := flags.String("dir", ".", "directory to write the payloads to")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() == 0 {
+		return errors.New("expected at least one WARC file")
+	}
+	written := map[string]bool{}
+	skipped := 0
+	for _, filename := range flags.Args() {
+		err := eachRecord(filename, func(record *warc.WARCRecord) error {
+			if record.GetType() != "response" && record.GetType() != "resource" {
+				return nil
+			}
+			base := payloadFilename(record.GetUrl())
+			if base == "" {
+				skipped++
+				_, err := fmt.Fprintf(stdout, "skipped\t%v\n", record.GetUrl())
+				return err
+			}
+			path, err := makePayloadDir(*dir, base, written)
+			if err != nil {
+				return err
+			}
+			// later captures of a URL get a serial number
+			name := path
+			for i := 2; written[name]; i++ {
+				name = path + "." + strconv.Itoa(i)
+			}
+			written[name] = true
+			if err := os.WriteFile(name, recordPayload(record), 0644); err != nil {
+				return err
+			}
+			_, err = fmt.Fprintf(stdout, "%v\t%v\n", name, record.GetUrl())
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if skipped > 0 {
+		fmt.Fprintf(stdout, "skipped %v records without a usable URL\n", skipped)
+	}
+	return nil
+}
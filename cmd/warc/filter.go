@@ -0,0 +1,67 @@
+package main
+
+/*
+	Copyright (C) 2015  Wolfgang Meyers
+
+    This program is free software; you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation; either version 2 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License along
+    with this program; if not, write to the Free Software Foundation, Inc.,
+    51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+*/
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/wolfgangmeyers/go-warc/warc"
+	"io"
+	"os"
+)
+
+// Writes the records of a WARC file that match a filter expression to a new WARC file.
+func runFilter(args []string, stdout io.Writer) error {
+	flags := flag.NewFlagSet("filter", flag.ContinueOnError)
+	compression := flags.String("compression", "", "gzip, zstd or none; by default taken from the output file name")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 3 {
+		return errors.New("expected a filter expression, an input and an output file")
+	}
+	filter, err := warc.ParseFilter(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	input, output := flags.Arg(1), flags.Arg(2)
+	options := warc.RecompressOptions{Compression: *compression}
+	if options.Compression == "" {
+		options.Compression = compressionFor(output)
+	}
+	in, err := os.Open(input)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(output)
+	if err != nil {
+		return err
+	}
+	result, err := warc.FilterWARC(in, out, filter, options)
+	if err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	fmt.Fprintf(stdout, "%v: wrote %v records\n", output, result.Records)
+	return nil
+}
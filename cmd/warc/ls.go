@@ -0,0 +1,80 @@
+package main
+
+/*
+	Copyright (C) 2015  Wolfgang Meyers
+
+    This program is free software; you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation; either version 2 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License along
+    with this program; if not, write to the Free Software Foundation, Inc.,
+    51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+*/
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/wolfgangmeyers/go-warc/warc"
+	"io"
+	"os"
+)
+
+// Calls callback with each record of a WARC file, stopping at the first error.
+func eachRecord(filename string, callback func(*warc.WARCRecord) error) error {
+	f, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	wf, err := warc.NewWARCFile(f)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	defer wf.Close()
+	for record, err := range wf.Records() {
+		if err != nil {
+			return errors.New(fmt.Sprintf("%v: %v", filename, err))
+		}
+		if err := callback(record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Lists the records of WARC files, one line per record with the
+// offset, type, date, target URI and length.
+func runLs(args []string, stdout io.Writer) error {
+	flags := flag.NewFlagSet("ls", flag.ContinueOnError)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() == 0 {
+		return errors.New("expected at least one WARC file")
+	}
+	for _, filename := range flags.Args() {
+		if flags.NArg() > 1 {
+			fmt.Fprintf(stdout, "%v:\n", filename)
+		}
+		err := eachRecord(filename, func(record *warc.WARCRecord) error {
+			uri := record.GetUrl()
+			if uri == "" {
+				uri = "-"
+			}
+			_, err := fmt.Fprintf(stdout, "%v\t%v\t%v\t%v\t%v\n", record.Offset(), record.GetType(),
+				record.GetDate(), uri, record.GetHeader().GetContentLength())
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+// The warc command works with WARC files. Run it without arguments
+// for a list of subcommands.
+package main
+
+/*
+	Copyright (C) 2015  Wolfgang Meyers
+
+    This program is free software; you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation; either version 2 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License along
+    with this program; if not, write to the Free Software Foundation, Inc.,
+    51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+*/
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+)
+
+type command struct {
+	usage string
+	run   func(args []string, stdout io.Writer) error
+}
+
+var commands map[string]command = map[string]command{
+	"arc2warc":   {"arc2warc [-version 1.0|1.1] [-verify=false] input.arc[.gz] output.warc[.gz]", runArc2Warc},
+	"cat":        {"cat (-offset offset | -id record-id) [-payload] input.warc[.gz|.zst]", runCat},
+	"dir2warc":   {"dir2warc [-base-url url] directory output.warc[.gz|.zst]", runDir2Warc},
+	"extract":    {"extract [-dir directory] input.warc[.gz|.zst]...", runExtract},
+	"filter":     {"filter [-compression gzip|zstd|none] expression input.warc[.gz|.zst] output.warc[.gz|.zst]", runFilter},
+	"har2warc":   {"har2warc input.har output.warc[.gz|.zst]", runHar2Warc},
+	"ls":         {"ls input.warc[.gz|.zst]...", runLs},
+	"recompress": {"recompress [-compression gzip|zstd|none] [-dictionary file] [-verify=false] input.warc[.gz|.zst] output.warc[.gz|.zst]", runRecompress},
+	"repair":     {"repair [-compression gzip|zstd|none] [-drop-incomplete] input.warc[.gz|.zst][.open] [output.warc[.gz|.zst]]", runRepair},
+	"validate":   {"validate input.warc[.gz|.zst]...", runValidate},
+	"wat":        {"wat input.warc[.gz|.zst] output.wat[.gz|.zst]", runWat},
+	"wet":        {"wet input.warc[.gz|.zst] output.wet[.gz|.zst]", runWet},
+	"warc2har":   {"warc2har [-page url] input.warc[.gz|.zst] output.har", runWarc2Har},
+	"wacz":       {"wacz [-title title] [-description text] [-main-page url] output.wacz input.warc[.gz|.zst]...", runWacz},
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: warc <command> [arguments]")
+	fmt.Fprintln(os.Stderr, "\ncommands:")
+	names := []string{}
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintln(os.Stderr, "  warc "+commands[name].usage)
+	}
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+	cmd, exists := commands[os.Args[1]]
+	if !exists {
+		usage()
+		os.Exit(2)
+	}
+	if err := cmd.run(os.Args[2:], os.Stdout); err != nil {
+		fmt.Fprintf(os.Stderr, "warc %v: %v\n", os.Args[1], err)
+		os.Exit(1)
+	}
+}
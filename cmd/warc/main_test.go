@@ -0,0 +1,411 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"github.com/wolfgangmeyers/go-warc/warc"
+	. "gopkg.in/check.v1"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func Test(t *testing.T) {
+	TestingT(t)
+}
+
+var sampleArc string = "filedesc://sample.arc 0.0.0.0 19960923142103 text/plain 75\n" +
+	"1 0 Alexa Internet\n" +
+	"URL IP-address Archive-date Content-type Archive-length\n\n" +
+	"http://www.dryswamp.edu:80/index.html 127.10.100.2 19961104142103 text/html 53\n" +
+	"HTTP/1.0 200 OK\nContent-type: text/html\n\nHello world\n\n"
+
+var sampleWarc string = "WARC/1.0\r\n" +
+	"WARC-Type: response\r\n" +
+	"WARC-Record-ID: <urn:uuid:00000000-0000-0000-0000-000000000001>\r\n" +
+	"WARC-Date: 2000-01-02T03:04:05Z\r\n" +
+	"WARC-Target-URI: http://example.com/\r\n" +
+	"Content-Type: application/http; msgtype=response\r\n" +
+	"Content-Length: 50\r\n" +
+	"\r\n" +
+	"HTTP/1.1 200 OK\r\nContent-Type: text/plain\r\n\r\nHello\r\n\r\n" +
+	"WARC/1.0\r\n" +
+	"WARC-Type: resource\r\n" +
+	"WARC-Record-ID: <urn:uuid:00000000-0000-0000-0000-000000000002>\r\n" +
+	"WARC-Date: 2000-01-02T03:04:06Z\r\n" +
+	"WARC-Target-URI: http://example.com/robots.txt\r\n" +
+	"Content-Type: text/plain\r\n" +
+	"Content-Length: 10\r\n" +
+	"\r\n" +
+	"Helloworld\r\n\r\n"
+
+var sampleHar string = `{"log": {"version": "1.2", "creator": {"name": "test", "version": "1.0"}, "entries": [{
+  "startedDateTime": "2000-01-02T03:04:05.250Z", "time": 10,
+  "request": {"method": "GET", "url": "http://example.com/", "httpVersion": "HTTP/1.1", "cookies": [], "headers": [], "queryString": [], "headersSize": -1, "bodySize": 0},
+  "response": {"status": 200, "statusText": "OK", "httpVersion": "HTTP/1.1", "cookies": [], "headers": [{"name": "Content-Type", "value": "text/plain"}],
+    "content": {"size": 5, "mimeType": "text/plain", "text": "Hello"}, "redirectURL": "", "headersSize": -1, "bodySize": 5},
+  "cache": {}, "timings": {"send": 1, "wait": 8, "receive": 1}}]}}`
+
+type CommandSuite struct {
+	dir string
+}
+
+var commandSuite = Suite(&CommandSuite{})
+
+func (s *CommandSuite) SetUpTest(c *C) {
+	s.dir = c.MkDir()
+}
+
+// Writes data to a file in the test directory, gzipped if the name ends in .gz
+func (s *CommandSuite) writeFile(c *C, name string, data string) string {
+	path := filepath.Join(s.dir, name)
+	buf := bytes.Buffer{}
+	if filepath.Ext(name) == ".gz" {
+		gzout := gzip.NewWriter(&buf)
+		gzout.Write([]byte(data))
+		gzout.Close()
+	} else {
+		buf.WriteString(data)
+	}
+	c.Assert(os.WriteFile(path, buf.Bytes(), 0644), IsNil)
+	return path
+}
+
+func (s *CommandSuite) TestArc2Warc(c *C) {
+	input := s.writeFile(c, "sample.arc.gz", sampleArc)
+	output := filepath.Join(s.dir, "sample.warc.gz")
+	stdout := bytes.Buffer{}
+	err := runArc2Warc([]string{"-version", "1.1", input, output}, &stdout)
+	c.Assert(err, IsNil)
+	c.Assert(stdout.String(), Matches, "(?s).*converted 1 records.*verified\n")
+
+	err = runArc2Warc([]string{input}, &stdout)
+	c.Assert(err, NotNil)
+
+	// no partial WARC file is left behind
+	broken := s.writeFile(c, "broken.arc", sampleArc[:len(sampleArc)-20])
+	output = filepath.Join(s.dir, "broken.warc.gz")
+	err = runArc2Warc([]string{broken, output}, &stdout)
+	c.Assert(err, NotNil)
+	_, err = os.Stat(output)
+	c.Assert(os.IsNotExist(err), Equals, true)
+}
+
+func (s *CommandSuite) TestHar2Warc(c *C) {
+	input := s.writeFile(c, "sample.har", sampleHar)
+	output := filepath.Join(s.dir, "sample.warc.zst")
+	stdout := bytes.Buffer{}
+	err := runHar2Warc([]string{input, output}, &stdout)
+	c.Assert(err, IsNil)
+	c.Assert(stdout.String(), Equals, output+": converted 1 entries, skipped 0\n")
+
+	stdout.Reset()
+	c.Assert(runLs([]string{output}, &stdout), IsNil)
+	c.Assert(stdout.String(), Matches, "(?s).*warcinfo.*request.*http://example.com/.*response.*metadata.*")
+
+	err = runHar2Warc([]string{s.writeFile(c, "bad.har", "[]"), output}, &stdout)
+	c.Assert(err, ErrorMatches, "Bad HAR file: .*")
+}
+
+func (s *CommandSuite) TestWarc2Har(c *C) {
+	input := s.writeFile(c, "sample.warc.gz", sampleWarc)
+	output := filepath.Join(s.dir, "sample.har")
+	stdout := bytes.Buffer{}
+	err := runWarc2Har([]string{"-page", "http://example.com/", input, output}, &stdout)
+	c.Assert(err, IsNil)
+	c.Assert(stdout.String(), Equals, output+": exported 1 entries\n")
+	data, err := os.ReadFile(output)
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Matches, `(?s).*"url": "http://example.com/".*"text": "Hello".*`)
+
+	err = runWarc2Har([]string{"-page", "http://example.com/missing", input, output}, &stdout)
+	c.Assert(err, ErrorMatches, ".*No capture of page http://example.com/missing")
+}
+
+func (s *CommandSuite) TestDir2Warc(c *C) {
+	dir := filepath.Join(s.dir, "site")
+	c.Assert(os.MkdirAll(filepath.Join(dir, "css"), 0755), IsNil)
+	c.Assert(os.WriteFile(filepath.Join(dir, "index.html"), []byte("<p>Hello</p>"), 0644), IsNil)
+	c.Assert(os.WriteFile(filepath.Join(dir, "css", "style.css"), []byte("p {}"), 0644), IsNil)
+	output := filepath.Join(s.dir, "site.warc.gz")
+	stdout := bytes.Buffer{}
+	err := runDir2Warc([]string{"-base-url", "https://example.com/", dir, output}, &stdout)
+	c.Assert(err, IsNil)
+	c.Assert(stdout.String(), Equals, output+": wrote 2 files (16 bytes)\n")
+
+	stdout.Reset()
+	c.Assert(runLs([]string{output}, &stdout), IsNil)
+	c.Assert(stdout.String(), Matches, "(?s).*warcinfo.*resource.*https://example.com/css/style.css.*resource.*https://example.com/index.html.*")
+
+	err = runDir2Warc([]string{filepath.Join(s.dir, "missing"), output}, &stdout)
+	c.Assert(err, NotNil)
+
+	// an output file inside the directory is not packaged
+	inside := filepath.Join(dir, "site.warc.zst")
+	stdout.Reset()
+	err = runDir2Warc([]string{"-base-url", "https://example.com/", dir, inside}, &stdout)
+	c.Assert(err, IsNil)
+	c.Assert(stdout.String(), Equals, inside+": wrote 2 files (16 bytes)\n")
+}
+
+func (s *CommandSuite) TestWat(c *C) {
+	input := s.writeFile(c, "sample.warc.gz", sampleWarc)
+	output := filepath.Join(s.dir, "sample.wat.gz")
+	stdout := bytes.Buffer{}
+	err := runWat([]string{input, output}, &stdout)
+	c.Assert(err, IsNil)
+	c.Assert(stdout.String(), Equals, output+": wrote 3 records for 2 records\n")
+
+	stdout.Reset()
+	c.Assert(runLs([]string{output}, &stdout), IsNil)
+	c.Assert(stdout.String(), Matches, "(?s).*warcinfo.*metadata.*http://example.com/\t.*metadata.*http://example.com/robots.txt.*")
+}
+
+func (s *CommandSuite) TestWet(c *C) {
+	// the response as HTML, keeping its length
+	input := s.writeFile(c, "sample.warc", strings.Replace(sampleWarc, "text/plain\r\n\r\nHello", "text/html;\r\n\r\n<p>Hi", 1))
+	output := filepath.Join(s.dir, "sample.wet")
+	stdout := bytes.Buffer{}
+	err := runWet([]string{input, output}, &stdout)
+	c.Assert(err, IsNil)
+	c.Assert(stdout.String(), Equals, output+": wrote 2 records for 2 records\n")
+	data, err := os.ReadFile(output)
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Matches, "(?s).*WARC-Type: conversion\r\n.*\r\n\r\nHi\r\n\r\n")
+}
+
+func (s *CommandSuite) TestRecompress(c *C) {
+	// a single gzip member holding both records
+	input := s.writeFile(c, "sample.warc.gz", sampleWarc)
+	stdout := bytes.Buffer{}
+	zstdOutput := filepath.Join(s.dir, "sample.warc.zst")
+	err := runRecompress([]string{input, zstdOutput}, &stdout)
+	c.Assert(err, IsNil)
+	c.Assert(stdout.String(), Matches, "(?s).*wrote 2 records \\(zstd\\).*verified\n")
+
+	output := filepath.Join(s.dir, "sample.warc")
+	err = runRecompress([]string{zstdOutput, output}, &stdout)
+	c.Assert(err, IsNil)
+	data, err := os.ReadFile(output)
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, sampleWarc)
+}
+
+func (s *CommandSuite) TestWacz(c *C) {
+	input := s.writeFile(c, "sample.warc.gz", sampleWarc)
+	output := filepath.Join(s.dir, "sample.wacz")
+	stdout := bytes.Buffer{}
+	err := runWacz([]string{"-title", "Sample", output, input}, &stdout)
+	c.Assert(err, IsNil)
+	c.Assert(stdout.String(), Equals, output+": packaged 1 WARC files\n")
+	archive, err := zip.OpenReader(output)
+	c.Assert(err, IsNil)
+	defer archive.Close()
+	c.Assert(len(archive.File), Equals, 5)
+
+	err = runWacz([]string{output}, &stdout)
+	c.Assert(err, NotNil)
+}
+
+func (s *CommandSuite) TestLs(c *C) {
+	input := s.writeFile(c, "sample.warc", sampleWarc)
+	stdout := bytes.Buffer{}
+	err := runLs([]string{input}, &stdout)
+	c.Assert(err, IsNil)
+	c.Assert(stdout.String(), Equals, "0\tresponse\t2000-01-02T03:04:05Z\thttp://example.com/\t50\n"+
+		"293\tresource\t2000-01-02T03:04:06Z\thttp://example.com/robots.txt\t10\n")
+
+	err = runLs([]string{filepath.Join(s.dir, "missing.warc")}, &stdout)
+	c.Assert(err, NotNil)
+}
+
+func (s *CommandSuite) TestCat(c *C) {
+	input := s.writeFile(c, "sample.warc", sampleWarc)
+	stdout := bytes.Buffer{}
+	err := runCat([]string{"-offset", "293", "-payload", input}, &stdout)
+	c.Assert(err, IsNil)
+	c.Assert(stdout.String(), Equals, "Helloworld")
+
+	stdout.Reset()
+	err = runCat([]string{"-id", "<urn:uuid:00000000-0000-0000-0000-000000000001>", input}, &stdout)
+	c.Assert(err, IsNil)
+	c.Assert(stdout.String(), Matches, "WARC/1.0\r\nWARC-Type: response\r\n(?s).*Hello\r\n\r\n")
+
+	err = runCat([]string{"-id", "<urn:uuid:00000000-0000-0000-0000-000000000003>", input}, &stdout)
+	c.Assert(err, ErrorMatches, "no record with id .*")
+	err = runCat([]string{input}, &stdout)
+	c.Assert(err, ErrorMatches, "expected either -offset or -id")
+}
+
+func (s *CommandSuite) TestExtract(c *C) {
+	input := s.writeFile(c, "sample.warc.gz", sampleWarc)
+	dir := filepath.Join(s.dir, "out")
+	stdout := bytes.Buffer{}
+	err := runExtract([]string{"-dir", dir, input, input}, &stdout)
+	c.Assert(err, IsNil)
+	data, err := os.ReadFile(filepath.Join(dir, "example.com", "index.html"))
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "Hello")
+	data, err = os.ReadFile(filepath.Join(dir, "example.com", "robots.txt"))
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "Helloworld")
+	_, err = os.Stat(filepath.Join(dir, "example.com", "robots.txt.2"))
+	c.Assert(err, IsNil)
+}
+
+func (s *CommandSuite) TestExtractDecoded(c *C) {
+	compressed := bytes.Buffer{}
+	gzout := gzip.NewWriter(&compressed)
+	gzout.Write([]byte("<p>Hello</p>"))
+	gzout.Close()
+	body := fmt.Sprintf("%x\r\n%s\r\n0\r\n\r\n", compressed.Len(), compressed.Bytes())
+	buf := bytes.Buffer{}
+	warc.NewWARCWriter(&buf, false).WriteRecord(warc.NewWARCRecordFromBytes(map[string]string{
+		"WARC-Type":       "response",
+		"WARC-Target-URI": "http://example.com/page.html",
+		"Content-Type":    "application/http; msgtype=response",
+	}, []byte("HTTP/1.1 200 OK\r\nContent-Type: text/html\r\nContent-Encoding: gzip\r\n"+
+		"Transfer-Encoding: chunked\r\n\r\n"+body)))
+	input := s.writeFile(c, "encoded.warc", buf.String())
+	dir := filepath.Join(s.dir, "out")
+	err := runExtract([]string{"-dir", dir, input}, &bytes.Buffer{})
+	c.Assert(err, IsNil)
+	data, err := os.ReadFile(filepath.Join(dir, "example.com", "page.html"))
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "<p>Hello</p>")
+}
+
+func (s *CommandSuite) TestExtractFileAndDirectory(c *C) {
+	buf := bytes.Buffer{}
+	writer := warc.NewWARCWriter(&buf, false)
+	for _, uri := range []string{"http://example.com/a", "http://example.com/a/b", "http://example.com/a", "..", "http://example.com/c/d", "http://example.com/c"} {
+		writer.WriteRecord(warc.NewWARCRecordFromBytes(map[string]string{
+			"WARC-Type":       "resource",
+			"WARC-Target-URI": uri,
+			"Content-Type":    "text/plain",
+		}, []byte(uri)))
+	}
+	input := s.writeFile(c, "paths.warc", buf.String())
+	dir := filepath.Join(s.dir, "out")
+	stdout := bytes.Buffer{}
+	err := runExtract([]string{"-dir", dir, input}, &stdout)
+	c.Assert(err, IsNil)
+	c.Assert(stdout.String(), Matches, "(?s).*skipped\t\\.\\.\n.*skipped 1 records without a usable URL\n")
+	for name, content := range map[string]string{
+		"a/index.html":   "http://example.com/a",
+		"a/b":            "http://example.com/a/b",
+		"a/index.html.2": "http://example.com/a",
+		"c/d":            "http://example.com/c/d",
+		"c/index.html":   "http://example.com/c",
+	} {
+		data, err := os.ReadFile(filepath.Join(dir, "example.com", filepath.FromSlash(name)))
+		c.Assert(err, IsNil)
+		c.Assert(string(data), Equals, content)
+	}
+}
+
+func (s *CommandSuite) TestExtractExistingFiles(c *C) {
+	writeInput := func(name string, uris ...string) string {
+		buf := bytes.Buffer{}
+		writer := warc.NewWARCWriter(&buf, false)
+		for _, uri := range uris {
+			writer.WriteRecord(warc.NewWARCRecordFromBytes(map[string]string{
+				"WARC-Type":       "resource",
+				"WARC-Target-URI": uri,
+				"Content-Type":    "text/plain",
+			}, []byte(uri)))
+		}
+		return s.writeFile(c, name, buf.String())
+	}
+	input := writeInput("existing.warc", "http://example.com/a", "http://example.com/a/b")
+	dir := filepath.Join(s.dir, "existing")
+	c.Assert(os.MkdirAll(filepath.Join(dir, "example.com"), 0755), IsNil)
+	moved := filepath.Join(dir, "example.com", "a.moved")
+	c.Assert(os.WriteFile(moved, []byte("keep"), 0644), IsNil)
+	err := runExtract([]string{"-dir", dir, input}, &bytes.Buffer{})
+	c.Assert(err, IsNil)
+	data, err := os.ReadFile(moved)
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "keep")
+	data, err = os.ReadFile(filepath.Join(dir, "example.com", "a", "index.html"))
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "http://example.com/a")
+
+	// files that were not extracted are left alone
+	c.Assert(os.RemoveAll(dir), IsNil)
+	c.Assert(os.MkdirAll(filepath.Join(dir, "example.com"), 0755), IsNil)
+	other := filepath.Join(dir, "example.com", "a")
+	c.Assert(os.WriteFile(other, []byte("other"), 0644), IsNil)
+	err = runExtract([]string{"-dir", dir, writeInput("nested.warc", "http://example.com/a/b")}, &bytes.Buffer{})
+	c.Assert(err, ErrorMatches, ".*a is needed as a directory, but is a file")
+	data, err = os.ReadFile(other)
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "other")
+}
+
+func (s *CommandSuite) TestPayloadFilename(c *C) {
+	c.Assert(payloadFilename("http://example.com"), Equals, filepath.Join("example.com", "index.html"))
+	c.Assert(payloadFilename("http://example.com/a/../b c.html"), Equals, filepath.Join("example.com", "a", "b_c.html"))
+	c.Assert(payloadFilename("http://example.com:8080/a?x=1"), Matches, "example.com_8080/a_[0-9a-f]{8}")
+	c.Assert(payloadFilename("dns:example.com"), Equals, "dns_example.com")
+	c.Assert(payloadFilename(""), Equals, "")
+	c.Assert(payloadFilename(".."), Equals, "")
+}
+
+func (s *CommandSuite) TestValidate(c *C) {
+	input := s.writeFile(c, "sample.warc", sampleWarc)
+	stdout := bytes.Buffer{}
+	err := runValidate([]string{input}, &stdout)
+	c.Assert(err, IsNil)
+	c.Assert(stdout.String(), Matches, `(?s)\[\n  \{\n    "filename": ".*sample.warc",\n    "records": 2,\n    "errors": 0,.*`)
+
+	broken := s.writeFile(c, "broken.warc", sampleWarc[:len(sampleWarc)-4])
+	stdout.Reset()
+	err = runValidate([]string{input, broken}, &stdout)
+	c.Assert(err, ErrorMatches, "1 of 2 files are not valid")
+	c.Assert(stdout.String(), Matches, `(?s).*"severity": "error",\n *"message": "Missing CRLFCRLF at the end of the record".*`)
+}
+
+func (s *CommandSuite) TestRepair(c *C) {
+	input := s.writeFile(c, "sample.warc.gz.open", sampleWarc[:len(sampleWarc)-4])
+	stdout := bytes.Buffer{}
+	err := runRepair([]string{input}, &stdout)
+	c.Assert(err, IsNil)
+	c.Assert(stdout.String(), Matches, `(?s).*: offset 293: Added the missing CRLFCRLF at the end of the record\n.*sample.warc.gz: wrote 2 records, 1 changes\n`)
+	stdout.Reset()
+	err = runValidate([]string{strings.TrimSuffix(input, ".open")}, &stdout)
+	c.Assert(err, IsNil)
+
+	// an existing file is only replaced if it is given explicitly
+	c.Assert(os.WriteFile(strings.TrimSuffix(input, ".open"), []byte("keep"), 0644), IsNil)
+	err = runRepair([]string{input}, &stdout)
+	c.Assert(err, ErrorMatches, ".*sample.warc.gz already exists, give the output file to replace it")
+	data, err := os.ReadFile(strings.TrimSuffix(input, ".open"))
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "keep")
+	err = runRepair([]string{input, strings.TrimSuffix(input, ".open")}, &stdout)
+	c.Assert(err, IsNil)
+
+	err = runRepair([]string{input, input + ".repaired", "extra"}, &stdout)
+	c.Assert(err, ErrorMatches, "expected an input and an output file")
+}
+
+func (s *CommandSuite) TestFilter(c *C) {
+	input := s.writeFile(c, "sample.warc.gz", sampleWarc)
+	output := filepath.Join(s.dir, "filtered.warc")
+	stdout := bytes.Buffer{}
+	err := runFilter([]string{"type:response url~example", input, output}, &stdout)
+	c.Assert(err, IsNil)
+	c.Assert(stdout.String(), Matches, ".*filtered.warc: wrote 1 records\n")
+	data, err := os.ReadFile(output)
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, sampleWarc[:293])
+
+	err = runFilter([]string{"type", input, output}, &stdout)
+	c.Assert(err, ErrorMatches, "Bad filter term: type")
+	err = runFilter([]string{input, output}, &stdout)
+	c.Assert(err, ErrorMatches, "expected a filter expression, an input and an output file")
+}
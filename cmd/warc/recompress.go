@@ -0,0 +1,108 @@
+package main
+
+/*
+	Copyright (C) 2015  Wolfgang Meyers
+
+    This program is free software; you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation; either version 2 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License along
+    with this program; if not, write to the Free Software Foundation, Inc.,
+    51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+*/
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/wolfgangmeyers/go-warc/warc"
+	"io"
+	"os"
+	"strings"
+)
+
+// The compression format implied by the extension of a file name.
+func compressionFor(filename string) string {
+	if strings.HasSuffix(filename, ".gz") {
+		return warc.COMPRESSION_GZIP
+	}
+	if strings.HasSuffix(filename, ".zst") {
+		return warc.COMPRESSION_ZSTD
+	}
+	return warc.COMPRESSION_NONE
+}
+
+// Creates a writer for out, compressed as the name of the file says.
+func newWriterFor(out io.Writer, filename string) (*warc.WARCWriter, error) {
+	switch compressionFor(filename) {
+	case warc.COMPRESSION_ZSTD:
+		return warc.NewZstdWARCWriter(out, nil)
+	case warc.COMPRESSION_GZIP:
+		return warc.NewWARCWriter(out, true), nil
+	}
+	return warc.NewWARCWriter(out, false), nil
+}
+
+// Rewrites a WARC file with per record gzip or zstd compression, or
+// uncompressed, and verifies the result by reading it again.
+func runRecompress(args []string, stdout io.Writer) error {
+	flags := flag.NewFlagSet("recompress", flag.ContinueOnError)
+	compression := flags.String("compression", "", "gzip, zstd or none; by default taken from the output file name")
+	dictionary := flags.String("dictionary", "", "zstd dictionary to compress records with")
+	verify := flags.Bool("verify", true, "verify the WARC file after recompression")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 2 {
+		return errors.New("expected an input and an output file")
+	}
+	input, output := flags.Arg(0), flags.Arg(1)
+	options := warc.RecompressOptions{Compression: *compression}
+	if options.Compression == "" {
+		options.Compression = compressionFor(output)
+	}
+	if *dictionary != "" {
+		data, err := os.ReadFile(*dictionary)
+		if err != nil {
+			return err
+		}
+		options.Dictionary = data
+	}
+	in, err := os.Open(input)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(output)
+	if err != nil {
+		return err
+	}
+	result, err := warc.Recompress(in, out, options)
+	if err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	fmt.Fprintf(stdout, "%v: wrote %v records (%v)\n", output, result.Records, options.Compression)
+	if !*verify {
+		return nil
+	}
+	recompressed, err := os.Open(output)
+	if err != nil {
+		return err
+	}
+	defer recompressed.Close()
+	if err := warc.VerifyRecompression(result, recompressed); err != nil {
+		return errors.New(fmt.Sprintf("verification of %v failed: %v", output, err))
+	}
+	fmt.Fprintf(stdout, "%v: verified\n", output)
+	return nil
+}
@@ -0,0 +1,76 @@
+package main
+
+/*
+	Copyright (C) 2015  Wolfgang Meyers
+
+    This program is free software; you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation; either version 2 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License along
+    with this program; if not, write to the Free Software Foundation, Inc.,
+    51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+*/
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/wolfgangmeyers/go-warc/warc"
+	"io"
+	"os"
+	"strings"
+)
+
+// Rewrites a damaged WARC file into a valid one. The output file defaults
+// to the name of a ".open" file left behind by a crawler, without ".open",
+// but must be given explicitly to replace an existing file.
+func runRepair(args []string, stdout io.Writer) error {
+	flags := flag.NewFlagSet("repair", flag.ContinueOnError)
+	compression := flags.String("compression", "", "gzip, zstd or none; by default taken from the output file name")
+	drop := flags.Bool("drop-incomplete", false, "drop an incomplete final record instead of truncating it")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	input, output := flags.Arg(0), flags.Arg(1)
+	mode := os.O_RDWR | os.O_CREATE | os.O_TRUNC
+	if flags.NArg() == 1 && strings.HasSuffix(input, ".open") {
+		output = strings.TrimSuffix(input, ".open")
+		mode = os.O_RDWR | os.O_CREATE | os.O_EXCL
+	} else if flags.NArg() != 2 {
+		return errors.New("expected an input and an output file")
+	}
+	options := warc.RepairOptions{Compression: *compression, DropIncomplete: *drop}
+	if options.Compression == "" {
+		options.Compression = compressionFor(output)
+	}
+	in, err := os.Open(input)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(output, mode, 0666)
+	if os.IsExist(err) {
+		return errors.New(fmt.Sprintf("%v already exists, give the output file to replace it", output))
+	} else if err != nil {
+		return err
+	}
+	result, err := warc.Repair(in, out, options)
+	if err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	for _, change := range result.Changes {
+		fmt.Fprintf(stdout, "%v: %v\n", input, change)
+	}
+	fmt.Fprintf(stdout, "%v: wrote %v records, %v changes\n", output, result.Records, len(result.Changes))
+	return nil
+}
@@ -0,0 +1,68 @@
+package main
+
+/*
+	Copyright (C) 2015  Wolfgang Meyers
+
+    This program is free software; you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation; either version 2 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License along
+    with this program; if not, write to the Free Software Foundation, Inc.,
+    51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+*/
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/wolfgangmeyers/go-warc/warc"
+	"io"
+	"os"
+)
+
+// Validates WARC files, writing a JSON report with a
+// ValidationReport for each file to stdout.
+func runValidate(args []string, stdout io.Writer) error {
+	flags := flag.NewFlagSet("validate", flag.ContinueOnError)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() == 0 {
+		return errors.New("expected at least one WARC file")
+	}
+	reports := []*warc.ValidationReport{}
+	invalid := 0
+	for _, filename := range flags.Args() {
+		f, err := os.Open(filename)
+		if err != nil {
+			return err
+		}
+		report, err := warc.Validate(f, filename)
+		f.Close()
+		if err != nil {
+			return errors.New(fmt.Sprintf("%v: %v", filename, err))
+		}
+		if !report.Valid() {
+			invalid++
+		}
+		reports = append(reports, report)
+	}
+	data, err := json.MarshalIndent(reports, "", "  ")
+	if err != nil {
+		return err
+	}
+	if _, err := stdout.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	if invalid > 0 {
+		return errors.New(fmt.Sprintf("%v of %v files are not valid", invalid, len(reports)))
+	}
+	return nil
+}
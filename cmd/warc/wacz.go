@@ -0,0 +1,61 @@
+package main
+
+/*
+	Copyright (C) 2015  Wolfgang Meyers
+
+    This program is free software; you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation; either version 2 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License along
+    with this program; if not, write to the Free Software Foundation, Inc.,
+    51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+*/
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/wolfgangmeyers/go-warc/warc/wacz"
+	"io"
+	"os"
+)
+
+// Packages WARC files into a WACZ file.
+func runWacz(args []string, stdout io.Writer) error {
+	flags := flag.NewFlagSet("wacz", flag.ContinueOnError)
+	title := flags.String("title", "", "title of the package")
+	description := flags.String("description", "", "description of the package")
+	mainPage := flags.String("main-page", "", "URL of the page to start replay with")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() < 2 {
+		return errors.New("expected an output file and at least one WARC file")
+	}
+	output := flags.Arg(0)
+	out, err := os.Create(output)
+	if err != nil {
+		return err
+	}
+	err = wacz.Create(out, flags.Args()[1:], wacz.Options{
+		Title:       *title,
+		Description: *description,
+		MainPageURL: *mainPage,
+	})
+	if err != nil {
+		out.Close()
+		os.Remove(output)
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	fmt.Fprintf(stdout, "%v: packaged %v WARC files\n", output, flags.NArg()-1)
+	return nil
+}
@@ -0,0 +1,64 @@
+package main
+
+/*
+	Copyright (C) 2015  Wolfgang Meyers
+
+    This program is free software; you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation; either version 2 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License along
+    with this program; if not, write to the Free Software Foundation, Inc.,
+    51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+*/
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/wolfgangmeyers/go-warc/warc"
+	"io"
+	"os"
+)
+
+// Exports the request and response records of a WARC file as a HAR file.
+func runWarc2Har(args []string, stdout io.Writer) error {
+	flags := flag.NewFlagSet("warc2har", flag.ContinueOnError)
+	page := flags.String("page", "", "only export the entries of the page with this URL")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 2 {
+		return errors.New("expected an input and an output file")
+	}
+	input, output := flags.Arg(0), flags.Arg(1)
+	f, err := os.Open(input)
+	if err != nil {
+		return err
+	}
+	wf, err := warc.NewWARCFile(f)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	defer wf.Close()
+	har, err := warc.ExportHAR(wf.Records(), warc.HARExportOptions{PageURL: *page})
+	if err != nil {
+		return errors.New(fmt.Sprintf("%v: %v", input, err))
+	}
+	data, err := json.MarshalIndent(har, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(output, append(data, '\n'), 0644); err != nil {
+		return err
+	}
+	fmt.Fprintf(stdout, "%v: exported %v entries\n", output, len(har.Log.Entries))
+	return nil
+}
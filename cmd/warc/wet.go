@@ -0,0 +1,64 @@
+package main
+
+/*
+	Copyright (C) 2015  Wolfgang Meyers
+
+    This program is free software; you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation; either version 2 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License along
+    with this program; if not, write to the Free Software Foundation, Inc.,
+    51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+*/
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/wolfgangmeyers/go-warc/warc/commoncrawl"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Writes the WET file of a WARC file.
+func runWet(args []string, stdout io.Writer) error {
+	flags := flag.NewFlagSet("wet", flag.ContinueOnError)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 2 {
+		return errors.New("expected an input and an output file")
+	}
+	input, output := flags.Arg(0), flags.Arg(1)
+	in, err := os.Open(input)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(output)
+	if err != nil {
+		return err
+	}
+	writer, err := newWriterFor(out, output)
+	if err != nil {
+		out.Close()
+		return err
+	}
+	result, err := commoncrawl.ConvertWET(in, writer, commoncrawl.ConversionOptions{Filename: filepath.Base(input)})
+	if err != nil {
+		out.Close()
+		return errors.New(fmt.Sprintf("%v: %v", input, err))
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	fmt.Fprintf(stdout, "%v: wrote %v records for %v records\n", output, result.Written, result.Records)
+	return nil
+}
@@ -0,0 +1,251 @@
+package warc
+
+/*
+	Copyright (C) 2015  Wolfgang Meyers
+
+    This program is free software; you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation; either version 2 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License along
+    with this program; if not, write to the Free Software Foundation, Inc.,
+    51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+*/
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/wolfgangmeyers/go-warc/warc/utils"
+	"io"
+	"iter"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RecordReader is implemented by WARCReader and ARCReader,
+// so that WARC and ARC files can be processed by the same code.
+// ReadRecord returns io.EOF at the end of the file, and any other
+// error, including a truncated last record, as is.
+type RecordReader interface {
+	ReadRecord() (*WARCRecord, error)
+	Iterate(callback func(*WARCRecord, error))
+	Records() iter.Seq2[*WARCRecord, error]
+}
+
+// The header of an ARC file, read from its filedesc record.
+type ARCFileHeader struct {
+	// The file name from the filedesc:// URL
+	Filename    string
+	IPAddress   string
+	Date        string
+	ContentType string
+	// The version block: major version, minor version and origin code
+	MajorVersion string
+	MinorVersion string
+	Origin       string
+	// The names of the fields of each URL record line
+	Fields []string
+	// The complete content of the filedesc record
+	Content []byte
+}
+
+// ARCFile reads the records of an ARC file, which may be uncompressed
+// or compressed with one gzip member per record.
+type ARCFile struct {
+	filehandle io.ReadCloser
+	reader     *ARCReader
+}
+
+// Creates a new ARCFile, reading the file header from the start of reader.
+func NewARCFile(reader io.ReadCloser) (*ARCFile, error) {
+	arcReader, err := NewARCReader(reader)
+	if err != nil {
+		return nil, err
+	}
+	return &ARCFile{
+		filehandle: reader,
+		reader:     arcReader,
+	}, nil
+}
+
+func (af *ARCFile) GetReader() *ARCReader {
+	return af.reader
+}
+
+func (af *ARCFile) GetFileHeader() *ARCFileHeader {
+	return af.reader.GetFileHeader()
+}
+
+func (af *ARCFile) ReadRecord() (*WARCRecord, error) {
+	return af.reader.ReadRecord()
+}
+
+func (af *ARCFile) Close() error {
+	return af.filehandle.Close()
+}
+
+// ARCReader reads the URL records of an ARC file and exposes them as
+// response records with the WARC-Target-URI, WARC-IP-Address and WARC-Date
+// headers taken from the URL record line. Records holding an HTTP response
+// get the Content-Type of WARC response records, with the mimetype of the
+// URL record line in WARC-Identified-Payload-Type; other records get
+// the mimetype as Content-Type.
+type ARCReader struct {
+	stream     *recordStream
+	fileHeader *ARCFileHeader
+}
+
+// Creates a new ARCReader, reading the file header from the start of reader.
+func NewARCReader(reader io.Reader) (*ARCReader, error) {
+	stream, err := newRecordStream(reader, nil)
+	if err != nil {
+		return nil, err
+	}
+	ar := &ARCReader{stream: stream}
+	if err := ar.readFileHeader(); err != nil {
+		return nil, err
+	}
+	return ar, nil
+}
+
+func (ar *ARCReader) GetFileHeader() *ARCFileHeader {
+	return ar.fileHeader
+}
+
+func (ar *ARCReader) readFileHeader() error {
+	if _, err := ar.stream.next(); err != nil {
+		return err
+	}
+	line, err := ar.stream.reader.ReadString('\n')
+	if err != nil {
+		return err
+	}
+	fields := strings.Fields(line)
+	if len(fields) != 5 || !strings.HasPrefix(fields[0], "filedesc://") {
+		return errors.New(fmt.Sprintf("Bad ARC file header: %v", line))
+	}
+	length, err := strconv.Atoi(fields[4])
+	if err != nil || length < 0 {
+		return errors.New(fmt.Sprintf("Bad ARC file header: %v", line))
+	}
+	// read in steps rather than allocating a length that may be bogus
+	buf := bytes.Buffer{}
+	if n, err := io.CopyN(&buf, ar.stream.reader, int64(length)); err != nil {
+		return errors.New(fmt.Sprintf("Truncated ARC file header: %v of %v bytes", n, length))
+	}
+	content := buf.Bytes()
+	header := &ARCFileHeader{
+		Filename:    strings.TrimPrefix(fields[0], "filedesc://"),
+		IPAddress:   fields[1],
+		Date:        fields[2],
+		ContentType: fields[3],
+		Content:     content,
+	}
+	lines := strings.SplitN(string(content), "\n", 3)
+	if len(lines) < 2 {
+		return errors.New("Bad ARC version block")
+	}
+	version := strings.Fields(lines[0])
+	if len(version) < 2 {
+		return errors.New(fmt.Sprintf("Bad ARC version line: %v", lines[0]))
+	}
+	header.MajorVersion, header.MinorVersion = version[0], version[1]
+	header.Origin = strings.Join(version[2:], " ")
+	header.Fields = strings.Fields(lines[1])
+	ar.fileHeader = header
+	return nil
+}
+
+// Converts an ARC date (up to 14 digits, YYYYMMDDhhmmss) to a WARC-Date.
+func ARCDateToWARCDate(date string) (string, error) {
+	padding := "19700101000000"
+	if len(date) < len(padding) {
+		date = date + padding[len(date):]
+	}
+	t, err := time.Parse("20060102150405", date)
+	if err != nil {
+		return "", err
+	}
+	return FormatDate(t), nil
+}
+
+func (ar *ARCReader) ReadRecord() (*WARCRecord, error) {
+	offset, err := ar.stream.next()
+	if err != nil {
+		return nil, err
+	}
+	line, err := ar.stream.reader.ReadString('\n')
+	if err == io.EOF {
+		err = errors.New(fmt.Sprintf("Truncated ARC record line at offset %v: %v", offset, io.ErrUnexpectedEOF))
+	}
+	if err != nil {
+		return nil, err
+	}
+	fields := strings.Fields(line)
+	// version 2 URL records carry the result code, checksum, location,
+	// offset and filename between the mimetype and the length.
+	extra := 0
+	if ar.fileHeader.MajorVersion == "2" {
+		extra = 5
+	}
+	if len(fields) < 5+extra {
+		return nil, errors.New(fmt.Sprintf("Bad ARC record line: %v", line))
+	}
+	n := len(fields) - 4 - extra
+	url := strings.Join(fields[:n], "%20")
+	ip, arcDate, mimetype := fields[n], fields[n+1], fields[n+2]
+	length, err := strconv.Atoi(fields[len(fields)-1])
+	if err != nil || length < 0 {
+		return nil, errors.New(fmt.Sprintf("Bad ARC record line: %v", line))
+	}
+	date, err := ARCDateToWARCDate(arcDate)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Bad ARC record date: %v", line))
+	}
+	payload, err := utils.NewFilePart(ar.stream.reader, length)
+	if err == nil && len(payload.GetData()) < length {
+		err = errors.New(fmt.Sprintf("%v of %v bytes", len(payload.GetData()), length))
+	}
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Truncated record at offset %v: %v", offset, err))
+	}
+	headers := map[string]string{
+		"WARC-Type":       "response",
+		"WARC-Target-URI": url,
+		"WARC-Date":       date,
+		"Content-Length":  strconv.Itoa(length),
+	}
+	if ip != "-" && ip != "0.0.0.0" {
+		headers["WARC-IP-Address"] = ip
+	}
+	if bytes.HasPrefix(payload.GetData(), []byte("HTTP/")) {
+		headers["Content-Type"] = CONTENT_TYPES["response"]
+		headers["WARC-Identified-Payload-Type"] = mimetype
+	} else {
+		headers["Content-Type"] = mimetype
+	}
+	record := NewWARCRecord(NewWARCHeader(headers, false), payload, nil)
+	record.offset = int(offset)
+	return record, nil
+}
+
+// Returns an iterator over the records of the file, see WARCReader.Records.
+func (ar *ARCReader) Records() iter.Seq2[*WARCRecord, error] {
+	return records(ar.ReadRecord)
+}
+
+func (ar *ARCReader) Iterate(callback func(*WARCRecord, error)) {
+	record, err := ar.ReadRecord()
+	callback(record, err)
+	for record != nil {
+		record, err = ar.ReadRecord()
+		callback(record, err)
+	}
+}
@@ -0,0 +1,275 @@
+package warc
+
+/*
+	Copyright (C) 2015  Wolfgang Meyers
+
+    This program is free software; you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation; either version 2 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License along
+    with this program; if not, write to the Free Software Foundation, Inc.,
+    51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+*/
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"github.com/nu7hatch/gouuid"
+	"io"
+	"strconv"
+	"strings"
+)
+
+var SOFTWARE string = "go-warc"
+
+// Values of the format and conformsTo warcinfo fields by WARC version
+var WARC_FORMATS map[string]string = map[string]string{
+	"1.0": "WARC File Format 1.0",
+	"1.1": "WARC File Format 1.1",
+}
+var WARC_SPECIFICATIONS map[string]string = map[string]string{
+	"1.0": "http://bibnum.bnf.fr/WARC/WARC_ISO_28500_version1_latestdraft.pdf",
+	"1.1": "https://iipc.github.io/warc-specifications/specifications/warc-format/warc-1.1/",
+}
+
+// Options for ConvertARC
+type ARCConversionOptions struct {
+	// The WARC version to write, "1.0" (the default) or "1.1"
+	Version string
+	// Write each record as a separate gzip member
+	Compress bool
+	// The WARC-Filename of the warcinfo record. Defaults to the
+	// name of the ARC file with a .warc or .warc.gz extension.
+	Filename string
+}
+
+type ARCConversionResult struct {
+	// The number of URL records that were converted
+	Records int
+	// The digest of the complete ARC file
+	SourceDigest string
+}
+
+// Converts an ARC file to a WARC file. The WARC file starts with a warcinfo
+// record describing the ARC filedesc, followed by a response record holding
+// the original bytes of each URL record, and ends with a metadata record
+// noting the conversion, including the digest of the ARC file.
+//
+// The conversion is reproducible: record ids are name based UUIDs derived
+// from the ARC file name and record offsets, and all dates are taken from
+// the ARC file, so converting the same file twice gives identical output.
+func ConvertARC(arc io.Reader, out io.Writer, options ARCConversionOptions) (*ARCConversionResult, error) {
+	version := options.Version
+	if version == "" {
+		version = "1.0"
+	}
+	if _, supported := WARC_FORMATS[version]; !supported {
+		return nil, errors.New(fmt.Sprintf("Unsupported WARC version: %v", version))
+	}
+	hash := sha1.New()
+	reader, err := NewARCReader(io.TeeReader(arc, hash))
+	if err != nil {
+		return nil, err
+	}
+	fileHeader := reader.GetFileHeader()
+	date, err := ARCDateToWARCDate(fileHeader.Date)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Bad ARC file date: %v", fileHeader.Date))
+	}
+	filename := options.Filename
+	if filename == "" {
+		filename = strings.TrimSuffix(strings.TrimSuffix(fileHeader.Filename, ".gz"), ".arc") + ".warc"
+		if options.Compress {
+			filename += ".gz"
+		}
+	}
+	namespace, err := uuid.NewV5(uuid.NamespaceURL, []byte("filedesc://"+fileHeader.Filename))
+	if err != nil {
+		return nil, err
+	}
+	recordId := func(name string) string {
+		id, err := uuid.NewV5(namespace, []byte(name))
+		if err != nil {
+			panic(err)
+		}
+		return fmt.Sprintf("<urn:uuid:%v>", id.String())
+	}
+	writer := NewWARCWriter(out, options.Compress)
+	write := func(record *WARCRecord) error {
+		record.GetHeader().SetVersion("WARC/" + version)
+		_, err := writer.WriteRecord(record)
+		return err
+	}
+
+	fields := []string{
+		"software: " + SOFTWARE,
+		"format: " + WARC_FORMATS[version],
+		"conformsTo: " + WARC_SPECIFICATIONS[version],
+		"description: Converted from ARC file " + fileHeader.Filename,
+		"arc-version: " + fileHeader.MajorVersion + " " + fileHeader.MinorVersion,
+	}
+	if fileHeader.Origin != "" {
+		fields = append(fields, "arc-origin: "+fileHeader.Origin)
+	}
+	if fileHeader.IPAddress != "0.0.0.0" {
+		fields = append(fields, "ip: "+fileHeader.IPAddress)
+	}
+	warcinfoId := recordId("warcinfo")
+	warcinfo := NewWARCRecordFromBytes(map[string]string{
+		"WARC-Type":      "warcinfo",
+		"WARC-Record-ID": warcinfoId,
+		"WARC-Date":      date,
+		"WARC-Filename":  filename,
+		"Content-Type":   CONTENT_TYPES["warcinfo"],
+	}, []byte(strings.Join(fields, "\r\n")+"\r\n"))
+	if err := write(warcinfo); err != nil {
+		return nil, err
+	}
+
+	result := &ARCConversionResult{}
+	for {
+		record, err := reader.ReadRecord()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("Reading ARC record %v: %v", result.Records+1, err))
+		}
+		data := record.GetPayload().GetData()
+		record.Set("WARC-Record-ID", recordId(strconv.Itoa(record.Offset())))
+		record.Set("WARC-Warcinfo-ID", warcinfoId)
+		record.Set("WARC-Block-Digest", ComputeDigest(data))
+		if strings.HasPrefix(record.GetUrl(), "http") {
+			record.Set("WARC-Payload-Digest", ComputePayloadDigest(record))
+		}
+		if err := write(record); err != nil {
+			return nil, err
+		}
+		result.Records++
+	}
+	// make sure that the digest covers any trailing bytes
+	if _, err := io.Copy(hash, arc); err != nil {
+		return nil, err
+	}
+	result.SourceDigest = "sha1:" + base32.StdEncoding.EncodeToString(hash.Sum(nil))
+
+	fields = []string{
+		"software: " + SOFTWARE,
+		"arc-filename: " + fileHeader.Filename,
+		"arc-digest: " + result.SourceDigest,
+		"arc-records: " + strconv.Itoa(result.Records),
+	}
+	metadata := NewWARCRecordFromBytes(map[string]string{
+		"WARC-Type":        "metadata",
+		"WARC-Record-ID":   recordId("metadata"),
+		"WARC-Date":        date,
+		"WARC-Target-URI":  "filedesc://" + fileHeader.Filename,
+		"WARC-Warcinfo-ID": warcinfoId,
+		"Content-Type":     CONTENT_TYPES["metadata"],
+	}, []byte(strings.Join(fields, "\r\n")+"\r\n"))
+	if err := write(metadata); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Parses an application/warc-fields block into a map.
+func ParseWARCFields(block []byte) map[string]string {
+	fields := map[string]string{}
+	for _, line := range strings.Split(string(block), "\n") {
+		parts := strings.SplitN(strings.TrimRight(line, "\r"), ":", 2)
+		if len(parts) == 2 {
+			fields[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+		}
+	}
+	return fields
+}
+
+// Verifies that warcfile holds a complete conversion of arc as written by
+// ConvertARC: every URL record must be present in order with the same
+// target URI, date, length and content, the block digests of all records
+// must be correct, and the metadata record must hold the digest of the ARC
+// file.
+func VerifyARCConversion(arc io.Reader, warcfile io.Reader) error {
+	hash := sha1.New()
+	arcReader, err := NewARCReader(io.TeeReader(arc, hash))
+	if err != nil {
+		return err
+	}
+	wf, err := NewWARCFile(io.NopCloser(warcfile))
+	if err != nil {
+		return err
+	}
+	warcinfo, err := wf.ReadRecord()
+	if err != nil {
+		return err
+	}
+	if warcinfo.GetType() != "warcinfo" {
+		return errors.New("The WARC file does not start with a warcinfo record")
+	}
+	count := 0
+	for {
+		record, err := wf.ReadRecord()
+		if err != nil {
+			return errors.New(fmt.Sprintf("Reading WARC record %v: %v", count+1, err))
+		}
+		if err := verifyBlockDigest(record); err != nil {
+			return err
+		}
+		if record.GetType() == "metadata" {
+			if _, err := io.Copy(hash, arc); err != nil {
+				return err
+			}
+			if _, err := arcReader.ReadRecord(); err != io.EOF {
+				return errors.New(fmt.Sprintf("The WARC file holds only %v of the ARC records", count))
+			}
+			fields := ParseWARCFields(record.GetPayload().GetData())
+			digest := "sha1:" + base32.StdEncoding.EncodeToString(hash.Sum(nil))
+			if fields["arc-digest"] != digest {
+				return errors.New(fmt.Sprintf("ARC digest %v does not match %v", digest, fields["arc-digest"]))
+			}
+			if fields["arc-records"] != strconv.Itoa(count) {
+				return errors.New(fmt.Sprintf("Found %v records, expected %v", count, fields["arc-records"]))
+			}
+			return nil
+		}
+		count++
+		arcRecord, err := arcReader.ReadRecord()
+		if err != nil {
+			return errors.New(fmt.Sprintf("Reading ARC record %v: %v", count, err))
+		}
+		if record.GetUrl() != arcRecord.GetUrl() || record.GetDate() != arcRecord.GetDate() {
+			return errors.New(fmt.Sprintf("Record %v is for %v at %v, expected %v at %v", count,
+				record.GetUrl(), record.GetDate(), arcRecord.GetUrl(), arcRecord.GetDate()))
+		}
+		length := arcRecord.GetHeader().GetContentLength()
+		if record.GetHeader().GetContentLength() != length || len(record.GetPayload().GetData()) != length {
+			return errors.New(fmt.Sprintf("Record %v (%v) has a Content-Length of %v and a block of %v bytes, expected %v bytes",
+				count, record.GetUrl(), record.GetHeader().GetContentLength(), len(record.GetPayload().GetData()), length))
+		}
+		if !bytes.Equal(record.GetPayload().GetData(), arcRecord.GetPayload().GetData()) {
+			return errors.New(fmt.Sprintf("Content of record %v (%v) differs", count, record.GetUrl()))
+		}
+	}
+}
+
+func verifyBlockDigest(record *WARCRecord) error {
+	digest, exists := record.Get("WARC-Block-Digest")
+	if !exists {
+		return errors.New(fmt.Sprintf("Record %v has no block digest", record.GetHeader().GetRecordId()))
+	}
+	if computed := ComputeDigest(record.GetPayload().GetData()); computed != digest {
+		return errors.New(fmt.Sprintf("Block digest of record %v is %v, expected %v",
+			record.GetHeader().GetRecordId(), computed, digest))
+	}
+	return nil
+}
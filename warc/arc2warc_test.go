@@ -0,0 +1,129 @@
+package warc
+
+import (
+	"bytes"
+	"errors"
+	. "gopkg.in/check.v1"
+	"io"
+	"testing/iotest"
+)
+
+type ARCConversionSuite struct{}
+
+var arcConversionSuite = Suite(&ARCConversionSuite{})
+
+func (s *ARCConversionSuite) TestConvert(c *C) {
+	for _, compress := range []bool{true, false} {
+		arc := getSampleArc(compress)
+		out := bytes.Buffer{}
+		result, err := ConvertARC(bytes.NewReader(arc), &out, ARCConversionOptions{Version: "1.1", Compress: compress})
+		c.Assert(err, IsNil)
+		c.Assert(result.Records, Equals, 2)
+		c.Assert(result.SourceDigest, Equals, ComputeDigest(arc))
+
+		f, err := NewWARCFile(&ClosingBuffer{bytes.NewReader(out.Bytes())})
+		c.Assert(err, IsNil)
+		types := []string{}
+		records := []*WARCRecord{}
+		for {
+			record, err := f.ReadRecord()
+			if err != nil {
+				break
+			}
+			c.Assert(record.GetHeader().GetVersion(), Equals, "WARC/1.1")
+			types = append(types, record.GetType())
+			records = append(records, record)
+		}
+		c.Assert(types, DeepEquals, []string{"warcinfo", "response", "response", "metadata"})
+		v, _ := records[0].Get("WARC-Filename")
+		if compress {
+			c.Assert(v, Equals, "IA-001102.warc.gz")
+		} else {
+			c.Assert(v, Equals, "IA-001102.warc")
+		}
+		c.Assert(records[0].GetDate(), Equals, "1996-09-23T14:21:03Z")
+		fields := ParseWARCFields(records[0].GetPayload().GetData())
+		c.Assert(fields["arc-origin"], Equals, "Alexa Internet")
+		v, _ = records[1].Get("WARC-Warcinfo-ID")
+		c.Assert(v, Equals, records[0].GetHeader().GetRecordId())
+		c.Assert(records[1].GetChecksum(), Equals, ComputeDigest([]byte("Hello world\n")))
+		fields = ParseWARCFields(records[3].GetPayload().GetData())
+		c.Assert(fields["arc-records"], Equals, "2")
+
+		c.Assert(VerifyARCConversion(bytes.NewReader(arc), bytes.NewReader(out.Bytes())), IsNil)
+	}
+}
+
+func (s *ARCConversionSuite) TestReproducible(c *C) {
+	arc := getSampleArc(true)
+	first, second := bytes.Buffer{}, bytes.Buffer{}
+	_, err := ConvertARC(bytes.NewReader(arc), &first, ARCConversionOptions{Compress: true})
+	c.Assert(err, IsNil)
+	_, err = ConvertARC(bytes.NewReader(arc), &second, ARCConversionOptions{Compress: true})
+	c.Assert(err, IsNil)
+	c.Assert(bytes.Equal(first.Bytes(), second.Bytes()), Equals, true)
+}
+
+func (s *ARCConversionSuite) TestVerifyFailure(c *C) {
+	arc := getSampleArc(false)
+	out := bytes.Buffer{}
+	_, err := ConvertARC(bytes.NewReader(arc), &out, ARCConversionOptions{})
+	c.Assert(err, IsNil)
+	corrupted := bytes.Replace(out.Bytes(), []byte("Hello world"), []byte("Hello World"), 1)
+	c.Assert(VerifyARCConversion(bytes.NewReader(arc), bytes.NewReader(corrupted)), NotNil)
+
+	other := bytes.Replace(arc, []byte("Hello world"), []byte("Hello World"), 1)
+	c.Assert(VerifyARCConversion(bytes.NewReader(other), bytes.NewReader(out.Bytes())), NotNil)
+}
+
+func (s *ARCConversionSuite) TestUnsupportedVersion(c *C) {
+	_, err := ConvertARC(bytes.NewReader(getSampleArc(false)), &bytes.Buffer{}, ARCConversionOptions{Version: "0.9"})
+	c.Assert(err, NotNil)
+}
+
+func (s *ARCConversionSuite) TestTruncatedRecord(c *C) {
+	arc := getSampleArc(false)
+	truncated := arc[:len(sampleArcRecords[0])+len(sampleArcRecords[1])-20]
+	out := bytes.Buffer{}
+	_, err := ConvertARC(bytes.NewReader(truncated), &out, ARCConversionOptions{})
+	c.Assert(err, ErrorMatches, "Reading ARC record 1: Truncated record at offset 138: .*")
+
+	out.Reset()
+	_, err = ConvertARC(bytes.NewReader(arc), &out, ARCConversionOptions{})
+	c.Assert(err, IsNil)
+	c.Assert(VerifyARCConversion(bytes.NewReader(truncated), bytes.NewReader(out.Bytes())), NotNil)
+	// a record that does not match the declared length of the ARC record
+	other := bytes.Replace(arc, []byte("Hello world\n\n"), []byte("Hello world!\n\n"), 1)
+	other = bytes.Replace(other, []byte("text/html 53"), []byte("text/html 54"), 1)
+	c.Assert(VerifyARCConversion(bytes.NewReader(other), bytes.NewReader(out.Bytes())), ErrorMatches,
+		"Record 1 .* has a Content-Length of 53 and a block of 53 bytes, expected 54 bytes")
+}
+
+// brokenReader reports the end of its data once, and fails after that.
+type brokenReader struct {
+	reader io.Reader
+	eof    bool
+}
+
+func (br *brokenReader) Read(p []byte) (int, error) {
+	if br.eof {
+		return 0, errors.New("broken")
+	}
+	n, err := br.reader.Read(p)
+	br.eof = err == io.EOF
+	return n, err
+}
+
+func (s *ARCConversionSuite) TestReadError(c *C) {
+	arc := getSampleArc(false)
+	out := bytes.Buffer{}
+	_, err := ConvertARC(&brokenReader{reader: bytes.NewReader(arc)}, &out, ARCConversionOptions{})
+	c.Assert(err, ErrorMatches, "broken")
+
+	out.Reset()
+	_, err = ConvertARC(bytes.NewReader(arc), &out, ARCConversionOptions{})
+	c.Assert(err, IsNil)
+	broken := io.MultiReader(bytes.NewReader(arc), iotest.ErrReader(errors.New("broken")))
+	err = VerifyARCConversion(broken, bytes.NewReader(out.Bytes()))
+	c.Assert(err, ErrorMatches, "broken")
+}
@@ -0,0 +1,166 @@
+package warc
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	. "gopkg.in/check.v1"
+	"io"
+)
+
+var sampleArcRecords []string = []string{
+	"filedesc://IA-001102.arc 0.0.0.0 19960923142103 text/plain 75\n" +
+		"1 0 Alexa Internet\n" +
+		"URL IP-address Archive-date Content-type Archive-length\n\n",
+	"http://www.dryswamp.edu:80/index.html 127.10.100.2 19961104142103 text/html 53\n" +
+		"HTTP/1.0 200 OK\nContent-type: text/html\n\nHello world\n\n",
+	"dns:www.dryswamp.edu 127.0.0.1 19961104142104 text/dns 41\n" +
+		"19961104142104\nwww.dryswamp.edu. 3600 IN\n\n",
+}
+
+func getSampleArc(compress bool) []byte {
+	buf := bytes.Buffer{}
+	for _, record := range sampleArcRecords {
+		if compress {
+			gzout := gzip.NewWriter(&buf)
+			gzout.Write([]byte(record))
+			gzout.Close()
+		} else {
+			buf.WriteString(record)
+		}
+	}
+	return buf.Bytes()
+}
+
+type ARCSuite struct{}
+
+var arcSuite = Suite(&ARCSuite{})
+
+func (s *ARCSuite) checkRecords(c *C, data []byte) {
+	f, err := NewARCFile(&ClosingBuffer{bytes.NewReader(data)})
+	c.Assert(err, IsNil)
+	defer f.Close()
+	header := f.GetFileHeader()
+	c.Assert(header.Filename, Equals, "IA-001102.arc")
+	c.Assert(header.MajorVersion, Equals, "1")
+	c.Assert(header.Origin, Equals, "Alexa Internet")
+	c.Assert(header.Fields, DeepEquals, []string{"URL", "IP-address", "Archive-date", "Content-type", "Archive-length"})
+
+	var reader RecordReader = f.GetReader()
+	records := []*WARCRecord{}
+	reader.Iterate(func(record *WARCRecord, err error) {
+		if err == nil {
+			records = append(records, record)
+		} else {
+			c.Assert(err, Equals, io.EOF)
+		}
+	})
+	c.Assert(len(records), Equals, 2)
+	record := records[0]
+	c.Assert(record.GetType(), Equals, "response")
+	c.Assert(record.GetUrl(), Equals, "http://www.dryswamp.edu:80/index.html")
+	c.Assert(record.GetIpAddress(), Equals, "127.10.100.2")
+	c.Assert(record.GetDate(), Equals, "1996-11-04T14:21:03Z")
+	v, _ := record.Get("Content-Type")
+	c.Assert(v, Equals, "application/http; msgtype=response")
+	v, _ = record.Get("WARC-Identified-Payload-Type")
+	c.Assert(v, Equals, "text/html")
+	message, err := record.GetHTTPMessage()
+	c.Assert(err, IsNil)
+	c.Assert(string(message.Body), Equals, "Hello world\n")
+
+	record = records[1]
+	c.Assert(record.GetUrl(), Equals, "dns:www.dryswamp.edu")
+	v, _ = record.Get("Content-Type")
+	c.Assert(v, Equals, "text/dns")
+	c.Assert(record.GetHeader().GetContentLength(), Equals, 41)
+}
+
+func (s *ARCSuite) TestReadUncompressed(c *C) {
+	data := getSampleArc(false)
+	s.checkRecords(c, data)
+	reader, err := NewARCReader(bytes.NewReader(data))
+	c.Assert(err, IsNil)
+	record, err := reader.ReadRecord()
+	c.Assert(err, IsNil)
+	c.Assert(record.Offset(), Equals, len(sampleArcRecords[0]))
+}
+
+func (s *ARCSuite) TestReadCompressed(c *C) {
+	data := getSampleArc(true)
+	s.checkRecords(c, data)
+	reader, err := NewARCReader(bytes.NewReader(data))
+	c.Assert(err, IsNil)
+	reader.ReadRecord()
+	record, err := reader.ReadRecord()
+	c.Assert(err, IsNil)
+	record, err = ReadRecordAt(bytes.NewReader(data), int64(record.Offset()))
+	c.Assert(err, NotNil) // ARC records can't be read as WARC records
+}
+
+func (s *ARCSuite) TestRecords(c *C) {
+	reader, err := NewARCReader(bytes.NewReader(getSampleArc(true)))
+	c.Assert(err, IsNil)
+	urls := []string{}
+	for record, err := range reader.Records() {
+		c.Assert(err, IsNil)
+		urls = append(urls, record.GetUrl())
+	}
+	c.Assert(urls, DeepEquals, []string{"http://www.dryswamp.edu:80/index.html", "dns:www.dryswamp.edu"})
+}
+
+func (s *ARCSuite) TestDates(c *C) {
+	date, err := ARCDateToWARCDate("19961104142103")
+	c.Assert(err, IsNil)
+	c.Assert(date, Equals, "1996-11-04T14:21:03Z")
+	date, err = ARCDateToWARCDate("199611")
+	c.Assert(err, IsNil)
+	c.Assert(date, Equals, "1996-11-01T00:00:00Z")
+	_, err = ARCDateToWARCDate("1996x")
+	c.Assert(err, NotNil)
+}
+
+func (s *ARCSuite) TestBadHeader(c *C) {
+	_, err := NewARCReader(bytes.NewReader([]byte("WARC/1.0\r\n")))
+	c.Assert(err, NotNil)
+}
+
+func (s *ARCSuite) TestTruncatedRecord(c *C) {
+	data := sampleArcRecords[0] +
+		"http://www.dryswamp.edu:80/index.html 127.10.100.2 19961104142103 text/html 100\n" +
+		"HTTP/1.0 200 OK\nHello\n"
+	reader, err := NewARCReader(bytes.NewReader([]byte(data)))
+	c.Assert(err, IsNil)
+	record, err := reader.ReadRecord()
+	c.Assert(record, IsNil)
+	c.Assert(err, ErrorMatches, "Truncated record at offset 138: 22 of 100 bytes")
+}
+
+func (s *ARCSuite) TestBadLengths(c *C) {
+	data := sampleArcRecords[0] + "http://www.dryswamp.edu:80/index.html 127.10.100.2 19961104142103 text/html -5\nHello\n"
+	reader, err := NewARCReader(bytes.NewReader([]byte(data)))
+	c.Assert(err, IsNil)
+	_, err = reader.ReadRecord()
+	c.Assert(err, ErrorMatches, "(?s)Bad ARC record line: .*")
+
+	header := "filedesc://IA-001102.arc 0.0.0.0 19960923142103 text/plain %v\n1 0 Alexa Internet\n"
+	_, err = NewARCReader(bytes.NewReader([]byte(fmt.Sprintf(header, -5))))
+	c.Assert(err, ErrorMatches, "(?s)Bad ARC file header: .*")
+	_, err = NewARCReader(bytes.NewReader([]byte(fmt.Sprintf(header, "9000000000000000000"))))
+	c.Assert(err, ErrorMatches, "Truncated ARC file header: 19 of 9000000000000000000 bytes")
+}
+
+func (s *ARCSuite) TestEOF(c *C) {
+	// ARC and WARC readers both end with io.EOF
+	arc, err := NewARCReader(bytes.NewReader(getSampleArc(true)))
+	c.Assert(err, IsNil)
+	wf, err := NewWARCFile(&ClosingBuffer{bytes.NewReader(getSampleWarcRecord(1))})
+	c.Assert(err, IsNil)
+	for _, reader := range []RecordReader{arc, wf.GetReader()} {
+		var err error
+		for err == nil {
+			_, err = reader.ReadRecord()
+		}
+		c.Assert(err, Equals, io.EOF)
+	}
+}
@@ -0,0 +1,226 @@
+package warc
+
+/*
+	Copyright (C) 2015  Wolfgang Meyers
+
+    This program is free software; you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation; either version 2 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License along
+    with this program; if not, write to the Free Software Foundation, Inc.,
+    51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+*/
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/wolfgangmeyers/go-warc/warc/utils"
+	"io"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Record types that are included in CDX indexes
+var CDX_RECORD_TYPES map[string]bool = map[string]bool{
+	"response": true,
+	"resource": true,
+	"revisit":  true,
+}
+
+var RE_WWW *regexp.Regexp = regexp.MustCompile("^www\\d*\\.")
+
+// A CDXEntry is a line of a CDXJ index, locating a record in a WARC file.
+type CDXEntry struct {
+	// The SURT form of the URL, by which the index is sorted
+	URLKey string `json:"-"`
+	// The date of the record as 14 digits, YYYYMMDDhhmmss
+	Timestamp string `json:"-"`
+	URL       string `json:"url"`
+	Mime      string `json:"mime,omitempty"`
+	Status    string `json:"status,omitempty"`
+	Digest    string `json:"digest,omitempty"`
+	// The length and offset of the record as stored, i.e. of its gzip member
+	Length   string `json:"length"`
+	Offset   string `json:"offset"`
+	Filename string `json:"filename"`
+}
+
+// Formats the entry as a CDXJ line, without the trailing newline.
+func (ce *CDXEntry) String() string {
+	fields, _ := json.Marshal(ce)
+	return ce.URLKey + " " + ce.Timestamp + " " + string(fields)
+}
+
+// Parses a CDXJ line.
+func ParseCDXEntry(line string) (*CDXEntry, error) {
+	parts := strings.SplitN(strings.TrimRight(line, "\r\n"), " ", 3)
+	if len(parts) != 3 {
+		return nil, errors.New(fmt.Sprintf("Bad CDXJ line: %v", line))
+	}
+	entry := &CDXEntry{URLKey: parts[0], Timestamp: parts[1]}
+	if err := json.Unmarshal([]byte(parts[2]), entry); err != nil {
+		return nil, errors.New(fmt.Sprintf("Bad CDXJ line: %v", line))
+	}
+	return entry, nil
+}
+
+// The offset and length of the record as integers.
+func (ce *CDXEntry) Location() (int64, int64, error) {
+	offset, err := strconv.ParseInt(ce.Offset, 10, 64)
+	if err != nil {
+		return 0, 0, errors.New(fmt.Sprintf("Bad offset: %v", ce.Offset))
+	}
+	length, err := strconv.ParseInt(ce.Length, 10, 64)
+	if err != nil {
+		return 0, 0, errors.New(fmt.Sprintf("Bad length: %v", ce.Length))
+	}
+	return offset, length, nil
+}
+
+// Converts a URL to the Sort-friendly URI Reordering Transform form used as
+// key of CDX indexes, e.g. "http://www.Example.com:80/b?y=1&x=2" becomes
+// "com,example)/b?x=2&y=1". URLs that cannot be parsed are only lowercased.
+func SURT(rawurl string) string {
+	u, err := url.Parse(rawurl)
+	if err != nil || u.Host == "" {
+		return strings.ToLower(rawurl)
+	}
+	host := strings.Trim(strings.ToLower(u.Hostname()), ".")
+	host = RE_WWW.ReplaceAllString(host, "")
+	parts := strings.Split(host, ".")
+	for i, j := 0, len(parts)-1; i < j; i, j = i+1, j-1 {
+		parts[i], parts[j] = parts[j], parts[i]
+	}
+	key := strings.Join(parts, ",")
+	if port := u.Port(); port != "" && !(port == "80" && u.Scheme == "http") && !(port == "443" && u.Scheme == "https") {
+		key += ":" + port
+	}
+	path := u.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	key += ")" + path
+	if u.RawQuery != "" {
+		args := strings.Split(u.RawQuery, "&")
+		sort.Strings(args)
+		key += "?" + strings.Join(args, "&")
+	}
+	return strings.ToLower(key)
+}
+
+// Converts a WARC-Date to a 14 digit CDX timestamp.
+func CDXTimestamp(date string) string {
+	digits := strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, date)
+	if len(digits) > 14 {
+		digits = digits[:14]
+	}
+	return digits
+}
+
+// Returns the HTTP status code of a record, if any, and the media type of
+// its payload, taken from the HTTP message of HTTP records.
+func httpMetadata(record *WARCRecord) (string, string) {
+	status := ""
+	contentType, _ := record.Get("Content-Type")
+	if strings.HasPrefix(contentType, "application/http") {
+		if message, err := record.GetHTTPMessage(); err == nil {
+			if code := message.StatusCode(); code != 0 {
+				status = strconv.Itoa(code)
+			}
+			contentType = message.Header.Get("Content-Type")
+		}
+	}
+	return status, strings.TrimSpace(strings.SplitN(contentType, ";", 2)[0])
+}
+
+// Creates the CDX entry of a record. Returns nil for records that are not indexed.
+func NewCDXEntry(record *WARCRecord, filename string) *CDXEntry {
+	if !CDX_RECORD_TYPES[record.GetType()] || record.GetUrl() == "" {
+		return nil
+	}
+	entry := &CDXEntry{
+		URLKey:    SURT(record.GetUrl()),
+		Timestamp: CDXTimestamp(record.GetDate()),
+		URL:       record.GetUrl(),
+		Digest:    record.GetChecksum(),
+		Offset:    strconv.Itoa(record.Offset()),
+		Filename:  filename,
+	}
+	entry.Status, entry.Mime = httpMetadata(record)
+	if record.GetType() == "revisit" {
+		entry.Mime = "warc/revisit"
+	}
+	if entry.Digest == "" && record.GetType() != "revisit" {
+		entry.Digest = ComputePayloadDigest(record)
+	}
+	return entry
+}
+
+// Indexes the response, resource and revisit records of a WARC file,
+// returning the entries sorted as in a CDXJ file. The lengths of the
+// entries are only meaningful for files compressed per record.
+func IndexWARC(reader io.Reader, filename string) ([]*CDXEntry, error) {
+	counter := utils.NewCountingReader(reader)
+	wf, err := NewWARCFile(io.NopCloser(counter))
+	if err != nil {
+		return nil, err
+	}
+	entries := []*CDXEntry{}
+	var last *CDXEntry
+	var lastOffset int64
+	setLength := func(end int64) {
+		if last != nil {
+			last.Length = strconv.FormatInt(end-lastOffset, 10)
+		}
+	}
+	for {
+		record, err := wf.ReadRecord()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		setLength(int64(record.Offset()))
+		last = NewCDXEntry(record, filename)
+		lastOffset = int64(record.Offset())
+		if last != nil {
+			entries = append(entries, last)
+		}
+	}
+	setLength(counter.Count())
+	SortCDXEntries(entries)
+	return entries, nil
+}
+
+// Sorts entries in the order of their CDXJ lines.
+func SortCDXEntries(entries []*CDXEntry) {
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].String() < entries[j].String()
+	})
+}
+
+// Writes entries as a CDXJ file.
+func WriteCDXJ(w io.Writer, entries []*CDXEntry) error {
+	for _, entry := range entries {
+		if _, err := io.WriteString(w, entry.String()+"\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
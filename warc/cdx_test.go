@@ -0,0 +1,86 @@
+package warc
+
+import (
+	"bytes"
+	. "gopkg.in/check.v1"
+)
+
+type CDXSuite struct{}
+
+var cdxSuite = Suite(&CDXSuite{})
+
+func (s *CDXSuite) TestSURT(c *C) {
+	c.Assert(SURT("http://www.Example.com:80/b?y=1&x=2#top"), Equals, "com,example)/b?x=2&y=1")
+	c.Assert(SURT("https://sub.example.com:8443/"), Equals, "com,example,sub:8443)/")
+	c.Assert(SURT("https://example.com"), Equals, "com,example)/")
+	c.Assert(SURT("dns:example.com"), Equals, "dns:example.com")
+}
+
+func (s *CDXSuite) TestTimestamp(c *C) {
+	c.Assert(CDXTimestamp("2000-01-02T03:04:05Z"), Equals, "20000102030405")
+	c.Assert(CDXTimestamp("2000-01-02T03:04:05.123456Z"), Equals, "20000102030405")
+}
+
+func (s *CDXSuite) TestParse(c *C) {
+	line := `com,example)/ 20000102030405 {"url":"http://example.com/","mime":"text/html","status":"200","digest":"sha1:AAAA","length":"100","offset":"0","filename":"a.warc.gz"}`
+	entry, err := ParseCDXEntry(line + "\n")
+	c.Assert(err, IsNil)
+	c.Assert(entry.URLKey, Equals, "com,example)/")
+	c.Assert(entry.Timestamp, Equals, "20000102030405")
+	c.Assert(entry.Filename, Equals, "a.warc.gz")
+	c.Assert(entry.String(), Equals, line)
+	offset, length, err := entry.Location()
+	c.Assert(err, IsNil)
+	c.Assert(offset, Equals, int64(0))
+	c.Assert(length, Equals, int64(100))
+
+	_, err = ParseCDXEntry("com,example)/ {}")
+	c.Assert(err, NotNil)
+}
+
+func (s *CDXSuite) TestIndexWARC(c *C) {
+	buf := bytes.Buffer{}
+	writer := NewWARCWriter(&buf, true)
+	writer.WriteRecord(NewWARCRecordFromBytes(map[string]string{
+		"WARC-Type":    "warcinfo",
+		"Content-Type": CONTENT_TYPES["warcinfo"],
+	}, []byte("software: go-warc\r\n")))
+	writer.WriteRecord(NewWARCRecordFromBytes(map[string]string{
+		"WARC-Target-URI": "http://example.com/b",
+		"WARC-Date":       "2000-01-02T03:04:05Z",
+		"Content-Type":    CONTENT_TYPES["response"],
+	}, []byte("HTTP/1.1 404 Not Found\r\nContent-Type: text/html; charset=utf-8\r\n\r\nNot found")))
+	writer.WriteRecord(NewWARCRecordFromBytes(map[string]string{
+		"WARC-Type":       "resource",
+		"WARC-Target-URI": "http://example.com/a",
+		"WARC-Date":       "2000-01-02T03:04:06Z",
+		"Content-Type":    "text/plain",
+	}, []byte("Helloworld")))
+
+	entries, err := IndexWARC(bytes.NewReader(buf.Bytes()), "sample.warc.gz")
+	c.Assert(err, IsNil)
+	c.Assert(len(entries), Equals, 2)
+	c.Assert(entries[0].URL, Equals, "http://example.com/a")
+	c.Assert(entries[0].Mime, Equals, "text/plain")
+	c.Assert(entries[0].Status, Equals, "")
+	c.Assert(entries[0].Digest, Equals, ComputeDigest([]byte("Helloworld")))
+	c.Assert(entries[1].Mime, Equals, "text/html")
+	c.Assert(entries[1].Status, Equals, "404")
+
+	total := int64(0)
+	for _, entry := range entries {
+		offset, length, err := entry.Location()
+		c.Assert(err, IsNil)
+		total += length
+		record, err := ReadRecordAt(bytes.NewReader(buf.Bytes()[:offset+length]), offset)
+		c.Assert(err, IsNil)
+		c.Assert(record.GetUrl(), Equals, entry.URL)
+	}
+	// everything but the warcinfo record
+	offset, _, _ := entries[1].Location()
+	c.Assert(total, Equals, int64(buf.Len())-offset)
+
+	out := bytes.Buffer{}
+	c.Assert(WriteCDXJ(&out, entries), IsNil)
+	c.Assert(out.String(), Matches, "com,example\\)/a 20000102030406 .*\ncom,example\\)/b 20000102030405 .*\n")
+}
@@ -0,0 +1,250 @@
+package warc
+
+/*
+	Copyright (C) 2015  Wolfgang Meyers
+
+    This program is free software; you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation; either version 2 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License along
+    with this program; if not, write to the Free Software Foundation, Inc.,
+    51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+*/
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"iter"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Extensions of the files that a Collection opens in directories
+var COLLECTION_EXTENSIONS []string = []string{".warc", ".warc.gz", ".warc.zst", ".arc", ".arc.gz"}
+
+// A Collection reads the records of several WARC and ARC files as one.
+type Collection struct {
+	Filenames []string
+}
+
+// A record read from a Collection, with the name of the file it was read from.
+type CollectionRecord struct {
+	*WARCRecord
+	Filename string
+}
+
+// The location of the record, for use with ReadRecordAt and RecordIndex.
+func (cr *CollectionRecord) Location() RecordLocation {
+	return RecordLocation{cr.Filename, int64(cr.Offset())}
+}
+
+func isCollectionFile(filename string) bool {
+	for _, extension := range COLLECTION_EXTENSIONS {
+		if strings.HasSuffix(filename, extension) {
+			return true
+		}
+	}
+	return false
+}
+
+func isARCFile(filename string) bool {
+	return strings.HasSuffix(filename, ".arc") || strings.HasSuffix(filename, ".arc.gz")
+}
+
+// Creates a Collection of the files matching each pattern. A pattern may be
+// a file, a directory, whose WARC and ARC files are added including those in
+// subdirectories, or a glob as understood by filepath.Glob. The files of
+// each pattern are added in the order of their names.
+func OpenCollection(patterns ...string) (*Collection, error) {
+	col := &Collection{}
+	for _, pattern := range patterns {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, err
+		}
+		if len(matches) == 0 {
+			return nil, errors.New(fmt.Sprintf("No files found for %v", pattern))
+		}
+		for _, match := range matches {
+			info, err := os.Stat(match)
+			if err != nil {
+				return nil, err
+			}
+			if !info.IsDir() {
+				col.Filenames = append(col.Filenames, match)
+				continue
+			}
+			filenames := []string{}
+			err = filepath.WalkDir(match, func(path string, entry fs.DirEntry, err error) error {
+				if err == nil && !entry.IsDir() && isCollectionFile(path) {
+					filenames = append(filenames, path)
+				}
+				return err
+			})
+			if err != nil {
+				return nil, err
+			}
+			sort.Strings(filenames)
+			col.Filenames = append(col.Filenames, filenames...)
+		}
+	}
+	return col, nil
+}
+
+// Indexes the WARC files of the collection, with the file names as given.
+// ARC files are left out, as their records cannot be read with ReadRecordAt.
+func (col *Collection) Index() ([]*CDXEntry, error) {
+	entries := []*CDXEntry{}
+	for _, filename := range col.Filenames {
+		if isARCFile(filename) {
+			continue
+		}
+		f, err := os.Open(filename)
+		if err != nil {
+			return nil, err
+		}
+		fileEntries, err := IndexWARC(f, filename)
+		f.Close()
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("%v: %v", filename, err))
+		}
+		entries = append(entries, fileEntries...)
+	}
+	SortCDXEntries(entries)
+	return entries, nil
+}
+
+// Returns an iterator over the records of all files, one file after the other.
+// Each file is closed once its records were read, or the loop was left.
+func (col *Collection) Records() iter.Seq2[*CollectionRecord, error] {
+	return col.RecordsContext(context.Background())
+}
+
+// Like Records, but yields ctx.Err() and stops as soon as ctx is done.
+func (col *Collection) RecordsContext(ctx context.Context) iter.Seq2[*CollectionRecord, error] {
+	return func(yield func(*CollectionRecord, error) bool) {
+		for _, filename := range col.Filenames {
+			if !readCollectionFile(ctx, filename, yield) {
+				return
+			}
+		}
+	}
+}
+
+// Returns an iterator over the records of all files, reading up to workers
+// files at the same time, or as many as there are CPUs if workers is 0.
+// The records of each file are yielded in order, but the files are
+// interleaved. The first error ends the iteration.
+func (col *Collection) ParallelRecords(ctx context.Context, workers int) iter.Seq2[*CollectionRecord, error] {
+	return func(yield func(*CollectionRecord, error) bool) {
+		if workers <= 0 {
+			workers = runtime.NumCPU()
+		}
+		ctx, cancel := context.WithCancel(ctx)
+		filenames := make(chan string, len(col.Filenames))
+		for _, filename := range col.Filenames {
+			filenames <- filename
+		}
+		close(filenames)
+		type result struct {
+			record *CollectionRecord
+			err    error
+		}
+		results := make(chan result, workers)
+		send := func(record *CollectionRecord, err error) bool {
+			select {
+			case results <- result{record, err}:
+				return err == nil
+			case <-ctx.Done():
+				return false
+			}
+		}
+		wg := sync.WaitGroup{}
+		for i := 0; i < workers; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for filename := range filenames {
+					if !readCollectionFile(ctx, filename, send) {
+						return
+					}
+				}
+			}()
+		}
+		go func() {
+			wg.Wait()
+			close(results)
+		}()
+		defer func() {
+			cancel()
+			for range results {
+			}
+		}()
+		for result := range results {
+			if !yield(result.record, result.err) || result.err != nil {
+				return
+			}
+		}
+		if err := ctx.Err(); err != nil {
+			yield(nil, err)
+		}
+	}
+}
+
+// Passes the records of a WARC or ARC file to yield, closing the file
+// afterwards. Returns false if yield does, or after an error.
+func readCollectionFile(ctx context.Context, filename string, yield func(*CollectionRecord, error) bool) bool {
+	fail := func(err error) bool {
+		if err != ctx.Err() {
+			err = errors.New(fmt.Sprintf("%v: %v", filename, err))
+		}
+		yield(nil, err)
+		return false
+	}
+	if err := ctx.Err(); err != nil {
+		return fail(err)
+	}
+	f, err := os.Open(filename)
+	if err != nil {
+		return fail(err)
+	}
+	defer f.Close()
+	var records iter.Seq2[*WARCRecord, error]
+	if isARCFile(filename) {
+		af, err := NewARCFile(f)
+		if err != nil {
+			return fail(err)
+		}
+		records = af.GetReader().Records()
+	} else {
+		wf, err := NewWARCFile(f)
+		if err != nil {
+			return fail(err)
+		}
+		records = wf.RecordsContext(ctx)
+	}
+	for record, err := range records {
+		if err == nil {
+			err = ctx.Err()
+		}
+		if err != nil {
+			return fail(err)
+		}
+		if !yield(&CollectionRecord{record, filename}, nil) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,145 @@
+package warc
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	. "gopkg.in/check.v1"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+type CollectionSuite struct {
+	dir string
+}
+
+var collectionSuite = Suite(&CollectionSuite{})
+
+func (s *CollectionSuite) SetUpTest(c *C) {
+	s.dir = c.MkDir()
+	write := func(name string, data []byte) {
+		path := filepath.Join(s.dir, name)
+		c.Assert(os.MkdirAll(filepath.Dir(path), 0755), IsNil)
+		c.Assert(os.WriteFile(path, data, 0644), IsNil)
+	}
+	records := func(name string, count int) []*WARCRecord {
+		records := []*WARCRecord{}
+		for i := 0; i < count; i++ {
+			records = append(records, NewWARCRecordFromBytes(map[string]string{
+				"WARC-Type":       "resource",
+				"WARC-Target-URI": fmt.Sprintf("http://example.com/%v/%v", name, i),
+			}, []byte("Helloworld")))
+		}
+		return records
+	}
+	gz, plain := bytes.Buffer{}, bytes.Buffer{}
+	writeParallelFile(c, NewWARCWriter(&gz, true), records("a", 3))
+	writeParallelFile(c, NewWARCWriter(&plain, false), records("b", 2))
+	zst, _ := writeZstdFile(c, nil, records("c", 2))
+	write("a.warc.gz", gz.Bytes())
+	write("b.warc", plain.Bytes())
+	write("sub/c.warc.zst", zst)
+	write("d.arc.gz", getSampleArc(true))
+	write("notes.txt", []byte("not a WARC file"))
+}
+
+// Returns the file name and URL of each record.
+func collectionRecords(c *C, records func(func(*CollectionRecord, error) bool)) []string {
+	result := []string{}
+	for record, err := range records {
+		c.Assert(err, IsNil)
+		result = append(result, filepath.Base(record.Filename)+" "+record.GetUrl())
+	}
+	return result
+}
+
+func (s *CollectionSuite) TestDirectory(c *C) {
+	col, err := OpenCollection(s.dir)
+	c.Assert(err, IsNil)
+	c.Assert(col.Filenames, DeepEquals, []string{
+		filepath.Join(s.dir, "a.warc.gz"),
+		filepath.Join(s.dir, "b.warc"),
+		filepath.Join(s.dir, "d.arc.gz"),
+		filepath.Join(s.dir, "sub/c.warc.zst"),
+	})
+	expected := []string{
+		"a.warc.gz http://example.com/a/0",
+		"a.warc.gz http://example.com/a/1",
+		"a.warc.gz http://example.com/a/2",
+		"b.warc http://example.com/b/0",
+		"b.warc http://example.com/b/1",
+		"d.arc.gz http://www.dryswamp.edu:80/index.html",
+		"d.arc.gz dns:www.dryswamp.edu",
+		"c.warc.zst http://example.com/c/0",
+		"c.warc.zst http://example.com/c/1",
+	}
+	c.Assert(collectionRecords(c, col.Records()), DeepEquals, expected)
+
+	parallel := collectionRecords(c, col.ParallelRecords(context.Background(), 3))
+	sort.Strings(parallel)
+	sort.Strings(expected)
+	c.Assert(parallel, DeepEquals, expected)
+}
+
+func (s *CollectionSuite) TestLocation(c *C) {
+	col, err := OpenCollection(filepath.Join(s.dir, "*.warc*"))
+	c.Assert(err, IsNil)
+	c.Assert(col.Filenames, HasLen, 2)
+	for record, err := range col.Records() {
+		c.Assert(err, IsNil)
+		location := record.Location()
+		f, err := os.Open(location.Filename)
+		c.Assert(err, IsNil)
+		found, err := ReadRecordAt(f, location.Offset)
+		f.Close()
+		c.Assert(err, IsNil)
+		c.Assert(found.GetUrl(), Equals, record.GetUrl())
+	}
+}
+
+func (s *CollectionSuite) TestErrors(c *C) {
+	_, err := OpenCollection(filepath.Join(s.dir, "*.cdx"))
+	c.Assert(err, ErrorMatches, "No files found for .*")
+
+	c.Assert(os.WriteFile(filepath.Join(s.dir, "broken.warc"), []byte("WARC/1.0\r\nContent-Length: 100\r\n\r\nHello"), 0644), IsNil)
+	col, err := OpenCollection(filepath.Join(s.dir, "a.warc.gz"), filepath.Join(s.dir, "broken.warc"), filepath.Join(s.dir, "b.warc"))
+	c.Assert(err, IsNil)
+	count := 0
+	var lastErr error
+	for _, err := range col.Records() {
+		if err != nil {
+			lastErr = err
+		} else {
+			count++
+		}
+	}
+	c.Assert(count, Equals, 3)
+	c.Assert(lastErr, ErrorMatches, ".*broken.warc: Truncated record at offset 0: 5 of 100 bytes")
+}
+
+func (s *CollectionSuite) TestCancel(c *C) {
+	col, err := OpenCollection(s.dir)
+	c.Assert(err, IsNil)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	errors := []error{}
+	count := 0
+	for _, err := range col.ParallelRecords(ctx, 2) {
+		if err != nil {
+			errors = append(errors, err)
+			continue
+		}
+		count++
+		cancel()
+	}
+	c.Assert(count >= 1, Equals, true)
+	c.Assert(errors, DeepEquals, []error{context.Canceled})
+
+	count = 0
+	for range col.Records() {
+		count++
+		break
+	}
+	c.Assert(count, Equals, 1)
+}
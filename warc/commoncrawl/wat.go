@@ -0,0 +1,461 @@
+// Package commoncrawl derives WAT metadata files and WET plain text files
+// from WARC files, in the formats published by Common Crawl.
+package commoncrawl
+
+/*
+	Copyright (C) 2015  Wolfgang Meyers
+
+    This program is free software; you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation; either version 2 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License along
+    with this program; if not, write to the Free Software Foundation, Inc.,
+    51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+*/
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"github.com/wolfgangmeyers/go-warc/warc"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/charset"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The attribute holding the URL of each element that links to another
+// resource, as listed in the Links of the HTML metadata
+var LINK_ATTRIBUTES map[string]string = map[string]string{
+	"a":      "href",
+	"area":   "href",
+	"link":   "href",
+	"base":   "href",
+	"form":   "action",
+	"img":    "src",
+	"iframe": "src",
+	"frame":  "src",
+	"script": "src",
+	"embed":  "src",
+	"source": "src",
+	"video":  "src",
+	"audio":  "src",
+	"track":  "src",
+	"object": "data",
+}
+
+// Options for ConvertWAT and ConvertWET
+type ConversionOptions struct {
+	// The name of the WARC file that is converted, written to the
+	// warcinfo record and the Container of each WAT record
+	Filename string
+}
+
+type ConversionResult struct {
+	// The number of records read from the WARC file
+	Records int
+	// The number of records written, including the warcinfo record
+	Written int
+}
+
+// The JSON envelope held by a WAT record
+type WAT struct {
+	Container *Container `json:"Container"`
+	Envelope  *Envelope  `json:"Envelope"`
+}
+
+// The location of the record in the WARC file
+type Container struct {
+	Filename   string `json:"Filename"`
+	Compressed bool   `json:"Compressed"`
+	Offset     string `json:"Offset"`
+}
+
+type Envelope struct {
+	Format              string            `json:"Format"`
+	WARCHeaderLength    string            `json:"WARC-Header-Length"`
+	BlockDigest         string            `json:"Block-Digest,omitempty"`
+	ActualContentLength string            `json:"Actual-Content-Length"`
+	WARCHeaderMetadata  map[string]string `json:"WARC-Header-Metadata"`
+	PayloadMetadata     *PayloadMetadata  `json:"Payload-Metadata"`
+}
+
+type PayloadMetadata struct {
+	ActualContentType    string                `json:"Actual-Content-Type"`
+	WARCInfoMetadata     map[string]string     `json:"WARC-Info-Metadata,omitempty"`
+	WARCMetadataMetadata *WARCMetadataMetadata `json:"WARC-Metadata-Metadata,omitempty"`
+	HTTPRequestMetadata  *HTTPRequestMetadata  `json:"HTTP-Request-Metadata,omitempty"`
+	HTTPResponseMetadata *HTTPResponseMetadata `json:"HTTP-Response-Metadata,omitempty"`
+}
+
+// The fields of a metadata record
+type WARCMetadataMetadata struct {
+	MetadataRecords []*NameValue `json:"Metadata-Records"`
+}
+
+type NameValue struct {
+	Name  string `json:"Name"`
+	Value string `json:"Value"`
+}
+
+type HTTPRequestMetadata struct {
+	RequestMessage *RequestMessage   `json:"Request-Message"`
+	Headers        map[string]string `json:"Headers"`
+	HeadersLength  string            `json:"Headers-Length"`
+	EntityLength   string            `json:"Entity-Length"`
+}
+
+type RequestMessage struct {
+	Method  string `json:"Method"`
+	Path    string `json:"Path"`
+	Version string `json:"Version"`
+}
+
+type HTTPResponseMetadata struct {
+	ResponseMessage *ResponseMessage  `json:"Response-Message"`
+	Headers         map[string]string `json:"Headers"`
+	HeadersLength   string            `json:"Headers-Length"`
+	EntityLength    string            `json:"Entity-Length"`
+	EntityDigest    string            `json:"Entity-Digest,omitempty"`
+	HTMLMetadata    *HTMLMetadata     `json:"HTML-Metadata,omitempty"`
+}
+
+type ResponseMessage struct {
+	Version string `json:"Version"`
+	Status  string `json:"Status"`
+	Reason  string `json:"Reason"`
+}
+
+// The title, meta tags and links of an HTML page
+type HTMLMetadata struct {
+	Head  *HTMLHead   `json:"Head"`
+	Links []*HTMLLink `json:"Links,omitempty"`
+}
+
+type HTMLHead struct {
+	Title string `json:"Title,omitempty"`
+	// The attributes of each meta tag
+	Metas   []map[string]string `json:"Metas,omitempty"`
+	Link    []*HTMLLink         `json:"Link,omitempty"`
+	Scripts []*HTMLLink         `json:"Scripts,omitempty"`
+	Base    string              `json:"Base,omitempty"`
+}
+
+// A link of an HTML page. Path is the element and attribute holding
+// the URL, e.g. "A@/href", and URL is the attribute value as found.
+type HTMLLink struct {
+	Path   string `json:"path"`
+	URL    string `json:"url"`
+	Text   string `json:"text,omitempty"`
+	Title  string `json:"title,omitempty"`
+	Alt    string `json:"alt,omitempty"`
+	Rel    string `json:"rel,omitempty"`
+	Type   string `json:"type,omitempty"`
+	Target string `json:"target,omitempty"`
+}
+
+// Whether data starts with the magic number of a gzip member or zstd frame.
+func isCompressed(reader *bufio.Reader) bool {
+	magic, _ := reader.Peek(4)
+	return bytes.HasPrefix(magic, []byte{0x1f, 0x8b}) || bytes.Equal(magic, []byte{0x28, 0xb5, 0x2f, 0xfd})
+}
+
+// Writes a warcinfo record for a WAT or WET file derived from filename.
+func writeWarcinfo(writer *warc.WARCWriter, filename string, description string) (string, error) {
+	fields := []string{
+		"software: " + warc.SOFTWARE,
+		"format: " + warc.WARC_FORMATS["1.0"],
+		"conformsTo: " + warc.WARC_SPECIFICATIONS["1.0"],
+		"description: " + description,
+	}
+	if filename != "" {
+		fields = append(fields, "isPartOf: "+filename)
+	}
+	warcinfoId := warc.NewRecordId()
+	warcinfo := warc.NewWARCRecordFromBytes(map[string]string{
+		"WARC-Type":      "warcinfo",
+		"WARC-Record-ID": warcinfoId,
+		"WARC-Date":      warc.FormatDate(time.Now()),
+		"Content-Type":   warc.CONTENT_TYPES["warcinfo"],
+	}, []byte(strings.Join(fields, "\r\n")+"\r\n"))
+	_, err := writer.WriteRecord(warcinfo)
+	return warcinfoId, err
+}
+
+// Converts a WARC file to a WAT file, written to writer. The WAT file
+// starts with a warcinfo record, followed by a metadata record for each
+// record of the WARC file holding its WAT envelope as JSON.
+func ConvertWAT(in io.Reader, writer *warc.WARCWriter, options ConversionOptions) (*ConversionResult, error) {
+	buffered := bufio.NewReader(in)
+	compressed := isCompressed(buffered)
+	wf, err := warc.NewWARCFile(io.NopCloser(buffered))
+	if err != nil {
+		return nil, err
+	}
+	warcinfoId, err := writeWarcinfo(writer, options.Filename, "WAT metadata of "+options.Filename)
+	if err != nil {
+		return nil, err
+	}
+	result := &ConversionResult{Written: 1}
+	for record, err := range wf.Records() {
+		if err != nil {
+			return nil, err
+		}
+		result.Records++
+		wat, err := NewWATRecord(record, &Container{
+			Filename:   options.Filename,
+			Compressed: compressed,
+			Offset:     strconv.Itoa(record.Offset()),
+		})
+		if err != nil {
+			return nil, err
+		}
+		wat.Set("WARC-Warcinfo-ID", warcinfoId)
+		if _, err := writer.WriteRecord(wat); err != nil {
+			return nil, err
+		}
+		result.Written++
+	}
+	return result, nil
+}
+
+// Creates the WAT record of a WARC record: a metadata record referring
+// to it, holding its WAT envelope as JSON.
+func NewWATRecord(record *warc.WARCRecord, container *Container) (*warc.WARCRecord, error) {
+	data, err := json.Marshal(&WAT{Container: container, Envelope: NewEnvelope(record)})
+	if err != nil {
+		return nil, err
+	}
+	headers := map[string]string{
+		"WARC-Type":      "metadata",
+		"WARC-Date":      record.GetDate(),
+		"WARC-Refers-To": record.GetHeader().GetRecordId(),
+		"Content-Type":   "application/json",
+	}
+	if uri := record.GetUrl(); uri != "" {
+		headers["WARC-Target-URI"] = uri
+	} else if filename, exists := record.Get("WARC-Filename"); exists {
+		headers["WARC-Target-URI"] = filename
+	}
+	return warc.NewWARCRecordFromBytes(headers, data), nil
+}
+
+// Describes the WARC header and payload of a record.
+func NewEnvelope(record *warc.WARCRecord) *Envelope {
+	block := []byte{}
+	if record.GetPayload() != nil {
+		block = record.GetPayload().GetData()
+	}
+	header := bytes.Buffer{}
+	record.GetHeader().WriteTo(&header)
+	envelope := &Envelope{
+		Format:              "WARC",
+		WARCHeaderLength:    strconv.Itoa(header.Len()),
+		ActualContentLength: strconv.Itoa(len(block)),
+		WARCHeaderMetadata:  map[string]string{},
+		PayloadMetadata:     &PayloadMetadata{},
+	}
+	// the header as written has the canonical names of the fields
+	for _, line := range strings.Split(header.String(), "\r\n")[1:] {
+		if name, value, found := strings.Cut(line, ": "); found {
+			envelope.WARCHeaderMetadata[name] = value
+		}
+	}
+	envelope.BlockDigest, _ = record.Get("WARC-Block-Digest")
+	if envelope.BlockDigest == "" {
+		envelope.BlockDigest = warc.ComputeDigest(block)
+	}
+
+	payload := envelope.PayloadMetadata
+	payload.ActualContentType, _ = record.Get("Content-Type")
+	switch record.GetType() {
+	case "warcinfo":
+		payload.WARCInfoMetadata = warc.ParseWARCFields(block)
+	case "metadata":
+		if strings.HasPrefix(payload.ActualContentType, "application/warc-fields") {
+			payload.WARCMetadataMetadata = &WARCMetadataMetadata{MetadataRecords: []*NameValue{}}
+			for _, line := range strings.Split(string(block), "\n") {
+				name, value, found := strings.Cut(strings.TrimRight(line, "\r"), ":")
+				if found {
+					payload.WARCMetadataMetadata.MetadataRecords = append(payload.WARCMetadataMetadata.MetadataRecords,
+						&NameValue{Name: strings.TrimSpace(name), Value: strings.TrimSpace(value)})
+				}
+			}
+		}
+	case "request":
+		if message, err := warc.ParseHTTPMessage(block); err == nil {
+			fields := strings.Fields(message.StartLine)
+			for len(fields) < 3 {
+				fields = append(fields, "")
+			}
+			payload.HTTPRequestMetadata = &HTTPRequestMetadata{
+				RequestMessage: &RequestMessage{Method: fields[0], Path: fields[1], Version: fields[2]},
+				Headers:        watHeaders(message.Header),
+				HeadersLength:  strconv.Itoa(len(message.HeaderBytes())),
+				EntityLength:   strconv.Itoa(len(message.Body)),
+			}
+		}
+	case "response", "revisit":
+		if message, err := warc.ParseHTTPMessage(block); err == nil {
+			fields := strings.SplitN(message.StartLine, " ", 3)
+			for len(fields) < 3 {
+				fields = append(fields, "")
+			}
+			metadata := &HTTPResponseMetadata{
+				ResponseMessage: &ResponseMessage{Version: fields[0], Status: fields[1], Reason: fields[2]},
+				Headers:         watHeaders(message.Header),
+				HeadersLength:   strconv.Itoa(len(message.HeaderBytes())),
+				EntityLength:    strconv.Itoa(len(message.Body)),
+			}
+			if record.GetType() == "response" {
+				metadata.EntityDigest = warc.ComputeDigest(message.Body)
+				contentType := message.Header.Get("Content-Type")
+				if body, err := message.DecodedBody(); err == nil && isHTML(contentType, body) {
+					metadata.HTMLMetadata = ParseHTMLMetadata(decodeHTML(body, contentType))
+				}
+			}
+			payload.HTTPResponseMetadata = metadata
+		}
+	}
+	return envelope
+}
+
+// The headers of an HTTP message, with repeated headers joined by commas.
+func watHeaders(header http.Header) map[string]string {
+	headers := map[string]string{}
+	for name, values := range header {
+		headers[name] = strings.Join(values, ", ")
+	}
+	return headers
+}
+
+// Whether a payload is HTML, by its Content-Type or else by its content.
+func isHTML(contentType string, body []byte) bool {
+	if contentType == "" {
+		contentType = http.DetectContentType(body)
+	}
+	contentType = strings.ToLower(contentType)
+	return strings.Contains(contentType, "text/html") || strings.Contains(contentType, "application/xhtml")
+}
+
+// Converts an HTML page to UTF-8, using the charset of the Content-Type
+// header, a byte order mark or a meta tag, or else guessing it.
+func decodeHTML(body []byte, contentType string) []byte {
+	reader, err := charset.NewReader(bytes.NewReader(body), contentType)
+	if err != nil {
+		return body
+	}
+	decoded, err := io.ReadAll(reader)
+	if err != nil {
+		return body
+	}
+	return decoded
+}
+
+// Extracts the title, meta tags and links of a UTF-8 encoded HTML page.
+func ParseHTMLMetadata(body []byte) *HTMLMetadata {
+	metadata := &HTMLMetadata{Head: &HTMLHead{}}
+	document, err := html.Parse(bytes.NewReader(body))
+	if err != nil {
+		return metadata
+	}
+	var walk func(node *html.Node, inHead bool)
+	walk = func(node *html.Node, inHead bool) {
+		if node.Type == html.ElementNode {
+			switch node.Data {
+			case "head":
+				inHead = true
+			case "title":
+				if metadata.Head.Title == "" {
+					metadata.Head.Title = nodeText(node)
+				}
+			case "meta":
+				attributes := map[string]string{}
+				for _, attribute := range node.Attr {
+					attributes[attribute.Key] = attribute.Val
+				}
+				if len(attributes) > 0 {
+					metadata.Head.Metas = append(metadata.Head.Metas, attributes)
+				}
+			case "base":
+				if href := attributeValue(node, "href"); href != "" && metadata.Head.Base == "" {
+					metadata.Head.Base = href
+				}
+			}
+			if link := newHTMLLink(node); link != nil {
+				switch {
+				case node.Data == "link":
+					metadata.Head.Link = append(metadata.Head.Link, link)
+				case node.Data == "script" && inHead:
+					metadata.Head.Scripts = append(metadata.Head.Scripts, link)
+				case node.Data != "base":
+					metadata.Links = append(metadata.Links, link)
+				}
+			}
+		}
+		for child := node.FirstChild; child != nil; child = child.NextSibling {
+			walk(child, inHead)
+		}
+	}
+	walk(document, false)
+	return metadata
+}
+
+func newHTMLLink(node *html.Node) *HTMLLink {
+	attribute, exists := LINK_ATTRIBUTES[node.Data]
+	if !exists {
+		return nil
+	}
+	uri := strings.TrimSpace(attributeValue(node, attribute))
+	if uri == "" {
+		return nil
+	}
+	link := &HTMLLink{
+		Path:   strings.ToUpper(node.Data) + "@/" + attribute,
+		URL:    uri,
+		Title:  attributeValue(node, "title"),
+		Alt:    attributeValue(node, "alt"),
+		Rel:    attributeValue(node, "rel"),
+		Type:   attributeValue(node, "type"),
+		Target: attributeValue(node, "target"),
+	}
+	if node.Data == "a" {
+		link.Text = nodeText(node)
+	}
+	return link
+}
+
+func attributeValue(node *html.Node, name string) string {
+	for _, attribute := range node.Attr {
+		if attribute.Key == name {
+			return attribute.Val
+		}
+	}
+	return ""
+}
+
+// The text inside a node, with runs of white space collapsed.
+func nodeText(node *html.Node) string {
+	text := strings.Builder{}
+	var collect func(node *html.Node)
+	collect = func(node *html.Node) {
+		if node.Type == html.TextNode {
+			text.WriteString(node.Data)
+			text.WriteString(" ")
+		}
+		for child := node.FirstChild; child != nil; child = child.NextSibling {
+			collect(child)
+		}
+	}
+	collect(node)
+	return strings.Join(strings.Fields(text.String()), " ")
+}
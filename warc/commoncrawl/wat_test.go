@@ -0,0 +1,204 @@
+package commoncrawl
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/wolfgangmeyers/go-warc/warc"
+	. "gopkg.in/check.v1"
+	"strconv"
+	"testing"
+)
+
+func Test(t *testing.T) {
+	TestingT(t)
+}
+
+type WATSuite struct{}
+
+var watSuite = Suite(&WATSuite{})
+
+var SAMPLE_HTML string = `<!DOCTYPE html>
+<html>
+<head>
+  <title>An  example
+  page</title>
+  <meta charset="utf-8">
+  <meta name="description" content="A page for testing">
+  <meta property="og:title" content="Example">
+  <base href="http://example.com/">
+  <link rel="stylesheet" type="text/css" href="/style.css">
+  <script src="/app.js"></script>
+  <style>p { color: red }</style>
+</head>
+<body>
+  <h1>Hello</h1>
+  <p>Some <b>text</b> with a <a href="/about" title="About us">link to
+  the about page</a>.</p>
+  <script>var hidden = "not text";</script>
+  <img src="/logo.png" alt="Logo">
+  <form action="/search"><input name="q"></form>
+  <a name="anchor">no href</a>
+</body>
+</html>
+`
+
+// Builds a WARC file with a warcinfo, request, response and metadata record.
+func sampleWarc(c *C, compress bool, html string) []byte {
+	out := bytes.Buffer{}
+	writer := warc.NewWARCWriter(&out, compress)
+	records := []*warc.WARCRecord{
+		warc.NewWARCRecordFromBytes(map[string]string{
+			"WARC-Type":     "warcinfo",
+			"WARC-Date":     "2024-03-01T10:00:00Z",
+			"WARC-Filename": "sample.warc.gz",
+			"Content-Type":  "application/warc-fields",
+		}, []byte("software: test\r\nformat: WARC File Format 1.0\r\n")),
+		warc.NewWARCRecordFromBytes(map[string]string{
+			"WARC-Type":       "request",
+			"WARC-Date":       "2024-03-01T10:00:01Z",
+			"WARC-Target-URI": "http://example.com/",
+			"Content-Type":    "application/http; msgtype=request",
+		}, []byte("GET / HTTP/1.1\r\nHost: example.com\r\n\r\n")),
+		warc.NewWARCRecordFromBytes(map[string]string{
+			"WARC-Type":       "response",
+			"WARC-Date":       "2024-03-01T10:00:01Z",
+			"WARC-Target-URI": "http://example.com/",
+			"WARC-IP-Address": "93.184.216.34",
+			"Content-Type":    "application/http; msgtype=response",
+		}, []byte("HTTP/1.1 200 OK\r\nContent-Type: text/html\r\nSet-Cookie: a=1\r\nSet-Cookie: b=2\r\n\r\n"+html)),
+		warc.NewWARCRecordFromBytes(map[string]string{
+			"WARC-Type":       "metadata",
+			"WARC-Date":       "2024-03-01T10:00:01Z",
+			"WARC-Target-URI": "http://example.com/",
+			"Content-Type":    "application/warc-fields",
+		}, []byte("fetchTimeMs: 120\r\noutlink: http://example.com/about\r\n")),
+	}
+	for _, record := range records {
+		_, err := writer.WriteRecord(record)
+		c.Assert(err, IsNil)
+	}
+	return out.Bytes()
+}
+
+// Reads all records of a WARC file.
+func readRecords(c *C, data []byte) []*warc.WARCRecord {
+	wf, err := warc.NewWARCFile(&closingReader{bytes.NewReader(data)})
+	c.Assert(err, IsNil)
+	records := []*warc.WARCRecord{}
+	for record, err := range wf.Records() {
+		c.Assert(err, IsNil)
+		records = append(records, record)
+	}
+	return records
+}
+
+type closingReader struct {
+	*bytes.Reader
+}
+
+func (cr *closingReader) Close() error {
+	return nil
+}
+
+func (s *WATSuite) TestConvert(c *C) {
+	source := sampleWarc(c, true, SAMPLE_HTML)
+	sourceRecords := readRecords(c, source)
+	out := bytes.Buffer{}
+	result, err := ConvertWAT(bytes.NewReader(source), warc.NewWARCWriter(&out, true), ConversionOptions{Filename: "sample.warc.gz"})
+	c.Assert(err, IsNil)
+	c.Assert(*result, Equals, ConversionResult{Records: 4, Written: 5})
+
+	records := readRecords(c, out.Bytes())
+	c.Assert(records, HasLen, 5)
+	fields := warc.ParseWARCFields(records[0].GetPayload().GetData())
+	c.Assert(fields["isPartOf"], Equals, "sample.warc.gz")
+
+	wats := []*WAT{}
+	for i, record := range records[1:] {
+		c.Assert(record.GetType(), Equals, "metadata")
+		contentType, _ := record.Get("Content-Type")
+		c.Assert(contentType, Equals, "application/json")
+		refersTo, _ := record.Get("WARC-Refers-To")
+		c.Assert(refersTo, Equals, sourceRecords[i].GetHeader().GetRecordId())
+		c.Assert(record.GetDate(), Equals, sourceRecords[i].GetDate())
+		wat := &WAT{}
+		c.Assert(json.Unmarshal(record.GetPayload().GetData(), wat), IsNil)
+		c.Assert(wat.Container.Filename, Equals, "sample.warc.gz")
+		c.Assert(wat.Container.Compressed, Equals, true)
+		wats = append(wats, wat)
+	}
+	c.Assert(records[1].GetUrl(), Equals, "sample.warc.gz")
+	c.Assert(wats[0].Container.Offset, Equals, "0")
+	c.Assert(wats[0].Envelope.PayloadMetadata.WARCInfoMetadata["software"], Equals, "test")
+
+	request := wats[1].Envelope.PayloadMetadata.HTTPRequestMetadata
+	c.Assert(*request.RequestMessage, Equals, RequestMessage{Method: "GET", Path: "/", Version: "HTTP/1.1"})
+	c.Assert(request.Headers["Host"], Equals, "example.com")
+
+	envelope := wats[2].Envelope
+	c.Assert(wats[2].Container.Offset, Equals, strconv.Itoa(sourceRecords[2].Offset()))
+	c.Assert(envelope.WARCHeaderMetadata["WARC-IP-Address"], Equals, "93.184.216.34")
+	c.Assert(envelope.WARCHeaderMetadata["WARC-Type"], Equals, "response")
+	c.Assert(envelope.ActualContentLength, Equals, strconv.Itoa(sourceRecords[2].GetHeader().GetContentLength()))
+	blockDigest, _ := sourceRecords[2].Get("WARC-Block-Digest")
+	c.Assert(envelope.BlockDigest, Equals, blockDigest)
+	response := envelope.PayloadMetadata.HTTPResponseMetadata
+	c.Assert(*response.ResponseMessage, Equals, ResponseMessage{Version: "HTTP/1.1", Status: "200", Reason: "OK"})
+	c.Assert(response.Headers["Set-Cookie"], Equals, "a=1, b=2")
+	c.Assert(response.EntityLength, Equals, strconv.Itoa(len(SAMPLE_HTML)))
+	c.Assert(response.EntityDigest, Equals, warc.ComputeDigest([]byte(SAMPLE_HTML)))
+	c.Assert(response.HTMLMetadata, NotNil)
+	c.Assert(response.HTMLMetadata.Head.Title, Equals, "An example page")
+
+	metadata := wats[3].Envelope.PayloadMetadata.WARCMetadataMetadata
+	c.Assert(metadata.MetadataRecords, DeepEquals, []*NameValue{
+		{Name: "fetchTimeMs", Value: "120"}, {Name: "outlink", Value: "http://example.com/about"}})
+}
+
+func (s *WATSuite) TestHTMLMetadata(c *C) {
+	metadata := ParseHTMLMetadata([]byte(SAMPLE_HTML))
+	c.Assert(metadata.Head.Title, Equals, "An example page")
+	c.Assert(metadata.Head.Base, Equals, "http://example.com/")
+	c.Assert(metadata.Head.Metas, DeepEquals, []map[string]string{
+		{"charset": "utf-8"},
+		{"name": "description", "content": "A page for testing"},
+		{"property": "og:title", "content": "Example"},
+	})
+	c.Assert(metadata.Head.Link, DeepEquals, []*HTMLLink{
+		{Path: "LINK@/href", URL: "/style.css", Rel: "stylesheet", Type: "text/css"}})
+	c.Assert(metadata.Head.Scripts, DeepEquals, []*HTMLLink{{Path: "SCRIPT@/src", URL: "/app.js"}})
+	c.Assert(metadata.Links, DeepEquals, []*HTMLLink{
+		{Path: "A@/href", URL: "/about", Text: "link to the about page", Title: "About us"},
+		{Path: "IMG@/src", URL: "/logo.png", Alt: "Logo"},
+		{Path: "FORM@/action", URL: "/search"},
+	})
+}
+
+func (s *WATSuite) TestNotHTML(c *C) {
+	record := warc.NewWARCRecordFromBytes(map[string]string{
+		"WARC-Type":       "response",
+		"WARC-Target-URI": "http://example.com/data.json",
+		"Content-Type":    "application/http; msgtype=response",
+	}, []byte("HTTP/1.1 200 OK\r\nContent-Type: application/json\r\n\r\n{\"a\": \"<a href='x'>\"}"))
+	envelope := NewEnvelope(record)
+	c.Assert(envelope.PayloadMetadata.HTTPResponseMetadata.HTMLMetadata, IsNil)
+
+	// the Content-Type is sniffed if missing
+	record = warc.NewWARCRecordFromBytes(map[string]string{
+		"WARC-Type":       "response",
+		"WARC-Target-URI": "http://example.com/",
+		"Content-Type":    "application/http; msgtype=response",
+	}, []byte("HTTP/1.1 200 OK\r\n\r\n<html><title>Sniffed</title></html>"))
+	envelope = NewEnvelope(record)
+	c.Assert(envelope.PayloadMetadata.HTTPResponseMetadata.HTMLMetadata.Head.Title, Equals, "Sniffed")
+}
+
+func (s *WATSuite) TestCharset(c *C) {
+	record := warc.NewWARCRecordFromBytes(map[string]string{
+		"WARC-Type":       "response",
+		"WARC-Target-URI": "http://example.com/",
+		"Content-Type":    "application/http; msgtype=response",
+	}, []byte("HTTP/1.1 200 OK\r\nContent-Type: text/html; charset=ISO-8859-1\r\n\r\n<title>Caf\xe9</title>"))
+	envelope := NewEnvelope(record)
+	c.Assert(envelope.PayloadMetadata.HTTPResponseMetadata.HTMLMetadata.Head.Title, Equals, "Café")
+}
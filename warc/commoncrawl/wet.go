@@ -0,0 +1,181 @@
+package commoncrawl
+
+/*
+	Copyright (C) 2015  Wolfgang Meyers
+
+    This program is free software; you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation; either version 2 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License along
+    with this program; if not, write to the Free Software Foundation, Inc.,
+    51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+*/
+import (
+	"bufio"
+	"bytes"
+	"github.com/wolfgangmeyers/go-warc/warc"
+	"golang.org/x/net/html"
+	"io"
+	"strings"
+)
+
+// Elements whose content is not visible text
+var SKIPPED_ELEMENTS map[string]bool = map[string]bool{
+	"head":     true,
+	"script":   true,
+	"style":    true,
+	"noscript": true,
+	"template": true,
+	"iframe":   true,
+	"object":   true,
+	"svg":      true,
+	"select":   true,
+}
+
+// Elements that start a new line of text
+var BLOCK_ELEMENTS map[string]bool = map[string]bool{
+	"address": true, "article": true, "aside": true, "blockquote": true,
+	"br": true, "caption": true, "dd": true, "details": true, "div": true,
+	"dl": true, "dt": true, "fieldset": true, "figcaption": true,
+	"figure": true, "footer": true, "form": true, "h1": true, "h2": true,
+	"h3": true, "h4": true, "h5": true, "h6": true, "header": true,
+	"hr": true, "li": true, "main": true, "nav": true, "ol": true,
+	"p": true, "pre": true, "section": true, "summary": true, "table": true,
+	"td": true, "th": true, "tr": true, "ul": true,
+}
+
+// Converts a WARC file to a WET file, written to writer. The WET file
+// starts with a warcinfo record, followed by a conversion record holding
+// the text of each HTML response of the WARC file.
+func ConvertWET(in io.Reader, writer *warc.WARCWriter, options ConversionOptions) (*ConversionResult, error) {
+	wf, err := warc.NewWARCFile(io.NopCloser(bufio.NewReader(in)))
+	if err != nil {
+		return nil, err
+	}
+	warcinfoId, err := writeWarcinfo(writer, options.Filename, "WET plain text of "+options.Filename)
+	if err != nil {
+		return nil, err
+	}
+	result := &ConversionResult{Written: 1}
+	for record, err := range wf.Records() {
+		if err != nil {
+			return nil, err
+		}
+		result.Records++
+		wet := NewWETRecord(record)
+		if wet == nil {
+			continue
+		}
+		wet.Set("WARC-Warcinfo-ID", warcinfoId)
+		if _, err := writer.WriteRecord(wet); err != nil {
+			return nil, err
+		}
+		result.Written++
+	}
+	return result, nil
+}
+
+// Creates the WET record of a response record: a conversion record
+// referring to it, holding the title and visible text of the page.
+// Returns nil if the record is not an HTML response.
+func NewWETRecord(record *warc.WARCRecord) *warc.WARCRecord {
+	if record.GetType() != "response" {
+		return nil
+	}
+	message, err := record.GetHTTPMessage()
+	if err != nil {
+		return nil
+	}
+	body, err := message.DecodedBody()
+	contentType := message.Header.Get("Content-Type")
+	if err != nil || !isHTML(contentType, body) {
+		return nil
+	}
+	return warc.NewWARCRecordFromBytes(map[string]string{
+		"WARC-Type":       "conversion",
+		"WARC-Target-URI": record.GetUrl(),
+		"WARC-Date":       record.GetDate(),
+		"WARC-Refers-To":  record.GetHeader().GetRecordId(),
+		"Content-Type":    "text/plain",
+	}, []byte(ExtractText(decodeHTML(body, contentType))))
+}
+
+// Extracts the visible text of a UTF-8 encoded HTML page, one line per
+// block of text, preceded by the title of the page.
+func ExtractText(body []byte) string {
+	document, err := html.Parse(bytes.NewReader(body))
+	if err != nil {
+		return ""
+	}
+	lines := []string{}
+	line := strings.Builder{}
+	flush := func() {
+		if text := strings.Join(strings.Fields(line.String()), " "); text != "" {
+			lines = append(lines, text)
+		}
+		line.Reset()
+	}
+	var walk func(node *html.Node, preformatted bool)
+	walk = func(node *html.Node, preformatted bool) {
+		switch node.Type {
+		case html.TextNode:
+			if !preformatted {
+				line.WriteString(node.Data)
+				return
+			}
+			for i, text := range strings.Split(node.Data, "\n") {
+				if i > 0 {
+					flush()
+				}
+				line.WriteString(text)
+			}
+			return
+		case html.ElementNode:
+			if SKIPPED_ELEMENTS[node.Data] {
+				return
+			}
+			if node.Data == "pre" {
+				preformatted = true
+			}
+		}
+		block := node.Type == html.ElementNode && BLOCK_ELEMENTS[node.Data]
+		if block {
+			flush()
+		}
+		for child := node.FirstChild; child != nil; child = child.NextSibling {
+			walk(child, preformatted)
+		}
+		if block {
+			flush()
+		}
+	}
+	walk(document, false)
+	flush()
+	if title := findTitle(document); title != "" {
+		lines = append([]string{title}, lines...)
+	}
+	return strings.Join(lines, "\n")
+}
+
+func findTitle(node *html.Node) string {
+	if node.Type == html.ElementNode && node.Data == "title" {
+		return nodeText(node)
+	}
+	if node.Type == html.ElementNode && node.Data == "svg" {
+		// an svg element has a title of its own
+		return ""
+	}
+	for child := node.FirstChild; child != nil; child = child.NextSibling {
+		if title := findTitle(child); title != "" {
+			return title
+		}
+	}
+	return ""
+}
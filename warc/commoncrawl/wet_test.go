@@ -0,0 +1,96 @@
+package commoncrawl
+
+import (
+	"bytes"
+	"compress/gzip"
+	"github.com/wolfgangmeyers/go-warc/warc"
+	. "gopkg.in/check.v1"
+)
+
+type WETSuite struct{}
+
+var wetSuite = Suite(&WETSuite{})
+
+func newResponse(headers string, body []byte) *warc.WARCRecord {
+	return warc.NewWARCRecordFromBytes(map[string]string{
+		"WARC-Type":       "response",
+		"WARC-Date":       "2024-03-01T10:00:01Z",
+		"WARC-Target-URI": "http://example.com/",
+		"Content-Type":    "application/http; msgtype=response",
+	}, append([]byte("HTTP/1.1 200 OK\r\n"+headers+"\r\n"), body...))
+}
+
+func (s *WETSuite) TestConvert(c *C) {
+	source := sampleWarc(c, true, SAMPLE_HTML)
+	sourceRecords := readRecords(c, source)
+	out := bytes.Buffer{}
+	result, err := ConvertWET(bytes.NewReader(source), warc.NewWARCWriter(&out, true), ConversionOptions{Filename: "sample.warc.gz"})
+	c.Assert(err, IsNil)
+	c.Assert(*result, Equals, ConversionResult{Records: 4, Written: 2})
+
+	records := readRecords(c, out.Bytes())
+	c.Assert(records, HasLen, 2)
+	c.Assert(records[0].GetType(), Equals, "warcinfo")
+	fields := warc.ParseWARCFields(records[0].GetPayload().GetData())
+	c.Assert(fields["description"], Equals, "WET plain text of sample.warc.gz")
+
+	wet := records[1]
+	c.Assert(wet.GetType(), Equals, "conversion")
+	c.Assert(wet.GetUrl(), Equals, "http://example.com/")
+	c.Assert(wet.GetDate(), Equals, "2024-03-01T10:00:01Z")
+	refersTo, _ := wet.Get("WARC-Refers-To")
+	c.Assert(refersTo, Equals, sourceRecords[2].GetHeader().GetRecordId())
+	warcinfoId, _ := wet.Get("WARC-Warcinfo-ID")
+	c.Assert(warcinfoId, Equals, records[0].GetHeader().GetRecordId())
+	contentType, _ := wet.Get("Content-Type")
+	c.Assert(contentType, Equals, "text/plain")
+	c.Assert(string(wet.GetPayload().GetData()), Equals,
+		"An example page\nHello\nSome text with a link to the about page.\nno href")
+}
+
+func (s *WETSuite) TestExtractText(c *C) {
+	text := ExtractText([]byte(`<html><head><title>Table &amp; list</title></head><body>
+		<svg><title>Icon</title></svg>
+		<table><tr><td>a</td><td>b</td></tr><tr><td>c</td></tr></table>
+		<ul><li>one<li>two</ul>
+		<pre>line 1
+  line 2</pre>
+		<div>first<br>second</div>
+		<select><option>hidden</option></select>
+		<template><p>hidden</p></template>
+		<p>caf&eacute; &lt;tag&gt;</p>
+	</body></html>`))
+	c.Assert(text, Equals, "Table & list\na\nb\nc\none\ntwo\nline 1\nline 2\nfirst\nsecond\ncafé <tag>")
+	c.Assert(ExtractText([]byte("")), Equals, "")
+}
+
+func (s *WETSuite) TestCharset(c *C) {
+	latin1 := []byte("<html><head><title>Caf\xe9</title></head><body><p>Gr\xfc\xdfe</p></body></html>")
+	record := NewWETRecord(newResponse("Content-Type: text/html; charset=ISO-8859-1\r\n", latin1))
+	c.Assert(string(record.GetPayload().GetData()), Equals, "Café\nGrüße")
+
+	withMeta := []byte("<html><head><meta charset=\"windows-1252\"><title>\x93Quoted\x94</title></head></html>")
+	record = NewWETRecord(newResponse("Content-Type: text/html\r\n", withMeta))
+	c.Assert(string(record.GetPayload().GetData()), Equals, "“Quoted”")
+
+	record = NewWETRecord(newResponse("Content-Type: text/html; charset=utf-8\r\n", []byte("<p>Café</p>")))
+	c.Assert(string(record.GetPayload().GetData()), Equals, "Café")
+}
+
+func (s *WETSuite) TestContentEncoding(c *C) {
+	compressed := bytes.Buffer{}
+	gzipWriter := gzip.NewWriter(&compressed)
+	gzipWriter.Write([]byte("<p>Compressed</p>"))
+	gzipWriter.Close()
+	record := NewWETRecord(newResponse("Content-Type: text/html\r\nContent-Encoding: gzip\r\n", compressed.Bytes()))
+	c.Assert(string(record.GetPayload().GetData()), Equals, "Compressed")
+}
+
+func (s *WETSuite) TestNotHTML(c *C) {
+	c.Assert(NewWETRecord(newResponse("Content-Type: image/png\r\n", []byte("\x89PNG"))), IsNil)
+	request := warc.NewWARCRecordFromBytes(map[string]string{
+		"WARC-Type":    "request",
+		"Content-Type": "application/http; msgtype=request",
+	}, []byte("GET / HTTP/1.1\r\n\r\n"))
+	c.Assert(NewWETRecord(request), IsNil)
+}
@@ -0,0 +1,68 @@
+package warc
+
+/*
+	Copyright (C) 2015  Wolfgang Meyers
+
+    This program is free software; you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation; either version 2 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License along
+    with this program; if not, write to the Free Software Foundation, Inc.,
+    51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+*/
+import (
+	"context"
+	"iter"
+)
+
+// Reads the next record like ReadRecord, but stops reading as soon as ctx
+// is done, even in the middle of a payload, and returns ctx.Err().
+// A cancelled reader is left in the middle of the interrupted record.
+func (wr *WARCReader) ReadRecordContext(ctx context.Context) (*WARCRecord, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	wr.stream.ctx = ctx
+	defer func() {
+		wr.stream.ctx = nil
+	}()
+	record, err := wr.ReadRecord()
+	if err != nil && ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	return record, err
+}
+
+// Like Iterate, but stops with ctx.Err() as soon as ctx is done.
+func (wr *WARCReader) IterateContext(ctx context.Context, callback func(*WARCRecord, error)) {
+	record, err := wr.ReadRecordContext(ctx)
+	callback(record, err)
+	for record != nil {
+		record, err = wr.ReadRecordContext(ctx)
+		callback(record, err)
+	}
+}
+
+// Like Records, but yields ctx.Err() and stops as soon as ctx is done.
+func (wr *WARCReader) RecordsContext(ctx context.Context) iter.Seq2[*WARCRecord, error] {
+	return records(func() (*WARCRecord, error) {
+		return wr.ReadRecordContext(ctx)
+	})
+}
+
+// See WARCReader.ReadRecordContext
+func (wf *WARCFile) ReadRecordContext(ctx context.Context) (*WARCRecord, error) {
+	return wf.reader.ReadRecordContext(ctx)
+}
+
+// See WARCReader.RecordsContext
+func (wf *WARCFile) RecordsContext(ctx context.Context) iter.Seq2[*WARCRecord, error] {
+	return wf.reader.RecordsContext(ctx)
+}
@@ -0,0 +1,103 @@
+package warc
+
+import (
+	"bytes"
+	"context"
+	. "gopkg.in/check.v1"
+	"io"
+	"math/rand"
+)
+
+type ContextSuite struct{}
+
+var contextSuite = Suite(&ContextSuite{})
+
+// cancellingReader cancels a context once more than limit bytes were read.
+type cancellingReader struct {
+	reader io.Reader
+	limit  int
+	read   int
+	cancel context.CancelFunc
+}
+
+func (cr *cancellingReader) Read(p []byte) (int, error) {
+	if len(p) > 4096 {
+		p = p[:4096]
+	}
+	n, err := cr.reader.Read(p)
+	cr.read += n
+	if cr.read > cr.limit {
+		cr.cancel()
+	}
+	return n, err
+}
+
+func writeLargeRecords(compress bool) []byte {
+	buf := bytes.Buffer{}
+	random := rand.New(rand.NewSource(1))
+	writeSampleRecords(NewWARCWriter(&buf, compress), getSampleRecords(2, map[string]string{
+		"WARC-Type": "resource",
+	}, func(i int) []byte {
+		// random data, so that the compressed file is large as well
+		payload := make([]byte, 4*1024*1024)
+		random.Read(payload)
+		return payload
+	}))
+	return buf.Bytes()
+}
+
+func (s *ContextSuite) TestCancelMidPayload(c *C) {
+	for _, compress := range []bool{false, true} {
+		data := writeLargeRecords(compress)
+		ctx, cancel := context.WithCancel(context.Background())
+		reader := &cancellingReader{reader: bytes.NewReader(data), limit: len(data) / 8, cancel: cancel}
+		f, err := NewWARCFile(io.NopCloser(reader))
+		c.Assert(err, IsNil)
+		record, err := f.ReadRecordContext(ctx)
+		c.Assert(record, IsNil)
+		c.Assert(err, Equals, context.Canceled)
+		c.Assert(reader.read < len(data)/2, Equals, true)
+	}
+}
+
+func (s *ContextSuite) TestCancelled(c *C) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	f, err := NewWARCFile(&ClosingBuffer{bytes.NewReader(getSampleWarcRecord(2))})
+	c.Assert(err, IsNil)
+	_, err = f.ReadRecordContext(ctx)
+	c.Assert(err, Equals, context.Canceled)
+	errors := []error{}
+	for _, err := range f.RecordsContext(ctx) {
+		errors = append(errors, err)
+	}
+	c.Assert(errors, DeepEquals, []error{context.Canceled})
+
+	// nothing was read, and the file can still be read without a context
+	count := 0
+	f.GetReader().IterateContext(context.Background(), func(record *WARCRecord, err error) {
+		if record != nil {
+			count++
+		} else {
+			c.Assert(err, ErrorMatches, "EOF")
+		}
+	})
+	c.Assert(count, Equals, 2)
+}
+
+func (s *ContextSuite) TestCancelLenient(c *C) {
+	data := writeLargeRecords(true)
+	ctx, cancel := context.WithCancel(context.Background())
+	reader := &cancellingReader{reader: bytes.NewReader(data), limit: len(data) / 8, cancel: cancel}
+	f, err := NewWARCFile(io.NopCloser(reader))
+	c.Assert(err, IsNil)
+	f.GetReader().SetLenient(func(err *ReadError) {
+		c.Errorf("unexpected read error: %v", err)
+	})
+	count := 0
+	for _, err := range f.RecordsContext(ctx) {
+		c.Assert(err, Equals, context.Canceled)
+		count++
+	}
+	c.Assert(count, Equals, 1)
+}
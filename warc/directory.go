@@ -0,0 +1,221 @@
+package warc
+
+/*
+	Copyright (C) 2015  Wolfgang Meyers
+
+    This program is free software; you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation; either version 2 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License along
+    with this program; if not, write to the Free Software Foundation, Inc.,
+    51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+*/
+import (
+	"crypto/sha1"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"github.com/wolfgangmeyers/go-warc/warc/utils"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Options for PackageDirectory
+type PackageOptions struct {
+	// The URL that the paths of the files are resolved against to give
+	// their WARC-Target-URI. Defaults to the file:// URL of the directory.
+	BaseURL string
+	// The WARC-Filename of the warcinfo record
+	Filename string
+	// Files that are left out, such as the WARC file that is written
+	// when it is inside the directory
+	Exclude []string
+}
+
+type PackageResult struct {
+	// The number of files written as resource records
+	Files int
+	// The total size of the files
+	Bytes int64
+	// The number of entries that were skipped because they are not
+	// regular files, e.g. symbolic links
+	Skipped int
+}
+
+// Writes each regular file below dir as a resource record, preceded by a
+// warcinfo record describing the directory. Files are written in lexical
+// order of their paths, with the URL of the path relative to dir resolved
+// against options.BaseURL as WARC-Target-URI, the modification time as
+// WARC-Date and a Content-Type detected from the file extension or, if
+// that is not known, the content of the file. Files are read twice, to
+// compute their block digest and to write them, and are never held in
+// memory as a whole.
+func PackageDirectory(dir string, writer *WARCWriter, options PackageOptions) (*PackageResult, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, errors.New(fmt.Sprintf("Not a directory: %v", dir))
+	}
+	base, err := packageBaseURL(dir, options.BaseURL)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := []string{
+		"software: " + SOFTWARE,
+		"format: " + WARC_FORMATS["1.0"],
+		"conformsTo: " + WARC_SPECIFICATIONS["1.0"],
+		"description: Files of directory " + filepath.Base(filepath.Clean(dir)),
+		"isPartOf: " + base.String(),
+	}
+	warcinfoId := NewRecordId()
+	headers := map[string]string{
+		"WARC-Type":      "warcinfo",
+		"WARC-Record-ID": warcinfoId,
+		"WARC-Date":      FormatDate(time.Now()),
+		"Content-Type":   CONTENT_TYPES["warcinfo"],
+	}
+	if options.Filename != "" {
+		headers["WARC-Filename"] = options.Filename
+	}
+	warcinfo := NewWARCRecordFromBytes(headers, []byte(strings.Join(fields, "\r\n")+"\r\n"))
+	if _, err := writer.WriteRecord(warcinfo); err != nil {
+		return nil, err
+	}
+
+	excluded := []os.FileInfo{}
+	for _, filename := range options.Exclude {
+		if info, err := os.Stat(filename); err == nil {
+			excluded = append(excluded, info)
+		}
+	}
+
+	result := &PackageResult{}
+	err = filepath.WalkDir(dir, func(filename string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			return nil
+		}
+		if !entry.Type().IsRegular() {
+			result.Skipped++
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		for _, exclude := range excluded {
+			if os.SameFile(info, exclude) {
+				return nil
+			}
+		}
+		relative, err := filepath.Rel(dir, filename)
+		if err != nil {
+			return err
+		}
+		digest, size, head, err := digestFile(filename)
+		if err != nil {
+			return err
+		}
+		file, err := os.Open(filename)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		target := base.ResolveReference(&url.URL{Path: filepath.ToSlash(relative)})
+		header := NewWARCHeader(map[string]string{
+			"WARC-Type":         "resource",
+			"WARC-Target-URI":   target.String(),
+			"WARC-Date":         FormatDate(info.ModTime()),
+			"WARC-Warcinfo-ID":  warcinfoId,
+			"WARC-Block-Digest": digest,
+			"Content-Type":      detectContentType(filename, head),
+			"Content-Length":    strconv.FormatInt(size, 10),
+		}, true)
+		record := NewWARCRecord(header, utils.NewStreamingFilePart(file, int(size)), nil)
+		if _, err := writer.WriteRecord(record); err != nil {
+			return err
+		}
+		result.Files++
+		result.Bytes += size
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Parses the base URL of a packaged directory, making sure that it ends
+// with a slash so that paths are resolved below it.
+func packageBaseURL(dir string, baseURL string) (*url.URL, error) {
+	if baseURL == "" {
+		absolute, err := filepath.Abs(dir)
+		if err != nil {
+			return nil, err
+		}
+		// Windows paths start with a drive letter
+		return &url.URL{Scheme: "file", Path: path.Clean("/"+filepath.ToSlash(absolute)) + "/"}, nil
+	}
+	base, err := url.Parse(baseURL)
+	if err != nil || !base.IsAbs() {
+		return nil, errors.New(fmt.Sprintf("Bad base URL: %v", baseURL))
+	}
+	if !strings.HasSuffix(base.Path, "/") {
+		base.Path += "/"
+		base.RawPath = ""
+	}
+	return base, nil
+}
+
+// Computes the WARC block digest and size of a file, and returns the first
+// bytes of the file for detecting its content type.
+func digestFile(filename string) (string, int64, []byte, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return "", 0, nil, err
+	}
+	defer file.Close()
+	head := make([]byte, 512)
+	n, err := io.ReadFull(file, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return "", 0, nil, err
+	}
+	head = head[:n]
+	hash := sha1.New()
+	hash.Write(head)
+	size, err := io.Copy(hash, file)
+	if err != nil {
+		return "", 0, nil, err
+	}
+	return "sha1:" + base32.StdEncoding.EncodeToString(hash.Sum(nil)), size + int64(n), head, nil
+}
+
+// Detects the MIME type of a file from its extension, or from its
+// content if the extension is not known.
+func detectContentType(filename string, data []byte) string {
+	if contentType := mime.TypeByExtension(filepath.Ext(filename)); contentType != "" {
+		return contentType
+	}
+	return http.DetectContentType(data)
+}
@@ -0,0 +1,150 @@
+package warc
+
+import (
+	"bytes"
+	"github.com/wolfgangmeyers/go-warc/warc/utils"
+	. "gopkg.in/check.v1"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+type PackageSuite struct {
+	dir string
+}
+
+var packageSuite = Suite(&PackageSuite{})
+
+func (s *PackageSuite) SetUpTest(c *C) {
+	s.dir = c.MkDir()
+	files := map[string]string{
+		"index.html":           "<html><body>Hello</body></html>",
+		"data/values.csv":      "a,b\n1,2\n",
+		"data/notes":           "plain text without an extension",
+		"data/blob":            "\x00\x01\x02\x03",
+		"site/with space#1.md": "# Title",
+	}
+	mtime := time.Date(2023, 6, 1, 12, 30, 0, 0, time.UTC)
+	for name, content := range files {
+		filename := filepath.Join(s.dir, filepath.FromSlash(name))
+		c.Assert(os.MkdirAll(filepath.Dir(filename), 0755), IsNil)
+		c.Assert(os.WriteFile(filename, []byte(content), 0644), IsNil)
+		c.Assert(os.Chtimes(filename, mtime, mtime), IsNil)
+	}
+}
+
+func (s *PackageSuite) readPackage(c *C, options PackageOptions) (*PackageResult, []*WARCRecord) {
+	out := bytes.Buffer{}
+	result, err := PackageDirectory(s.dir, NewWARCWriter(&out, true), options)
+	c.Assert(err, IsNil)
+	report, err := Validate(bytes.NewReader(out.Bytes()), "package.warc.gz")
+	c.Assert(err, IsNil)
+	c.Assert(report.Issues, HasLen, 0)
+	f, err := NewWARCFile(&ClosingBuffer{bytes.NewReader(out.Bytes())})
+	c.Assert(err, IsNil)
+	records := []*WARCRecord{}
+	for record, err := range f.Records() {
+		c.Assert(err, IsNil)
+		records = append(records, record)
+	}
+	return result, records
+}
+
+func (s *PackageSuite) TestPackage(c *C) {
+	result, records := s.readPackage(c, PackageOptions{BaseURL: "https://example.com/export", Filename: "export.warc.gz"})
+	c.Assert(*result, Equals, PackageResult{Files: 5, Bytes: 81})
+	c.Assert(records, HasLen, 6)
+
+	warcinfo := records[0]
+	c.Assert(warcinfo.GetType(), Equals, "warcinfo")
+	filename, _ := warcinfo.Get("WARC-Filename")
+	c.Assert(filename, Equals, "export.warc.gz")
+	fields := ParseWARCFields(warcinfo.GetPayload().GetData())
+	c.Assert(fields["isPartOf"], Equals, "https://example.com/export/")
+
+	urls := []string{}
+	types := []string{}
+	for _, record := range records[1:] {
+		c.Assert(record.GetType(), Equals, "resource")
+		c.Assert(record.GetDate(), Equals, "2023-06-01T12:30:00Z")
+		warcinfoId, _ := record.Get("WARC-Warcinfo-ID")
+		c.Assert(warcinfoId, Equals, warcinfo.GetHeader().GetRecordId())
+		urls = append(urls, record.GetUrl())
+		contentType, _ := record.Get("Content-Type")
+		types = append(types, contentType)
+	}
+	c.Assert(urls, DeepEquals, []string{
+		"https://example.com/export/data/blob",
+		"https://example.com/export/data/notes",
+		"https://example.com/export/data/values.csv",
+		"https://example.com/export/index.html",
+		"https://example.com/export/site/with%20space%231.md",
+	})
+	c.Assert(types[0], Equals, "application/octet-stream")
+	c.Assert(types[1], Equals, "text/plain; charset=utf-8")
+	c.Assert(types[3], Equals, "text/html; charset=utf-8")
+	digest, _ := records[4].Get("WARC-Block-Digest")
+	c.Assert(digest, Equals, ComputeDigest([]byte("<html><body>Hello</body></html>")))
+	c.Assert(string(records[4].GetPayload().GetData()), Equals, "<html><body>Hello</body></html>")
+}
+
+func (s *PackageSuite) TestFileURLs(c *C) {
+	c.Assert(os.Symlink(filepath.Join(s.dir, "index.html"), filepath.Join(s.dir, "link.html")), IsNil)
+	result, records := s.readPackage(c, PackageOptions{})
+	c.Assert(result.Files, Equals, 5)
+	c.Assert(result.Skipped, Equals, 1)
+	absolute, err := filepath.Abs(s.dir)
+	c.Assert(err, IsNil)
+	c.Assert(records[4].GetUrl(), Equals, "file://"+filepath.ToSlash(absolute)+"/index.html")
+}
+
+func (s *PackageSuite) TestErrors(c *C) {
+	writer := NewWARCWriter(&bytes.Buffer{}, false)
+	_, err := PackageDirectory(filepath.Join(s.dir, "index.html"), writer, PackageOptions{})
+	c.Assert(err, ErrorMatches, "Not a directory: .*index.html")
+	_, err = PackageDirectory(filepath.Join(s.dir, "missing"), writer, PackageOptions{})
+	c.Assert(err, NotNil)
+	_, err = PackageDirectory(s.dir, writer, PackageOptions{BaseURL: "export/"})
+	c.Assert(err, ErrorMatches, "Bad base URL: export/")
+}
+
+func (s *PackageSuite) TestLargeFile(c *C) {
+	data := bytes.Repeat([]byte("0123456789abcdef"), 1<<16)
+	c.Assert(os.WriteFile(filepath.Join(s.dir, "data", "large.bin"), data, 0644), IsNil)
+	result, records := s.readPackage(c, PackageOptions{})
+	c.Assert(result.Bytes, Equals, int64(81+len(data)))
+	record := records[2]
+	c.Assert(record.GetUrl(), Matches, "file:///.*/data/large.bin")
+	c.Assert(record.GetHeader().GetContentLength(), Equals, len(data))
+	digest, _ := record.Get("WARC-Block-Digest")
+	c.Assert(digest, Equals, ComputeDigest(data))
+	c.Assert(bytes.Equal(record.GetPayload().GetData(), data), Equals, true)
+}
+
+func (s *PackageSuite) TestZstd(c *C) {
+	out := bytes.Buffer{}
+	writer, err := NewZstdWARCWriter(&out, nil)
+	c.Assert(err, IsNil)
+	result, err := PackageDirectory(s.dir, writer, PackageOptions{})
+	c.Assert(err, IsNil)
+	c.Assert(result.Files, Equals, 5)
+	report, err := Validate(bytes.NewReader(out.Bytes()), "package.warc.zst")
+	c.Assert(err, IsNil)
+	c.Assert(report.Issues, HasLen, 0)
+	c.Assert(report.Records, Equals, 6)
+}
+
+func (s *PackageSuite) TestExclude(c *C) {
+	output := filepath.Join(s.dir, "data", "out.warc")
+	c.Assert(os.WriteFile(output, []byte("partial"), 0644), IsNil)
+	result, err := PackageDirectory(s.dir, NewWARCWriter(&bytes.Buffer{}, false), PackageOptions{Exclude: []string{output}})
+	c.Assert(err, IsNil)
+	c.Assert(*result, Equals, PackageResult{Files: 5, Bytes: 81})
+}
+
+func (s *PackageSuite) TestStreamingPayloadTooShort(c *C) {
+	header := NewWARCHeader(map[string]string{"WARC-Type": "resource", "Content-Length": "10"}, true)
+	record := NewWARCRecord(header, utils.NewStreamingFilePart(bytes.NewReader([]byte("Hello")), 10), nil)
+	_, err := record.WriteTo(&bytes.Buffer{})
+	c.Assert(err, ErrorMatches, "Payload of record .* has 5 of 10 bytes")
+}
@@ -0,0 +1,266 @@
+package warc
+
+/*
+	Copyright (C) 2015  Wolfgang Meyers
+
+    This program is free software; you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation; either version 2 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License along
+    with this program; if not, write to the Free Software Foundation, Inc.,
+    51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+*/
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Comparison operators of filter terms, longest first
+var FILTER_OPERATORS []string = []string{">=", "<=", "!=", ":", "=", "~", "<", ">"}
+
+var RE_FILTER_FIELD *regexp.Regexp = regexp.MustCompile("^[a-zA-Z_\\-]+")
+
+type filterTerm struct {
+	negate   bool
+	field    string
+	operator string
+	value    string
+	re       *regexp.Regexp
+}
+
+// A Filter selects records with a small expression language. An expression
+// is a list of terms separated by spaces, all of which must match:
+//
+//	type:response status:200 mime:text/html url~example.com date>=2020
+//
+// Each term is a field, an operator and a value. The fields are type, url,
+// id, date, status (the HTTP status code), mime (the media type of the
+// payload) and the names of WARC headers, such as WARC-IP-Address.
+// The operators are:
+//
+//	:  the value equals the field (= may be used as well)
+//	!= the value does not equal the field
+//	~  the value is a regular expression matching the field
+//	<, <=, >, >= compare numbers as numbers and other values as strings
+//
+// Dates are compared by their digits, as far as the value goes, so that
+// date:2020-05 matches all records of May 2020 and date<=2020 matches all
+// records up to the end of 2020. A term starting with ! matches records
+// that the rest of the term does not match. Values holding spaces may be
+// quoted with double quotes.
+type Filter struct {
+	terms []*filterTerm
+}
+
+// Parses a filter expression.
+func ParseFilter(expression string) (*Filter, error) {
+	tokens, err := splitFilterExpression(expression)
+	if err != nil {
+		return nil, err
+	}
+	filter := &Filter{}
+	for _, token := range tokens {
+		term, err := parseFilterTerm(token)
+		if err != nil {
+			return nil, err
+		}
+		filter.terms = append(filter.terms, term)
+	}
+	return filter, nil
+}
+
+// Splits an expression on spaces outside of double quotes, removing the quotes.
+func splitFilterExpression(expression string) ([]string, error) {
+	tokens := []string{}
+	token := strings.Builder{}
+	inToken, quoted := false, false
+	for _, r := range expression {
+		switch {
+		case r == '"':
+			quoted = !quoted
+			inToken = true
+		case !quoted && (r == ' ' || r == '\t' || r == '\n'):
+			if inToken {
+				tokens = append(tokens, token.String())
+				token.Reset()
+				inToken = false
+			}
+		default:
+			token.WriteRune(r)
+			inToken = true
+		}
+	}
+	if quoted {
+		return nil, errors.New(fmt.Sprintf("Unterminated quote in filter: %v", expression))
+	}
+	if inToken {
+		tokens = append(tokens, token.String())
+	}
+	return tokens, nil
+}
+
+func parseFilterTerm(token string) (*filterTerm, error) {
+	term := &filterTerm{}
+	if strings.HasPrefix(token, "!") {
+		term.negate = true
+		token = token[1:]
+	}
+	term.field = RE_FILTER_FIELD.FindString(token)
+	rest := token[len(term.field):]
+	for _, operator := range FILTER_OPERATORS {
+		if strings.HasPrefix(rest, operator) {
+			term.operator = operator
+			term.value = rest[len(operator):]
+			break
+		}
+	}
+	if term.field == "" || term.operator == "" {
+		return nil, errors.New(fmt.Sprintf("Bad filter term: %v", token))
+	}
+	if term.operator == "=" {
+		term.operator = ":"
+	}
+	switch strings.ToLower(term.field) {
+	case "type", "url", "id", "date", "status", "mime":
+		term.field = strings.ToLower(term.field)
+	default:
+		term.field = canonicalHeaderName(term.field)
+	}
+	if term.operator == "~" {
+		re, err := regexp.Compile(term.value)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("Bad regular expression in filter term %v: %v", token, err))
+		}
+		term.re = re
+	}
+	return term, nil
+}
+
+// Returns the value of a filter field for a record.
+func filterField(record *WARCRecord, field string) string {
+	switch field {
+	case "type":
+		return record.GetType()
+	case "url":
+		return record.GetUrl()
+	case "id":
+		return record.GetHeader().GetRecordId()
+	case "date":
+		return record.GetDate()
+	case "status":
+		status, _ := httpMetadata(record)
+		return status
+	case "mime":
+		_, mime := httpMetadata(record)
+		return mime
+	}
+	value, _ := record.Get(field)
+	return value
+}
+
+func (ft *filterTerm) match(record *WARCRecord) bool {
+	actual, value := filterField(record, ft.field), ft.value
+	if ft.field == "date" {
+		// compare the digits of the date, as far as the value goes
+		actual, value = CDXTimestamp(actual), CDXTimestamp(value)
+		if len(actual) > len(value) {
+			actual = actual[:len(value)]
+		}
+	}
+	comparison := strings.Compare(actual, value)
+	number, err1 := strconv.ParseFloat(actual, 64)
+	expected, err2 := strconv.ParseFloat(value, 64)
+	if err1 == nil && err2 == nil {
+		comparison = 0
+		if number < expected {
+			comparison = -1
+		} else if number > expected {
+			comparison = 1
+		}
+	}
+	switch ft.operator {
+	case ":":
+		return actual == value
+	case "!=":
+		return actual != value
+	case "~":
+		return ft.re.MatchString(actual)
+	}
+	if actual == "" {
+		return false
+	}
+	switch ft.operator {
+	case "<":
+		return comparison < 0
+	case "<=":
+		return comparison <= 0
+	case ">":
+		return comparison > 0
+	}
+	return comparison >= 0
+}
+
+// Checks whether a record matches all terms of the filter.
+func (f *Filter) Match(record *WARCRecord) bool {
+	for _, term := range f.terms {
+		if term.match(record) == term.negate {
+			return false
+		}
+	}
+	return true
+}
+
+// Copies the records of a WARC file that match filter to out, byte for
+// byte, in the compression given by options, as Recompress does.
+func FilterWARC(in io.Reader, out io.Writer, filter *Filter, options RecompressOptions) (*RecompressResult, error) {
+	stream, err := newRecordStream(in, nil)
+	if err != nil {
+		return nil, err
+	}
+	writer, err := newWriterFor(out, options.Compression, options.Dictionary)
+	if err != nil {
+		return nil, err
+	}
+	result := &RecompressResult{}
+	for {
+		offset, err := stream.next()
+		if err == io.EOF {
+			return result, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		raw := bytes.Buffer{}
+		if err := copyRawRecord(stream.reader, &raw); err != nil {
+			return nil, errors.New(fmt.Sprintf("Record at offset %v: %v", offset, err))
+		}
+		record, err := ReadRecordAt(bytes.NewReader(raw.Bytes()), 0)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("Record at offset %v: %v", offset, err))
+		}
+		if !filter.Match(record) {
+			continue
+		}
+		_, err = writer.writeMember(func(w io.Writer) error {
+			_, err := w.Write(raw.Bytes())
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		result.Records++
+		result.Digests = append(result.Digests, ComputeDigest(raw.Bytes()))
+	}
+}
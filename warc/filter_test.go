@@ -0,0 +1,93 @@
+package warc
+
+import (
+	"bytes"
+	. "gopkg.in/check.v1"
+)
+
+type FilterSuite struct{}
+
+var filterSuite = Suite(&FilterSuite{})
+
+func getFilterRecords() []*WARCRecord {
+	response := func(url string, date string, status string, mime string) *WARCRecord {
+		return NewWARCRecordFromBytes(map[string]string{
+			"WARC-Type":       "response",
+			"WARC-Target-URI": url,
+			"WARC-Date":       date,
+			"Content-Type":    CONTENT_TYPES["response"],
+		}, []byte("HTTP/1.1 "+status+"\r\nContent-Type: "+mime+"\r\n\r\nHello"))
+	}
+	return []*WARCRecord{
+		NewWARCRecordFromBytes(map[string]string{
+			"WARC-Type":    "warcinfo",
+			"WARC-Date":    "2019-12-31T23:59:59Z",
+			"Content-Type": CONTENT_TYPES["warcinfo"],
+		}, []byte("software: go-warc\r\n")),
+		response("http://example.com/", "2019-06-01T00:00:00Z", "200 OK", "text/html; charset=utf-8"),
+		response("http://example.com/missing", "2020-01-01T00:00:00Z", "404 Not Found", "text/html"),
+		response("http://www.example.org/image.png", "2020-05-17T12:00:00Z", "200 OK", "image/png"),
+		response("http://example.com/later", "2021-03-01T00:00:00Z", "200 OK", "text/html"),
+	}
+}
+
+func matching(c *C, expression string) []int {
+	filter, err := ParseFilter(expression)
+	c.Assert(err, IsNil)
+	matches := []int{}
+	for i, record := range getFilterRecords() {
+		if filter.Match(record) {
+			matches = append(matches, i)
+		}
+	}
+	return matches
+}
+
+func (s *FilterSuite) TestMatch(c *C) {
+	c.Assert(matching(c, ""), DeepEquals, []int{0, 1, 2, 3, 4})
+	c.Assert(matching(c, "type:response status:200 mime:text/html url~example.com date>=2020"), DeepEquals, []int{4})
+	c.Assert(matching(c, "type=warcinfo"), DeepEquals, []int{0})
+	c.Assert(matching(c, "status>=400"), DeepEquals, []int{2})
+	c.Assert(matching(c, "status!=200"), DeepEquals, []int{0, 2})
+	c.Assert(matching(c, "!mime:text/html"), DeepEquals, []int{0, 3})
+	c.Assert(matching(c, "date:2020-05"), DeepEquals, []int{3})
+	c.Assert(matching(c, "date<=2020"), DeepEquals, []int{0, 1, 2, 3})
+	c.Assert(matching(c, "date<2020"), DeepEquals, []int{0, 1})
+	c.Assert(matching(c, "url~\\.png$"), DeepEquals, []int{3})
+	c.Assert(matching(c, "warc-target-uri:http://example.com/"), DeepEquals, []int{1})
+	c.Assert(matching(c, "Content-Type:\"application/http; msgtype=response\""), DeepEquals, []int{1, 2, 3, 4})
+}
+
+func (s *FilterSuite) TestBadExpressions(c *C) {
+	for expression, message := range map[string]string{
+		"type":          "Bad filter term: type",
+		":response":     "Bad filter term: :response",
+		"url~(":         "Bad regular expression in filter term url~\\(: .*",
+		"url:\"example": "Unterminated quote in filter: .*",
+	} {
+		_, err := ParseFilter(expression)
+		c.Assert(err, ErrorMatches, message)
+	}
+}
+
+func (s *FilterSuite) TestFilterWARC(c *C) {
+	compressed, plain := bytes.Buffer{}, bytes.Buffer{}
+	writer := NewWARCWriter(&compressed, true)
+	records := [][]byte{}
+	for _, record := range getFilterRecords() {
+		_, err := writer.WriteRecord(record)
+		c.Assert(err, IsNil)
+		start := plain.Len()
+		record.WriteTo(&plain)
+		records = append(records, plain.Bytes()[start:])
+	}
+	filter, err := ParseFilter("status:200")
+	c.Assert(err, IsNil)
+	out := bytes.Buffer{}
+	result, err := FilterWARC(bytes.NewReader(compressed.Bytes()), &out, filter, RecompressOptions{Compression: COMPRESSION_NONE})
+	c.Assert(err, IsNil)
+	c.Assert(result.Records, Equals, 3)
+	c.Assert(VerifyRecompression(result, bytes.NewReader(out.Bytes())), IsNil)
+	// records are copied verbatim
+	c.Assert(out.Bytes(), DeepEquals, bytes.Join([][]byte{records[1], records[3], records[4]}, nil))
+}
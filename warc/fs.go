@@ -0,0 +1,292 @@
+package warc
+
+/*
+	Copyright (C) 2015  Wolfgang Meyers
+
+    This program is free software; you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation; either version 2 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License along
+    with this program; if not, write to the Free Software Foundation, Inc.,
+    51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+*/
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"math"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ArchiveFS is an fs.FS over the captures in one or more WARC files, so
+// that archives can be used with http.FileServer, fs.WalkDir or
+// template.ParseFS. Each successful capture of an HTTP or HTTPS URL is a
+// file at host/path, holding the decoded HTTP payload, with the WARC-Date
+// as modification time. URLs ending with a slash, and URLs that are also
+// directories, are stored as index.html, and queries are appended to the
+// file name. If a URL was captured more than once, the latest capture is used.
+type ArchiveFS struct {
+	// captures by path
+	files map[string]*CDXEntry
+	// names of the entries of each directory
+	dirs map[string][]string
+	open func(entry *CDXEntry) (*WARCRecord, error)
+}
+
+// Creates an ArchiveFS over a single WARC file, which is indexed first.
+func NewFS(reader io.ReaderAt) (*ArchiveFS, error) {
+	entries, err := IndexWARC(io.NewSectionReader(reader, 0, math.MaxInt64), "")
+	if err != nil {
+		return nil, err
+	}
+	return newArchiveFS(entries, func(entry *CDXEntry) (*WARCRecord, error) {
+		offset, _, err := entry.Location()
+		if err != nil {
+			return nil, err
+		}
+		return ReadRecordAt(reader, offset)
+	}), nil
+}
+
+// Creates an ArchiveFS over the records of a CDX index, such as the one
+// returned by Collection.Index. Records are read from the files named by
+// the entries when they are opened.
+func NewIndexFS(entries []*CDXEntry) *ArchiveFS {
+	return newArchiveFS(entries, func(entry *CDXEntry) (*WARCRecord, error) {
+		offset, _, err := entry.Location()
+		if err != nil {
+			return nil, err
+		}
+		f, err := os.Open(entry.Filename)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		return ReadRecordAt(f, offset)
+	})
+}
+
+func newArchiveFS(entries []*CDXEntry, open func(entry *CDXEntry) (*WARCRecord, error)) *ArchiveFS {
+	fsys := &ArchiveFS{
+		files: map[string]*CDXEntry{},
+		dirs:  map[string][]string{},
+		open:  open,
+	}
+	captures := map[string]*CDXEntry{}
+	for _, entry := range entries {
+		if entry.Mime == "warc/revisit" || (entry.Status != "" && entry.Status != "200") {
+			continue
+		}
+		name, ok := URLPath(entry.URL)
+		if !ok {
+			continue
+		}
+		if latest, exists := captures[name]; !exists || entry.Timestamp > latest.Timestamp {
+			captures[name] = entry
+		}
+	}
+	// directories are all parents of the captures
+	isDir := map[string]bool{".": true}
+	for name := range captures {
+		for dir := path.Dir(name); dir != "." && !isDir[dir]; dir = path.Dir(dir) {
+			isDir[dir] = true
+		}
+	}
+	for name, entry := range captures {
+		if isDir[name] {
+			name = name + "/index.html"
+			if _, exists := captures[name]; exists {
+				continue
+			}
+		}
+		fsys.files[name] = entry
+	}
+	add := func(name string) {
+		dir := path.Dir(name)
+		fsys.dirs[dir] = append(fsys.dirs[dir], path.Base(name))
+	}
+	for name := range fsys.files {
+		add(name)
+	}
+	for dir := range isDir {
+		if dir != "." {
+			add(dir)
+		}
+	}
+	if _, exists := fsys.dirs["."]; !exists {
+		fsys.dirs["."] = []string{}
+	}
+	for _, names := range fsys.dirs {
+		sort.Strings(names)
+	}
+	return fsys
+}
+
+// Returns the path of the file holding a capture of rawurl in an
+// ArchiveFS, or false if it is not an HTTP or HTTPS URL that can be stored.
+func URLPath(rawurl string) (string, bool) {
+	u, err := url.Parse(rawurl)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", false
+	}
+	name := strings.ToLower(u.Host) + u.Path
+	if u.Path == "" || strings.HasSuffix(u.Path, "/") {
+		name = strings.TrimSuffix(name, "/") + "/index.html"
+	}
+	if u.RawQuery != "" {
+		name += "?" + u.RawQuery
+	}
+	if !fs.ValidPath(name) || strings.Contains(name, "\\") {
+		return "", false
+	}
+	return name, true
+}
+
+func (fsys *ArchiveFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	if names, exists := fsys.dirs[name]; exists {
+		return &archiveDir{fsys: fsys, name: name, names: names}, nil
+	}
+	entry, exists := fsys.files[name]
+	if !exists {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	record, err := fsys.open(entry)
+	if err == nil && record.GetUrl() != entry.URL {
+		err = errors.New("Record at " + entry.Offset + " is not a capture of " + entry.URL)
+	}
+	var data []byte
+	if err == nil {
+		data, err = decodedPayload(record)
+	}
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	info := &archiveFileInfo{name: path.Base(name), size: int64(len(data)), record: record}
+	info.modTime, _ = time.Parse(time.RFC3339Nano, record.GetDate())
+	return &archiveFile{Reader: bytes.NewReader(data), info: info}, nil
+}
+
+// Returns the decoded HTTP payload of HTTP records, and the block of others.
+func decodedPayload(record *WARCRecord) ([]byte, error) {
+	contentType, _ := record.Get("Content-Type")
+	if !strings.HasPrefix(contentType, "application/http") {
+		return record.GetPayload().GetData(), nil
+	}
+	message, err := record.GetHTTPMessage()
+	if err != nil {
+		return nil, err
+	}
+	return message.DecodedBody()
+}
+
+type archiveFileInfo struct {
+	name    string
+	size    int64
+	modTime time.Time
+	record  *WARCRecord
+	dir     bool
+}
+
+func (fi *archiveFileInfo) Name() string       { return fi.name }
+func (fi *archiveFileInfo) Size() int64        { return fi.size }
+func (fi *archiveFileInfo) ModTime() time.Time { return fi.modTime }
+func (fi *archiveFileInfo) IsDir() bool        { return fi.dir }
+
+func (fi *archiveFileInfo) Mode() fs.FileMode {
+	if fi.dir {
+		return fs.ModeDir | 0555
+	}
+	return 0444
+}
+
+// Returns the *WARCRecord of files, and nil for directories.
+func (fi *archiveFileInfo) Sys() interface{} {
+	if fi.record == nil {
+		return nil
+	}
+	return fi.record
+}
+
+// archiveFile is an open file of an ArchiveFS. It supports seeking,
+// as needed by http.FileServer.
+type archiveFile struct {
+	*bytes.Reader
+	info *archiveFileInfo
+}
+
+func (af *archiveFile) Stat() (fs.FileInfo, error) { return af.info, nil }
+func (af *archiveFile) Close() error               { return nil }
+
+type archiveDir struct {
+	fsys  *ArchiveFS
+	name  string
+	names []string
+	// the number of entries returned by ReadDir
+	read int
+}
+
+func (ad *archiveDir) Stat() (fs.FileInfo, error) {
+	return &archiveFileInfo{name: path.Base(ad.name), dir: true}, nil
+}
+
+func (ad *archiveDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: ad.name, Err: errors.New("is a directory")}
+}
+
+func (ad *archiveDir) Close() error { return nil }
+
+func (ad *archiveDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	names := ad.names[ad.read:]
+	if n > 0 && len(names) == 0 {
+		return nil, io.EOF
+	}
+	if n > 0 && len(names) > n {
+		names = names[:n]
+	}
+	ad.read += len(names)
+	entries := []fs.DirEntry{}
+	for _, name := range names {
+		entries = append(entries, &archiveDirEntry{fsys: ad.fsys, name: path.Join(ad.name, name)})
+	}
+	return entries, nil
+}
+
+type archiveDirEntry struct {
+	fsys *ArchiveFS
+	name string
+}
+
+func (de *archiveDirEntry) Name() string { return path.Base(de.name) }
+
+func (de *archiveDirEntry) IsDir() bool {
+	_, exists := de.fsys.dirs[de.name]
+	return exists
+}
+
+func (de *archiveDirEntry) Type() fs.FileMode {
+	if de.IsDir() {
+		return fs.ModeDir
+	}
+	return 0
+}
+
+// Reading the info of a file reads and decodes its record.
+func (de *archiveDirEntry) Info() (fs.FileInfo, error) {
+	return fs.Stat(de.fsys, de.name)
+}
@@ -0,0 +1,162 @@
+package warc
+
+import (
+	"bytes"
+	"compress/gzip"
+	. "gopkg.in/check.v1"
+	"html/template"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing/fstest"
+	"time"
+)
+
+type FSSuite struct{}
+
+var fsSuite = Suite(&FSSuite{})
+
+func getArchiveFSFile(c *C) []byte {
+	compressed := bytes.Buffer{}
+	gzout := gzip.NewWriter(&compressed)
+	gzout.Write([]byte("body { color: red }"))
+	gzout.Close()
+	response := func(url string, date string, headers string, body []byte) *WARCRecord {
+		return NewWARCRecordFromBytes(map[string]string{
+			"WARC-Type":       "response",
+			"WARC-Target-URI": url,
+			"WARC-Date":       date,
+			"Content-Type":    CONTENT_TYPES["response"],
+		}, append([]byte("HTTP/1.1 "+headers+"\r\n\r\n"), body...))
+	}
+	records := []*WARCRecord{
+		response("http://example.com/", "2020-01-01T00:00:00Z", "200 OK\r\nContent-Type: text/html", []byte("<p>{{.}}</p>")),
+		response("http://example.com/about", "2020-01-01T00:00:00Z", "200 OK\r\nContent-Type: text/html", []byte("old about")),
+		response("http://example.com/about", "2020-02-01T00:00:00Z", "200 OK\r\nContent-Type: text/html", []byte("about")),
+		response("http://example.com/about/team.html", "2020-01-01T00:00:00Z", "200 OK", []byte("team")),
+		response("http://example.com/style.css", "2020-01-02T03:04:05Z", "200 OK\r\nContent-Type: text/css\r\nContent-Encoding: gzip", compressed.Bytes()),
+		response("http://example.com/chunked.txt", "2020-01-01T00:00:00Z", "200 OK\r\nTransfer-Encoding: chunked", []byte("5\r\nHello\r\n5\r\nworld\r\n0\r\n\r\n")),
+		response("http://example.com/search?q=go", "2020-01-01T00:00:00Z", "200 OK", []byte("results")),
+		response("http://example.com/missing", "2020-01-01T00:00:00Z", "404 Not Found", []byte("not found")),
+		response("dns:example.com", "2020-01-01T00:00:00Z", "200 OK", []byte("dns")),
+		NewWARCRecordFromBytes(map[string]string{
+			"WARC-Type":       "resource",
+			"WARC-Target-URI": "https://Example.org/data.txt",
+			"WARC-Date":       "2020-01-01T00:00:00Z",
+			"Content-Type":    "text/plain",
+		}, []byte("data")),
+	}
+	buf := bytes.Buffer{}
+	writer := NewWARCWriter(&buf, true)
+	for _, record := range records {
+		_, err := writer.WriteRecord(record)
+		c.Assert(err, IsNil)
+	}
+	return buf.Bytes()
+}
+
+var archiveFSFiles map[string]string = map[string]string{
+	"example.com/index.html":       "<p>{{.}}</p>",
+	"example.com/about/index.html": "about",
+	"example.com/about/team.html":  "team",
+	"example.com/style.css":        "body { color: red }",
+	"example.com/chunked.txt":      "Helloworld",
+	"example.com/search?q=go":      "results",
+	"example.org/data.txt":         "data",
+}
+
+func checkArchiveFS(c *C, fsys fs.FS) {
+	names := []string{}
+	for name, content := range archiveFSFiles {
+		data, err := fs.ReadFile(fsys, name)
+		c.Assert(err, IsNil)
+		c.Assert(string(data), Equals, content)
+		names = append(names, name)
+	}
+	c.Assert(fstest.TestFS(fsys, names...), IsNil)
+	walked := []string{}
+	err := fs.WalkDir(fsys, ".", func(path string, entry fs.DirEntry, err error) error {
+		if err == nil && !entry.IsDir() {
+			walked = append(walked, path)
+		}
+		return err
+	})
+	c.Assert(err, IsNil)
+	c.Assert(walked, HasLen, len(archiveFSFiles))
+}
+
+func (s *FSSuite) TestFS(c *C) {
+	fsys, err := NewFS(bytes.NewReader(getArchiveFSFile(c)))
+	c.Assert(err, IsNil)
+	checkArchiveFS(c, fsys)
+
+	info, err := fs.Stat(fsys, "example.com/style.css")
+	c.Assert(err, IsNil)
+	c.Assert(info.ModTime().Equal(time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)), Equals, true)
+	c.Assert(info.Size(), Equals, int64(19))
+	c.Assert(info.Sys().(*WARCRecord).GetUrl(), Equals, "http://example.com/style.css")
+
+	_, err = fsys.Open("example.com/missing")
+	c.Assert(err, ErrorMatches, "open example.com/missing: file does not exist")
+	_, err = fsys.Open("/example.com")
+	c.Assert(err, ErrorMatches, "open /example.com: invalid argument")
+}
+
+func (s *FSSuite) TestFileServer(c *C) {
+	fsys, err := NewFS(bytes.NewReader(getArchiveFSFile(c)))
+	c.Assert(err, IsNil)
+	server := httptest.NewServer(http.FileServer(http.FS(fsys)))
+	defer server.Close()
+	response, err := http.Get(server.URL + "/example.com/style.css")
+	c.Assert(err, IsNil)
+	body, _ := io.ReadAll(response.Body)
+	response.Body.Close()
+	c.Assert(response.StatusCode, Equals, 200)
+	c.Assert(string(body), Equals, "body { color: red }")
+	c.Assert(response.Header.Get("Content-Type"), Equals, "text/css; charset=utf-8")
+
+	response, err = http.Get(server.URL + "/example.com/about/")
+	c.Assert(err, IsNil)
+	body, _ = io.ReadAll(response.Body)
+	response.Body.Close()
+	c.Assert(string(body), Equals, "about")
+}
+
+func (s *FSSuite) TestTemplates(c *C) {
+	fsys, err := NewFS(bytes.NewReader(getArchiveFSFile(c)))
+	c.Assert(err, IsNil)
+	templates, err := template.ParseFS(fsys, "example.com/*.html")
+	c.Assert(err, IsNil)
+	out := bytes.Buffer{}
+	c.Assert(templates.ExecuteTemplate(&out, "index.html", "Hello"), IsNil)
+	c.Assert(out.String(), Equals, "<p>Hello</p>")
+}
+
+func (s *FSSuite) TestCollection(c *C) {
+	dir := c.MkDir()
+	c.Assert(os.WriteFile(filepath.Join(dir, "a.warc.gz"), getArchiveFSFile(c), 0644), IsNil)
+	col, err := OpenCollection(dir)
+	c.Assert(err, IsNil)
+	entries, err := col.Index()
+	c.Assert(err, IsNil)
+	checkArchiveFS(c, NewIndexFS(entries))
+}
+
+func (s *FSSuite) TestURLPath(c *C) {
+	for url, expected := range map[string]string{
+		"http://example.com":          "example.com/index.html",
+		"https://EXAMPLE.com:8080/a/": "example.com:8080/a/index.html",
+		"http://example.com/a%20b":    "example.com/a b",
+		"http://example.com/a/../b":   "",
+		"http://example.com//a":       "",
+		"ftp://example.com/a":         "",
+		"dns:example.com":             "",
+	} {
+		name, ok := URLPath(url)
+		c.Assert(name, Equals, expected)
+		c.Assert(ok, Equals, expected != "")
+	}
+}
@@ -0,0 +1,771 @@
+package warc
+
+/*
+	Copyright (C) 2015  Wolfgang Meyers
+
+    This program is free software; you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation; either version 2 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License along
+    with this program; if not, write to the Free Software Foundation, Inc.,
+    51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+*/
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// The content type of the metadata records that hold the timings of a HAR entry
+var HAR_METADATA_CONTENT_TYPE string = "application/json"
+
+// A HAR 1.2 archive, as exported by browser developer tools and Playwright.
+// See http://www.softwareishard.com/blog/har-12-spec/
+type HAR struct {
+	Log *HARLog `json:"log"`
+}
+
+type HARLog struct {
+	Version string      `json:"version"`
+	Creator *HARCreator `json:"creator"`
+	Browser *HARCreator `json:"browser,omitempty"`
+	Pages   []*HARPage  `json:"pages,omitempty"`
+	Entries []*HAREntry `json:"entries"`
+	Comment string      `json:"comment,omitempty"`
+}
+
+// The creator or browser of a HAR log
+type HARCreator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+	Comment string `json:"comment,omitempty"`
+}
+
+type HARPage struct {
+	StartedDateTime string          `json:"startedDateTime"`
+	ID              string          `json:"id"`
+	Title           string          `json:"title"`
+	PageTimings     *HARPageTimings `json:"pageTimings"`
+	Comment         string          `json:"comment,omitempty"`
+}
+
+// Page load timings in milliseconds, -1 if not available
+type HARPageTimings struct {
+	OnContentLoad float64 `json:"onContentLoad"`
+	OnLoad        float64 `json:"onLoad"`
+	Comment       string  `json:"comment,omitempty"`
+}
+
+type HAREntry struct {
+	Pageref         string         `json:"pageref,omitempty"`
+	StartedDateTime string         `json:"startedDateTime"`
+	Time            float64        `json:"time"`
+	Request         *HARRequest    `json:"request"`
+	Response        *HARResponse   `json:"response"`
+	Cache           map[string]any `json:"cache"`
+	Timings         *HARTimings    `json:"timings"`
+	ServerIPAddress string         `json:"serverIPAddress,omitempty"`
+	Connection      string         `json:"connection,omitempty"`
+	Comment         string         `json:"comment,omitempty"`
+}
+
+type HARRequest struct {
+	Method      string          `json:"method"`
+	URL         string          `json:"url"`
+	HTTPVersion string          `json:"httpVersion"`
+	Cookies     []*HARCookie    `json:"cookies"`
+	Headers     []*HARNameValue `json:"headers"`
+	QueryString []*HARNameValue `json:"queryString"`
+	PostData    *HARPostData    `json:"postData,omitempty"`
+	HeadersSize int64           `json:"headersSize"`
+	BodySize    int64           `json:"bodySize"`
+	Comment     string          `json:"comment,omitempty"`
+}
+
+type HARResponse struct {
+	Status      int             `json:"status"`
+	StatusText  string          `json:"statusText"`
+	HTTPVersion string          `json:"httpVersion"`
+	Cookies     []*HARCookie    `json:"cookies"`
+	Headers     []*HARNameValue `json:"headers"`
+	Content     *HARContent     `json:"content"`
+	RedirectURL string          `json:"redirectURL"`
+	HeadersSize int64           `json:"headersSize"`
+	BodySize    int64           `json:"bodySize"`
+	Comment     string          `json:"comment,omitempty"`
+}
+
+type HARCookie struct {
+	Name     string `json:"name"`
+	Value    string `json:"value"`
+	Path     string `json:"path,omitempty"`
+	Domain   string `json:"domain,omitempty"`
+	Expires  string `json:"expires,omitempty"`
+	HTTPOnly bool   `json:"httpOnly,omitempty"`
+	Secure   bool   `json:"secure,omitempty"`
+	Comment  string `json:"comment,omitempty"`
+}
+
+// A header or query string parameter
+type HARNameValue struct {
+	Name    string `json:"name"`
+	Value   string `json:"value"`
+	Comment string `json:"comment,omitempty"`
+}
+
+type HARPostData struct {
+	MimeType string          `json:"mimeType"`
+	Params   []*HARPostParam `json:"params,omitempty"`
+	Text     string          `json:"text"`
+	Comment  string          `json:"comment,omitempty"`
+}
+
+type HARPostParam struct {
+	Name        string `json:"name"`
+	Value       string `json:"value,omitempty"`
+	FileName    string `json:"fileName,omitempty"`
+	ContentType string `json:"contentType,omitempty"`
+	Comment     string `json:"comment,omitempty"`
+}
+
+// The response body. Text holds the body with any content encoding
+// removed, base64 encoded if Encoding is "base64".
+type HARContent struct {
+	Size        int64  `json:"size"`
+	Compression int64  `json:"compression,omitempty"`
+	MimeType    string `json:"mimeType"`
+	Text        string `json:"text,omitempty"`
+	Encoding    string `json:"encoding,omitempty"`
+	Comment     string `json:"comment,omitempty"`
+}
+
+// Request timings in milliseconds, -1 if not available
+type HARTimings struct {
+	Blocked float64 `json:"blocked,omitempty"`
+	DNS     float64 `json:"dns,omitempty"`
+	Connect float64 `json:"connect,omitempty"`
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+	SSL     float64 `json:"ssl,omitempty"`
+	Comment string  `json:"comment,omitempty"`
+}
+
+// The block of the metadata record written for each HAR entry, keeping
+// the parts of the entry that have no place in the request and response records.
+type HARMetadata struct {
+	StartedDateTime string      `json:"startedDateTime"`
+	Time            float64     `json:"time"`
+	Timings         *HARTimings `json:"timings,omitempty"`
+	ServerIPAddress string      `json:"serverIPAddress,omitempty"`
+	Connection      string      `json:"connection,omitempty"`
+	Page            *HARPage    `json:"page,omitempty"`
+	Comment         string      `json:"comment,omitempty"`
+}
+
+type HARConversionResult struct {
+	// The number of entries that were converted
+	Entries int
+	// The number of entries that were skipped because they are not
+	// for an http or https URL, e.g. data: URLs
+	Skipped int
+	// The number of records written, including the warcinfo record
+	Records int
+}
+
+// Reads a HAR file.
+func ReadHAR(reader io.Reader) (*HAR, error) {
+	har := &HAR{}
+	if err := json.NewDecoder(reader).Decode(har); err != nil {
+		return nil, errors.New(fmt.Sprintf("Bad HAR file: %v", err))
+	}
+	if har.Log == nil {
+		return nil, errors.New("Bad HAR file: no log")
+	}
+	return har, nil
+}
+
+// Converts the entries of a HAR log to WARC records written to writer.
+//
+// A warcinfo record describing the HAR log comes first. Each entry then
+// gives a request record, a response record and a metadata record holding
+// the timings of the entry, its page and other details as HARMetadata. The
+// HTTP messages are rebuilt in HTTP/1.1 wire format: since a HAR holds
+// response bodies with the content encoding removed, the Content-Encoding
+// and Transfer-Encoding headers are dropped and Content-Length is set to
+// the length of the decoded body. Responses without content in the HAR
+// are marked with WARC-Truncated. Entries with status 0, for requests that
+// got no response, are written without a response record.
+func ConvertHAR(har *HAR, writer *WARCWriter) (*HARConversionResult, error) {
+	result := &HARConversionResult{}
+	write := func(record *WARCRecord) error {
+		if _, err := writer.WriteRecord(record); err != nil {
+			return err
+		}
+		result.Records++
+		return nil
+	}
+
+	fields := []string{
+		"software: " + SOFTWARE,
+		"format: " + WARC_FORMATS["1.0"],
+		"conformsTo: " + WARC_SPECIFICATIONS["1.0"],
+	}
+	if creator := har.Log.Creator; creator != nil {
+		fields = append(fields, strings.TrimSpace("description: Converted from HAR created by "+creator.Name+" "+creator.Version))
+	}
+	if browser := har.Log.Browser; browser != nil {
+		fields = append(fields, strings.TrimSpace("har-browser: "+browser.Name+" "+browser.Version))
+	}
+	fields = append(fields, "har-version: "+har.Log.Version)
+	date := time.Now()
+	if len(har.Log.Entries) > 0 {
+		if started, err := time.Parse(time.RFC3339Nano, har.Log.Entries[0].StartedDateTime); err == nil {
+			date = started
+		}
+	}
+	warcinfoId := NewRecordId()
+	warcinfo := NewWARCRecordFromBytes(map[string]string{
+		"WARC-Type":      "warcinfo",
+		"WARC-Record-ID": warcinfoId,
+		"WARC-Date":      FormatDate(date),
+		"Content-Type":   CONTENT_TYPES["warcinfo"],
+	}, []byte(strings.Join(fields, "\r\n")+"\r\n"))
+	if err := write(warcinfo); err != nil {
+		return nil, err
+	}
+
+	pages := map[string]*HARPage{}
+	for _, page := range har.Log.Pages {
+		pages[page.ID] = page
+	}
+	for i, entry := range har.Log.Entries {
+		if entry.Request == nil {
+			return nil, errors.New(fmt.Sprintf("HAR entry %v has no request", i))
+		}
+		target, err := url.Parse(entry.Request.URL)
+		if err != nil || (target.Scheme != "http" && target.Scheme != "https") {
+			result.Skipped++
+			continue
+		}
+		started, err := time.Parse(time.RFC3339Nano, entry.StartedDateTime)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("Bad startedDateTime of HAR entry %v: %v", i, entry.StartedDateTime))
+		}
+		headers := map[string]string{
+			"WARC-Target-URI":  entry.Request.URL,
+			"WARC-Date":        FormatDate(started),
+			"WARC-Warcinfo-ID": warcinfoId,
+		}
+		if ip := strings.Trim(entry.ServerIPAddress, "[]"); ip != "" {
+			headers["WARC-IP-Address"] = ip
+		}
+		newRecord := func(recordType string, block []byte) *WARCRecord {
+			record := NewWARCRecordFromBytes(headers, block)
+			record.Set("WARC-Type", recordType)
+			record.Set("WARC-Record-ID", NewRecordId())
+			record.Set("Content-Type", CONTENT_TYPES[recordType])
+			return record
+		}
+
+		requestBlock, err := harRequestBlock(entry.Request, target)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("HAR entry %v: %v", i, err))
+		}
+		request := newRecord("request", requestBlock)
+		related := request
+		var response *WARCRecord
+		if entry.Response != nil && entry.Response.Status != 0 {
+			responseBlock, complete, err := harResponseBlock(entry.Response)
+			if err != nil {
+				return nil, errors.New(fmt.Sprintf("HAR entry %v: %v", i, err))
+			}
+			response = newRecord("response", responseBlock)
+			if !complete {
+				response.Set("WARC-Truncated", "unspecified")
+			}
+			response.Set("WARC-Payload-Digest", ComputePayloadDigest(response))
+			request.Set("WARC-Concurrent-To", response.GetHeader().GetRecordId())
+			related = response
+		}
+		request.Set("WARC-Payload-Digest", ComputePayloadDigest(request))
+
+		block, err := json.Marshal(&HARMetadata{
+			StartedDateTime: entry.StartedDateTime,
+			Time:            entry.Time,
+			Timings:         entry.Timings,
+			ServerIPAddress: entry.ServerIPAddress,
+			Connection:      entry.Connection,
+			Page:            pages[entry.Pageref],
+			Comment:         entry.Comment,
+		})
+		if err != nil {
+			return nil, err
+		}
+		metadata := newRecord("metadata", block)
+		metadata.Set("Content-Type", HAR_METADATA_CONTENT_TYPE)
+		metadata.Set("WARC-Refers-To", related.GetHeader().GetRecordId())
+		metadata.GetHeader().Delete("WARC-IP-Address")
+
+		for _, record := range []*WARCRecord{request, response, metadata} {
+			if record == nil {
+				continue
+			}
+			if err := write(record); err != nil {
+				return nil, err
+			}
+		}
+		result.Entries++
+	}
+	return result, nil
+}
+
+// Headers of a HAR message that are not written to the rebuilt HTTP/1.1
+// message, because they describe the encoding of the original body
+var HAR_DROPPED_HEADERS []string = []string{"Content-Length", "Content-Encoding", "Transfer-Encoding"}
+
+// Writes the start line and headers of a rebuilt HTTP/1.1 message, leaving
+// out HTTP/2 pseudo headers and the headers in HAR_DROPPED_HEADERS.
+func writeHARHeaders(buffer *bytes.Buffer, startLine string, headers []*HARNameValue, extra []string) {
+	buffer.WriteString(startLine + "\r\n")
+	for _, line := range extra {
+		buffer.WriteString(line + "\r\n")
+	}
+headers:
+	for _, header := range headers {
+		if strings.HasPrefix(header.Name, ":") {
+			continue
+		}
+		for _, dropped := range HAR_DROPPED_HEADERS {
+			if strings.EqualFold(header.Name, dropped) {
+				continue headers
+			}
+		}
+		buffer.WriteString(header.Name + ": " + header.Value + "\r\n")
+	}
+}
+
+func hasHARHeader(headers []*HARNameValue, name string) bool {
+	for _, header := range headers {
+		if strings.EqualFold(header.Name, name) {
+			return true
+		}
+	}
+	return false
+}
+
+func harRequestBlock(request *HARRequest, target *url.URL) ([]byte, error) {
+	body := []byte{}
+	if request.PostData != nil {
+		if request.PostData.Text != "" {
+			body = []byte(request.PostData.Text)
+		} else if len(request.PostData.Params) > 0 {
+			values := url.Values{}
+			for _, param := range request.PostData.Params {
+				values.Add(param.Name, param.Value)
+			}
+			body = []byte(values.Encode())
+		}
+	}
+	extra := []string{}
+	if !hasHARHeader(request.Headers, "Host") {
+		extra = append(extra, "Host: "+target.Host)
+	}
+	if len(body) > 0 {
+		extra = append(extra, "Content-Length: "+strconv.Itoa(len(body)))
+	}
+	method := request.Method
+	if method == "" {
+		method = "GET"
+	}
+	buffer := &bytes.Buffer{}
+	writeHARHeaders(buffer, method+" "+target.RequestURI()+" HTTP/1.1", request.Headers, extra)
+	buffer.WriteString("\r\n")
+	buffer.Write(body)
+	return buffer.Bytes(), nil
+}
+
+// Rebuilds a response, returning false if the HAR has no content for it.
+func harResponseBlock(response *HARResponse) ([]byte, bool, error) {
+	body := []byte{}
+	complete := true
+	if content := response.Content; content != nil {
+		if content.Encoding == "base64" {
+			decoded, err := base64.StdEncoding.DecodeString(content.Text)
+			if err != nil {
+				return nil, false, errors.New(fmt.Sprintf("Bad base64 content: %v", err))
+			}
+			body = decoded
+		} else {
+			body = []byte(content.Text)
+		}
+		complete = content.Text != "" || content.Size <= 0
+	}
+	statusText := response.StatusText
+	if statusText == "" {
+		statusText = http.StatusText(response.Status)
+	}
+	buffer := &bytes.Buffer{}
+	writeHARHeaders(buffer, strings.TrimSpace(fmt.Sprintf("HTTP/1.1 %v %v", response.Status, statusText)),
+		response.Headers, nil)
+	buffer.WriteString("Content-Length: " + strconv.Itoa(len(body)) + "\r\n\r\n")
+	buffer.Write(body)
+	return buffer.Bytes(), complete, nil
+}
+
+// Options for ExportHAR
+type HARExportOptions struct {
+	// Only export the entries of the page with this URL. These are the
+	// entries of the same HAR page if the records were converted from a
+	// HAR, and otherwise the page itself and the entries it led to by
+	// their Referer headers.
+	PageURL string
+}
+
+// An exported entry with the date it is sorted by
+type harExportEntry struct {
+	*HAREntry
+	started time.Time
+	page    *HARPage
+	referer string
+}
+
+// Exports the request and response records read from records as a HAR 1.2
+// log, e.g. to load an archived session into browser developer tools.
+//
+// Request and response records are paired by WARC-Concurrent-To, or else
+// by target URI, and the timings and pages of records converted from a HAR
+// are taken from the metadata records written by ConvertHAR. Response
+// content is decoded and stored as text if it is valid UTF-8, and base64
+// encoded otherwise. A request without a response gives an entry with
+// status 0.
+func ExportHAR(records iter.Seq2[*WARCRecord, error], options HARExportOptions) (*HAR, error) {
+	requests := []*WARCRecord{}
+	responses := []*WARCRecord{}
+	metadata := map[string]*HARMetadata{}
+	for record, err := range records {
+		if err != nil {
+			return nil, err
+		}
+		switch record.GetType() {
+		case "request":
+			requests = append(requests, record)
+		case "response":
+			responses = append(responses, record)
+		case "metadata":
+			contentType, _ := record.Get("Content-Type")
+			refersTo, exists := record.Get("WARC-Refers-To")
+			if exists && contentType == HAR_METADATA_CONTENT_TYPE {
+				entry := &HARMetadata{}
+				if json.Unmarshal(record.GetPayload().GetData(), entry) == nil {
+					metadata[refersTo] = entry
+				}
+			}
+		}
+	}
+
+	// pair the requests and responses
+	requestsById := map[string]*WARCRecord{}
+	requestsByResponse := map[string]*WARCRecord{}
+	requestsByURI := map[string][]*WARCRecord{}
+	for _, request := range requests {
+		requestsById[request.GetHeader().GetRecordId()] = request
+		if concurrentTo, exists := request.Get("WARC-Concurrent-To"); exists {
+			requestsByResponse[concurrentTo] = request
+		} else {
+			requestsByURI[request.GetUrl()] = append(requestsByURI[request.GetUrl()], request)
+		}
+	}
+	paired := map[*WARCRecord]bool{}
+	entries := []*harExportEntry{}
+	for _, response := range responses {
+		id := response.GetHeader().GetRecordId()
+		request := requestsByResponse[id]
+		if concurrentTo, exists := response.Get("WARC-Concurrent-To"); request == nil && exists {
+			request = requestsById[concurrentTo]
+		}
+		if queue := requestsByURI[response.GetUrl()]; request == nil && len(queue) > 0 {
+			request, requestsByURI[response.GetUrl()] = queue[0], queue[1:]
+		}
+		if request != nil {
+			if paired[request] {
+				request = nil
+			} else {
+				paired[request] = true
+			}
+		}
+		entry, err := newHARExportEntry(request, response, metadata[id])
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	for _, request := range requests {
+		if !paired[request] {
+			entry, err := newHARExportEntry(request, nil, metadata[request.GetHeader().GetRecordId()])
+			if err != nil {
+				return nil, err
+			}
+			entries = append(entries, entry)
+		}
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].started.Before(entries[j].started)
+	})
+	if options.PageURL != "" {
+		var err error
+		if entries, err = selectHARPage(entries, options.PageURL); err != nil {
+			return nil, err
+		}
+	}
+
+	log := &HARLog{
+		Version: "1.2",
+		Creator: &HARCreator{Name: SOFTWARE, Version: "1.0"},
+		Pages:   []*HARPage{},
+		Entries: []*HAREntry{},
+	}
+	pages := map[string]bool{}
+	for _, entry := range entries {
+		if entry.page != nil {
+			entry.Pageref = entry.page.ID
+			if !pages[entry.page.ID] {
+				pages[entry.page.ID] = true
+				log.Pages = append(log.Pages, entry.page)
+			}
+		}
+		log.Entries = append(log.Entries, entry.HAREntry)
+	}
+	return &HAR{Log: log}, nil
+}
+
+// Selects the entries of the page with the given URL.
+func selectHARPage(entries []*harExportEntry, pageURL string) ([]*harExportEntry, error) {
+	var page *harExportEntry
+	for _, entry := range entries {
+		if entry.Request.URL == pageURL && entry.Response.Status != 0 {
+			page = entry
+			break
+		}
+	}
+	if page == nil {
+		return nil, errors.New(fmt.Sprintf("No capture of page %v", pageURL))
+	}
+	selected := []*harExportEntry{}
+	if page.page != nil {
+		for _, entry := range entries {
+			if entry.page != nil && entry.page.ID == page.page.ID {
+				selected = append(selected, entry)
+			}
+		}
+		return selected, nil
+	}
+	page.page = &HARPage{
+		StartedDateTime: page.StartedDateTime,
+		ID:              "page_1",
+		Title:           pageURL,
+		PageTimings:     &HARPageTimings{OnContentLoad: -1, OnLoad: -1},
+	}
+	// entries are sorted by date, so resources are found after the
+	// page or stylesheet that refers to them
+	urls := map[string]bool{pageURL: true}
+	for _, entry := range entries {
+		if entry == page || (urls[entry.referer] && !entry.started.Before(page.started)) {
+			entry.page = page.page
+			urls[entry.Request.URL] = true
+			selected = append(selected, entry)
+		}
+	}
+	return selected, nil
+}
+
+func newHARExportEntry(request *WARCRecord, response *WARCRecord, metadata *HARMetadata) (*harExportEntry, error) {
+	record := response
+	if record == nil {
+		record = request
+	}
+	started, err := time.Parse(time.RFC3339Nano, record.GetDate())
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Bad WARC-Date of record %v: %v", record.GetHeader().GetRecordId(), record.GetDate()))
+	}
+	entry := &harExportEntry{HAREntry: &HAREntry{
+		Cache:           map[string]any{},
+		Timings:         &HARTimings{Blocked: -1, DNS: -1, Connect: -1, SSL: -1},
+		ServerIPAddress: record.GetIpAddress(),
+	}}
+	if metadata != nil {
+		if metadataStarted, err := time.Parse(time.RFC3339Nano, metadata.StartedDateTime); err == nil {
+			started = metadataStarted
+		}
+		entry.Time = metadata.Time
+		if metadata.Timings != nil {
+			entry.Timings = metadata.Timings
+		}
+		entry.Connection = metadata.Connection
+		entry.Comment = metadata.Comment
+		entry.page = metadata.Page
+	}
+	entry.started = started
+	entry.StartedDateTime = started.UTC().Format("2006-01-02T15:04:05.000Z")
+
+	entry.Request = &HARRequest{
+		Method:      "GET",
+		URL:         record.GetUrl(),
+		HTTPVersion: "HTTP/1.1",
+		Cookies:     []*HARCookie{},
+		Headers:     []*HARNameValue{},
+		QueryString: harQueryString(record.GetUrl()),
+		HeadersSize: -1,
+	}
+	if request != nil {
+		message, err := request.GetHTTPMessage()
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("Bad HTTP request in record %v: %v", request.GetHeader().GetRecordId(), err))
+		}
+		fields := strings.Fields(message.StartLine)
+		entry.Request.Method = fields[0]
+		if len(fields) > 2 {
+			entry.Request.HTTPVersion = fields[2]
+		}
+		entry.Request.Headers = harHeaders(message)
+		for _, cookie := range (&http.Request{Header: message.Header}).Cookies() {
+			entry.Request.Cookies = append(entry.Request.Cookies, &HARCookie{Name: cookie.Name, Value: cookie.Value})
+		}
+		if len(message.Body) > 0 {
+			entry.Request.PostData = &HARPostData{
+				MimeType: message.Header.Get("Content-Type"),
+				Text:     string(message.Body),
+			}
+		}
+		entry.Request.HeadersSize = int64(len(message.HeaderBytes()))
+		entry.Request.BodySize = int64(len(message.Body))
+		entry.referer = message.Header.Get("Referer")
+	}
+
+	entry.Response = &HARResponse{
+		Cookies: []*HARCookie{},
+		Headers: []*HARNameValue{},
+		Content: &HARContent{Size: 0, MimeType: "x-unknown"},
+		// -1 for requests that got no response
+		HeadersSize: -1,
+		BodySize:    -1,
+	}
+	if response == nil {
+		return entry, nil
+	}
+	message, err := response.GetHTTPMessage()
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Bad HTTP response in record %v: %v", response.GetHeader().GetRecordId(), err))
+	}
+	fields := strings.SplitN(message.StartLine, " ", 3)
+	entry.Response.HTTPVersion = fields[0]
+	entry.Response.Status = message.StatusCode()
+	if len(fields) > 2 {
+		entry.Response.StatusText = fields[2]
+	}
+	entry.Response.Headers = harHeaders(message)
+	for _, cookie := range (&http.Response{Header: message.Header}).Cookies() {
+		harCookie := &HARCookie{
+			Name:     cookie.Name,
+			Value:    cookie.Value,
+			Path:     cookie.Path,
+			Domain:   cookie.Domain,
+			HTTPOnly: cookie.HttpOnly,
+			Secure:   cookie.Secure,
+		}
+		if !cookie.Expires.IsZero() {
+			harCookie.Expires = cookie.Expires.UTC().Format(time.RFC3339)
+		}
+		entry.Response.Cookies = append(entry.Response.Cookies, harCookie)
+	}
+	if location := message.Header.Get("Location"); location != "" {
+		entry.Response.RedirectURL = location
+		if base, err := url.Parse(record.GetUrl()); err == nil {
+			if resolved, err := base.Parse(location); err == nil {
+				entry.Response.RedirectURL = resolved.String()
+			}
+		}
+	}
+	entry.Response.HeadersSize = int64(len(message.HeaderBytes()))
+	entry.Response.BodySize = int64(len(message.Body))
+
+	content := entry.Response.Content
+	if mimeType := message.Header.Get("Content-Type"); mimeType != "" {
+		content.MimeType = mimeType
+	}
+	body, err := message.DecodedBody()
+	if err != nil {
+		body = message.Body
+		content.Comment = fmt.Sprintf("Could not decode the body: %v", err)
+	} else if len(message.Body) > len(body) {
+		content.Compression = int64(len(message.Body) - len(body))
+	}
+	content.Size = int64(len(body))
+	if utf8.Valid(body) && bytes.IndexByte(body, 0) == -1 {
+		content.Text = string(body)
+	} else {
+		content.Text = base64.StdEncoding.EncodeToString(body)
+		content.Encoding = "base64"
+	}
+	return entry, nil
+}
+
+// The headers of a message in their original order and case.
+func harHeaders(message *HTTPMessage) []*HARNameValue {
+	headers := []*HARNameValue{}
+	lines := strings.Split(string(message.HeaderBytes()), "\n")
+	for _, line := range lines[1:] {
+		line = strings.TrimRight(line, "\r")
+		if line == "" {
+			continue
+		}
+		if (line[0] == ' ' || line[0] == '\t') && len(headers) > 0 {
+			// a folded continuation line
+			headers[len(headers)-1].Value += " " + strings.TrimSpace(line)
+			continue
+		}
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) == 2 {
+			headers = append(headers, &HARNameValue{Name: parts[0], Value: strings.TrimSpace(parts[1])})
+		}
+	}
+	return headers
+}
+
+// The query string parameters of a URL in their original order.
+func harQueryString(rawurl string) []*HARNameValue {
+	parameters := []*HARNameValue{}
+	parsed, err := url.Parse(rawurl)
+	if err != nil || parsed.RawQuery == "" {
+		return parameters
+	}
+	for _, parameter := range strings.Split(parsed.RawQuery, "&") {
+		name, value, _ := strings.Cut(parameter, "=")
+		if unescaped, err := url.QueryUnescape(name); err == nil {
+			name = unescaped
+		}
+		if unescaped, err := url.QueryUnescape(value); err == nil {
+			value = unescaped
+		}
+		parameters = append(parameters, &HARNameValue{Name: name, Value: value})
+	}
+	return parameters
+}
@@ -0,0 +1,371 @@
+package warc
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	. "gopkg.in/check.v1"
+	"iter"
+	"net/url"
+	"strings"
+)
+
+type HARSuite struct{}
+
+var harSuite = Suite(&HARSuite{})
+
+var SAMPLE_HAR string = `{
+  "log": {
+    "version": "1.2",
+    "creator": {"name": "WebInspector", "version": "537.36"},
+    "browser": {"name": "Chrome", "version": "120.0"},
+    "pages": [{
+      "startedDateTime": "2024-03-01T10:00:00.000Z",
+      "id": "page_1",
+      "title": "https://example.com/",
+      "pageTimings": {"onContentLoad": 120.5, "onLoad": 250.25}
+    }],
+    "entries": [{
+      "pageref": "page_1",
+      "startedDateTime": "2024-03-01T10:00:00.123Z",
+      "time": 85.5,
+      "request": {
+        "method": "GET",
+        "url": "https://example.com/?q=1",
+        "httpVersion": "h2",
+        "cookies": [],
+        "headers": [
+          {"name": ":authority", "value": "example.com"},
+          {"name": ":method", "value": "GET"},
+          {"name": "accept", "value": "text/html"}
+        ],
+        "queryString": [{"name": "q", "value": "1"}],
+        "headersSize": -1,
+        "bodySize": 0
+      },
+      "response": {
+        "status": 200,
+        "statusText": "",
+        "httpVersion": "h2",
+        "cookies": [],
+        "headers": [
+          {"name": "content-type", "value": "text/html; charset=utf-8"},
+          {"name": "content-encoding", "value": "gzip"},
+          {"name": "content-length", "value": "30"}
+        ],
+        "content": {"size": 13, "mimeType": "text/html", "text": "<p>Hello</p>\n"},
+        "redirectURL": "",
+        "headersSize": -1,
+        "bodySize": 30
+      },
+      "cache": {},
+      "timings": {"blocked": 1.5, "dns": -1, "connect": -1, "send": 0.5, "wait": 80, "receive": 3.5, "ssl": -1},
+      "serverIPAddress": "[2606:2800:220:1::1]"
+    }, {
+      "pageref": "page_1",
+      "startedDateTime": "2024-03-01T10:00:01.000Z",
+      "time": 20,
+      "request": {
+        "method": "POST",
+        "url": "https://example.com/api",
+        "httpVersion": "HTTP/1.1",
+        "cookies": [],
+        "headers": [{"name": "Host", "value": "example.com"}, {"name": "Content-Type", "value": "application/json"}],
+        "queryString": [],
+        "postData": {"mimeType": "application/json", "text": "{\"a\":1}"},
+        "headersSize": 100,
+        "bodySize": 7
+      },
+      "response": {
+        "status": 201,
+        "statusText": "Created",
+        "httpVersion": "HTTP/1.1",
+        "cookies": [],
+        "headers": [{"name": "Content-Type", "value": "image/png"}],
+        "content": {"size": 4, "mimeType": "image/png", "text": "iVBORw==", "encoding": "base64"},
+        "redirectURL": "",
+        "headersSize": 50,
+        "bodySize": 4
+      },
+      "cache": {},
+      "timings": {"send": 1, "wait": 15, "receive": 4}
+    }, {
+      "startedDateTime": "2024-03-01T10:00:02.000Z",
+      "time": 0,
+      "request": {"method": "GET", "url": "data:image/gif;base64,R0lGOD", "httpVersion": "", "cookies": [], "headers": [], "queryString": [], "headersSize": -1, "bodySize": 0},
+      "response": {"status": 200, "statusText": "OK", "httpVersion": "", "cookies": [], "headers": [], "content": {"size": 6, "mimeType": "image/gif"}, "redirectURL": "", "headersSize": -1, "bodySize": 0},
+      "cache": {},
+      "timings": {"send": 0, "wait": 0, "receive": 0}
+    }, {
+      "startedDateTime": "2024-03-01T10:00:03.000Z",
+      "time": 5,
+      "request": {"method": "GET", "url": "http://example.com/blocked.js", "httpVersion": "", "cookies": [], "headers": [], "queryString": [], "headersSize": -1, "bodySize": 0},
+      "response": {"status": 0, "statusText": "", "httpVersion": "", "cookies": [], "headers": [], "content": {"size": 0, "mimeType": "x-unknown"}, "redirectURL": "", "headersSize": -1, "bodySize": -1},
+      "cache": {},
+      "timings": {"send": 0, "wait": 0, "receive": 0},
+      "comment": "net::ERR_BLOCKED_BY_CLIENT"
+    }]
+  }
+}`
+
+func convertSampleHAR(c *C) []*WARCRecord {
+	har, err := ReadHAR(strings.NewReader(SAMPLE_HAR))
+	c.Assert(err, IsNil)
+	out := bytes.Buffer{}
+	result, err := ConvertHAR(har, NewWARCWriter(&out, true))
+	c.Assert(err, IsNil)
+	c.Assert(*result, Equals, HARConversionResult{Entries: 3, Skipped: 1, Records: 9})
+
+	f, err := NewWARCFile(&ClosingBuffer{bytes.NewReader(out.Bytes())})
+	c.Assert(err, IsNil)
+	records := []*WARCRecord{}
+	for record, err := range f.Records() {
+		c.Assert(err, IsNil)
+		records = append(records, record)
+	}
+	report, err := Validate(bytes.NewReader(out.Bytes()), "sample.warc.gz")
+	c.Assert(err, IsNil)
+	c.Assert(report.Issues, HasLen, 0)
+	return records
+}
+
+func (s *HARSuite) TestConvert(c *C) {
+	records := convertSampleHAR(c)
+	types := []string{}
+	for _, record := range records {
+		types = append(types, record.GetType())
+	}
+	c.Assert(types, DeepEquals, []string{"warcinfo",
+		"request", "response", "metadata",
+		"request", "response", "metadata",
+		"request", "metadata"})
+
+	fields := ParseWARCFields(records[0].GetPayload().GetData())
+	c.Assert(fields["description"], Equals, "Converted from HAR created by WebInspector 537.36")
+	c.Assert(fields["har-browser"], Equals, "Chrome 120.0")
+	c.Assert(records[0].GetDate(), Equals, "2024-03-01T10:00:00Z")
+
+	request, response, metadata := records[1], records[2], records[3]
+	c.Assert(request.GetUrl(), Equals, "https://example.com/?q=1")
+	c.Assert(string(request.GetPayload().GetData()), Equals,
+		"GET /?q=1 HTTP/1.1\r\nHost: example.com\r\naccept: text/html\r\n\r\n")
+	concurrentTo, _ := request.Get("WARC-Concurrent-To")
+	c.Assert(concurrentTo, Equals, response.GetHeader().GetRecordId())
+	warcinfoId, _ := response.Get("WARC-Warcinfo-ID")
+	c.Assert(warcinfoId, Equals, records[0].GetHeader().GetRecordId())
+	c.Assert(response.GetIpAddress(), Equals, "2606:2800:220:1::1")
+	c.Assert(string(response.GetPayload().GetData()), Equals,
+		"HTTP/1.1 200 OK\r\ncontent-type: text/html; charset=utf-8\r\nContent-Length: 13\r\n\r\n<p>Hello</p>\n")
+	digest, _ := response.Get("WARC-Payload-Digest")
+	c.Assert(digest, Equals, ComputeDigest([]byte("<p>Hello</p>\n")))
+
+	contentType, _ := metadata.Get("Content-Type")
+	c.Assert(contentType, Equals, HAR_METADATA_CONTENT_TYPE)
+	refersTo, _ := metadata.Get("WARC-Refers-To")
+	c.Assert(refersTo, Equals, response.GetHeader().GetRecordId())
+	entry := &HARMetadata{}
+	c.Assert(json.Unmarshal(metadata.GetPayload().GetData(), entry), IsNil)
+	c.Assert(entry.StartedDateTime, Equals, "2024-03-01T10:00:00.123Z")
+	c.Assert(entry.Time, Equals, 85.5)
+	c.Assert(*entry.Timings, Equals, HARTimings{Blocked: 1.5, DNS: -1, Connect: -1, Send: 0.5, Wait: 80, Receive: 3.5, SSL: -1})
+	c.Assert(entry.Page.Title, Equals, "https://example.com/")
+	c.Assert(entry.Page.PageTimings.OnLoad, Equals, 250.25)
+
+	c.Assert(string(records[4].GetPayload().GetData()), Equals,
+		"POST /api HTTP/1.1\r\nContent-Length: 7\r\nHost: example.com\r\nContent-Type: application/json\r\n\r\n{\"a\":1}")
+	message, err := records[5].GetHTTPMessage()
+	c.Assert(err, IsNil)
+	c.Assert(message.StartLine, Equals, "HTTP/1.1 201 Created")
+	c.Assert(message.Body, DeepEquals, []byte("\x89PNG"))
+
+	_, exists := records[7].Get("WARC-Concurrent-To")
+	c.Assert(exists, Equals, false)
+	refersTo, _ = records[8].Get("WARC-Refers-To")
+	c.Assert(refersTo, Equals, records[7].GetHeader().GetRecordId())
+	c.Assert(json.Unmarshal(records[8].GetPayload().GetData(), entry), IsNil)
+	c.Assert(entry.Comment, Equals, "net::ERR_BLOCKED_BY_CLIENT")
+}
+
+func (s *HARSuite) TestMissingContent(c *C) {
+	har, err := ReadHAR(strings.NewReader(SAMPLE_HAR))
+	c.Assert(err, IsNil)
+	har.Log.Entries[0].Response.Content.Text = ""
+	out := bytes.Buffer{}
+	_, err = ConvertHAR(har, NewWARCWriter(&out, false))
+	c.Assert(err, IsNil)
+	record, err := ReadRecordAt(bytes.NewReader(out.Bytes()), int64(bytes.Index(out.Bytes(), []byte("WARC/1.0\r\nWARC-Type: response"))))
+	c.Assert(err, IsNil)
+	truncated, _ := record.Get("WARC-Truncated")
+	c.Assert(truncated, Equals, "unspecified")
+}
+
+func (s *HARSuite) TestErrors(c *C) {
+	_, err := ReadHAR(strings.NewReader("{}"))
+	c.Assert(err, ErrorMatches, "Bad HAR file: no log")
+	_, err = ReadHAR(strings.NewReader("<html>"))
+	c.Assert(err, ErrorMatches, "Bad HAR file: .*")
+
+	har, err := ReadHAR(strings.NewReader(SAMPLE_HAR))
+	c.Assert(err, IsNil)
+	har.Log.Entries[1].StartedDateTime = "yesterday"
+	_, err = ConvertHAR(har, NewWARCWriter(&bytes.Buffer{}, false))
+	c.Assert(err, ErrorMatches, "Bad startedDateTime of HAR entry 1: yesterday")
+
+	har.Log.Entries[1].StartedDateTime = "2024-03-01T10:00:01.000Z"
+	har.Log.Entries[1].Response.Content.Text = "!!"
+	_, err = ConvertHAR(har, NewWARCWriter(&bytes.Buffer{}, false))
+	c.Assert(err, ErrorMatches, "HAR entry 1: Bad base64 content: .*")
+}
+
+func exportRecords(records []*WARCRecord) iter.Seq2[*WARCRecord, error] {
+	return func(yield func(*WARCRecord, error) bool) {
+		for _, record := range records {
+			if !yield(record, nil) {
+				return
+			}
+		}
+	}
+}
+
+func (s *HARSuite) TestExportRoundTrip(c *C) {
+	har, err := ExportHAR(exportRecords(convertSampleHAR(c)), HARExportOptions{})
+	c.Assert(err, IsNil)
+	c.Assert(har.Log.Version, Equals, "1.2")
+	c.Assert(har.Log.Pages, HasLen, 1)
+	c.Assert(har.Log.Pages[0].ID, Equals, "page_1")
+	c.Assert(har.Log.Entries, HasLen, 3)
+
+	entry := har.Log.Entries[0]
+	c.Assert(entry.Pageref, Equals, "page_1")
+	c.Assert(entry.StartedDateTime, Equals, "2024-03-01T10:00:00.123Z")
+	c.Assert(entry.Time, Equals, 85.5)
+	c.Assert(entry.Timings.Wait, Equals, 80.0)
+	c.Assert(entry.ServerIPAddress, Equals, "2606:2800:220:1::1")
+	c.Assert(entry.Request.Method, Equals, "GET")
+	c.Assert(entry.Request.URL, Equals, "https://example.com/?q=1")
+	c.Assert(entry.Request.QueryString, DeepEquals, []*HARNameValue{{Name: "q", Value: "1"}})
+	c.Assert(entry.Request.Headers, DeepEquals, []*HARNameValue{
+		{Name: "Host", Value: "example.com"}, {Name: "accept", Value: "text/html"}})
+	c.Assert(entry.Response.Status, Equals, 200)
+	c.Assert(entry.Response.StatusText, Equals, "OK")
+	c.Assert(*entry.Response.Content, Equals, HARContent{Size: 13, MimeType: "text/html; charset=utf-8", Text: "<p>Hello</p>\n"})
+
+	entry = har.Log.Entries[1]
+	c.Assert(entry.Request.Method, Equals, "POST")
+	c.Assert(*entry.Request.PostData, DeepEquals, HARPostData{MimeType: "application/json", Text: "{\"a\":1}"})
+	c.Assert(*entry.Response.Content, Equals, HARContent{Size: 4, MimeType: "image/png", Text: "iVBORw==", Encoding: "base64"})
+
+	entry = har.Log.Entries[2]
+	c.Assert(entry.Request.URL, Equals, "http://example.com/blocked.js")
+	c.Assert(entry.Response.Status, Equals, 0)
+	c.Assert(entry.Comment, Equals, "net::ERR_BLOCKED_BY_CLIENT")
+
+	// the result is valid JSON that reads back in
+	data, err := json.Marshal(har)
+	c.Assert(err, IsNil)
+	_, err = ReadHAR(bytes.NewReader(data))
+	c.Assert(err, IsNil)
+}
+
+// Builds a request and response pair as a crawler would write them, without HAR metadata
+func crawledRecords(uri string, date string, referer string, responseHead string, body []byte, concurrent bool) []*WARCRecord {
+	target, _ := url.Parse(uri)
+	requestBlock := "GET " + target.RequestURI() + " HTTP/1.1\r\nHost: " + target.Host + "\r\n"
+	if referer != "" {
+		requestBlock += "Referer: " + referer + "\r\n"
+	}
+	response := NewWARCRecordFromBytes(map[string]string{
+		"WARC-Type":       "response",
+		"WARC-Date":       date,
+		"WARC-Target-URI": uri,
+		"Content-Type":    CONTENT_TYPES["response"],
+	}, append([]byte(responseHead+"\r\n\r\n"), body...))
+	request := NewWARCRecordFromBytes(map[string]string{
+		"WARC-Type":       "request",
+		"WARC-Date":       date,
+		"WARC-Target-URI": uri,
+		"Content-Type":    CONTENT_TYPES["request"],
+	}, []byte(requestBlock+"\r\n"))
+	if concurrent {
+		request.Set("WARC-Concurrent-To", response.GetHeader().GetRecordId())
+	}
+	return []*WARCRecord{request, response}
+}
+
+func (s *HARSuite) TestExportCrawl(c *C) {
+	compressed := bytes.Buffer{}
+	gzipWriter := gzip.NewWriter(&compressed)
+	gzipWriter.Write([]byte("body { color: red }"))
+	gzipWriter.Close()
+
+	records := []*WARCRecord{}
+	records = append(records, crawledRecords("http://example.com/", "2024-03-01T10:00:00Z", "",
+		"HTTP/1.1 200 OK\r\nContent-Type: text/html\r\nSet-Cookie: session=abc; Path=/; HttpOnly", []byte("<html></html>"), true)...)
+	// paired by target URI
+	records = append(records, crawledRecords("http://example.com/style.css", "2024-03-01T10:00:01Z", "http://example.com/",
+		"HTTP/1.1 200 OK\r\nContent-Type: text/css\r\nContent-Encoding: gzip", compressed.Bytes(), false)...)
+	records = append(records, crawledRecords("http://example.com/font.woff", "2024-03-01T10:00:02Z", "http://example.com/style.css",
+		"HTTP/1.1 200 OK\r\nContent-Type: font/woff", []byte{0, 1, 2, 0xff}, true)...)
+	records = append(records, crawledRecords("http://example.com/old", "2024-03-01T10:00:03Z", "",
+		"HTTP/1.1 301 Moved Permanently\r\nLocation: /new", nil, true)...)
+	// requested before the page
+	records = append(records, crawledRecords("http://example.com/early.js", "2024-03-01T09:00:00Z", "http://example.com/",
+		"HTTP/1.1 200 OK", nil, true)...)
+
+	har, err := ExportHAR(exportRecords(records), HARExportOptions{})
+	c.Assert(err, IsNil)
+	urls := []string{}
+	for _, entry := range har.Log.Entries {
+		urls = append(urls, entry.Request.URL)
+	}
+	c.Assert(urls, DeepEquals, []string{"http://example.com/early.js", "http://example.com/",
+		"http://example.com/style.css", "http://example.com/font.woff", "http://example.com/old"})
+	c.Assert(har.Log.Pages, HasLen, 0)
+
+	entry := har.Log.Entries[1]
+	c.Assert(entry.StartedDateTime, Equals, "2024-03-01T10:00:00.000Z")
+	c.Assert(entry.Response.Cookies, DeepEquals, []*HARCookie{{Name: "session", Value: "abc", Path: "/", HTTPOnly: true}})
+	entry = har.Log.Entries[2]
+	c.Assert(entry.Request.Headers[1], DeepEquals, &HARNameValue{Name: "Referer", Value: "http://example.com/"})
+	c.Assert(entry.Response.Content.Text, Equals, "body { color: red }")
+	c.Assert(entry.Response.Content.Compression, Equals, int64(compressed.Len()-19))
+	c.Assert(entry.Response.BodySize, Equals, int64(compressed.Len()))
+	entry = har.Log.Entries[3]
+	c.Assert(entry.Response.Content.Encoding, Equals, "base64")
+	c.Assert(entry.Response.Content.Text, Equals, "AAEC/w==")
+	c.Assert(har.Log.Entries[4].Response.RedirectURL, Equals, "http://example.com/new")
+
+	har, err = ExportHAR(exportRecords(records), HARExportOptions{PageURL: "http://example.com/"})
+	c.Assert(err, IsNil)
+	urls = []string{}
+	for _, entry := range har.Log.Entries {
+		c.Assert(entry.Pageref, Equals, "page_1")
+		urls = append(urls, entry.Request.URL)
+	}
+	c.Assert(urls, DeepEquals, []string{"http://example.com/",
+		"http://example.com/style.css", "http://example.com/font.woff"})
+	c.Assert(har.Log.Pages, HasLen, 1)
+	c.Assert(har.Log.Pages[0].Title, Equals, "http://example.com/")
+
+	_, err = ExportHAR(exportRecords(records), HARExportOptions{PageURL: "http://example.com/missing"})
+	c.Assert(err, ErrorMatches, "No capture of page http://example.com/missing")
+}
+
+func (s *HARSuite) TestExportPageFromHAR(c *C) {
+	har, err := ReadHAR(strings.NewReader(SAMPLE_HAR))
+	c.Assert(err, IsNil)
+	har.Log.Entries[1].Pageref = "page_2"
+	har.Log.Pages = append(har.Log.Pages, &HARPage{ID: "page_2", Title: "API", PageTimings: &HARPageTimings{}})
+	out := bytes.Buffer{}
+	_, err = ConvertHAR(har, NewWARCWriter(&out, false))
+	c.Assert(err, IsNil)
+	f, err := NewWARCFile(&ClosingBuffer{bytes.NewReader(out.Bytes())})
+	c.Assert(err, IsNil)
+
+	exported, err := ExportHAR(f.Records(), HARExportOptions{PageURL: "https://example.com/api"})
+	c.Assert(err, IsNil)
+	c.Assert(exported.Log.Pages, HasLen, 1)
+	c.Assert(exported.Log.Pages[0].Title, Equals, "API")
+	c.Assert(exported.Log.Entries, HasLen, 1)
+	c.Assert(exported.Log.Entries[0].Pageref, Equals, "page_2")
+}
@@ -0,0 +1,175 @@
+package warc
+
+/*
+	Copyright (C) 2015  Wolfgang Meyers
+
+    This program is free software; you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation; either version 2 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License along
+    with this program; if not, write to the Free Software Foundation, Inc.,
+    51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+*/
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"github.com/klauspost/compress/zstd"
+	"io"
+	"net/http"
+	"net/http/httputil"
+	"net/textproto"
+	"strconv"
+	"strings"
+)
+
+// HTTPMessage is the HTTP request or response carried in the payload
+// of a request, response or revisit record.
+type HTTPMessage struct {
+	// The request or status line, without the trailing CRLF
+	StartLine string
+	Header    http.Header
+	// The entity body, exactly as stored in the record
+	Body []byte
+	// The raw start line and headers, including the blank line that ends them
+	headerBytes []byte
+}
+
+// Parses an HTTP message from the block of a request, response or revisit record.
+// The body is left as stored, i.e. any transfer or content encoding is not removed.
+func ParseHTTPMessage(block []byte) (*HTTPMessage, error) {
+	headerEnd := bytes.Index(block, []byte("\r\n\r\n"))
+	bodyStart := headerEnd + 4
+	if headerEnd == -1 {
+		// tolerate bare LF line endings written by some old crawlers
+		headerEnd = bytes.Index(block, []byte("\n\n"))
+		bodyStart = headerEnd + 2
+	}
+	if headerEnd == -1 {
+		// a revisit record may contain only headers with no blank line
+		if len(block) == 0 {
+			return nil, errors.New("Empty HTTP message")
+		}
+		headerEnd = len(block)
+		bodyStart = len(block)
+	}
+	reader := textproto.NewReader(bufio.NewReader(bytes.NewReader(block[:bodyStart])))
+	startLine, err := reader.ReadLine()
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(startLine, "HTTP/") && !strings.Contains(startLine, " HTTP/") {
+		return nil, errors.New("Bad HTTP start line: " + startLine)
+	}
+	header, err := reader.ReadMIMEHeader()
+	if err != nil && header == nil {
+		return nil, err
+	}
+	return &HTTPMessage{
+		StartLine:   startLine,
+		Header:      http.Header(header),
+		Body:        block[bodyStart:],
+		headerBytes: block[:bodyStart],
+	}, nil
+}
+
+// Parses the payload of this record as an HTTP message.
+func (wr *WARCRecord) GetHTTPMessage() (*HTTPMessage, error) {
+	if wr.payload == nil {
+		return nil, errors.New("Record has no payload")
+	}
+	return ParseHTTPMessage(wr.payload.GetData())
+}
+
+// The raw start line and headers of the message, including the blank line that ends them.
+func (hm *HTTPMessage) HeaderBytes() []byte {
+	return hm.headerBytes
+}
+
+// The status code of a response, or 0 if this is a request or the status line is malformed.
+func (hm *HTTPMessage) StatusCode() int {
+	if !strings.HasPrefix(hm.StartLine, "HTTP/") {
+		return 0
+	}
+	fields := strings.Fields(hm.StartLine)
+	if len(fields) < 2 {
+		return 0
+	}
+	code, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return 0
+	}
+	return code
+}
+
+// Returns the body with any chunked transfer encoding and gzip, deflate
+// or zstd content encoding removed.
+func (hm *HTTPMessage) DecodedBody() ([]byte, error) {
+	var reader io.Reader = bytes.NewReader(hm.Body)
+	if strings.Contains(strings.ToLower(hm.Header.Get("Transfer-Encoding")), "chunked") {
+		reader = httputil.NewChunkedReader(reader)
+	}
+	encodings := strings.Split(hm.Header.Get("Content-Encoding"), ",")
+	// encodings are listed in the order in which they were applied
+	for i := len(encodings) - 1; i >= 0; i-- {
+		switch encoding := strings.ToLower(strings.TrimSpace(encodings[i])); encoding {
+		case "", "identity":
+		case "gzip", "x-gzip":
+			gzipReader, err := gzip.NewReader(reader)
+			if err != nil {
+				return nil, err
+			}
+			reader = gzipReader
+		case "deflate":
+			// usually zlib wrapped, but raw deflate is seen as well
+			buffered := bufio.NewReader(reader)
+			if header, err := buffered.Peek(2); err == nil && (uint16(header[0])<<8|uint16(header[1]))%31 == 0 && header[0]&0x0f == 8 {
+				zlibReader, err := zlib.NewReader(buffered)
+				if err != nil {
+					return nil, err
+				}
+				reader = zlibReader
+			} else {
+				reader = flate.NewReader(buffered)
+			}
+		case "zstd":
+			decoder, err := zstd.NewReader(reader, zstd.WithDecoderConcurrency(1))
+			if err != nil {
+				return nil, err
+			}
+			defer decoder.Close()
+			reader = decoder
+		default:
+			return nil, errors.New(fmt.Sprintf("Unsupported content encoding: %v", encoding))
+		}
+	}
+	return io.ReadAll(reader)
+}
+
+// Computes the WARC-Payload-Digest of a record: the digest of the HTTP entity
+// body for request, response and revisit records, and of the whole block otherwise.
+func ComputePayloadDigest(record *WARCRecord) string {
+	data := []byte{}
+	if record.payload != nil {
+		data = record.payload.GetData()
+	}
+	contentType, _ := record.Get("Content-Type")
+	if strings.HasPrefix(contentType, "application/http") {
+		message, err := ParseHTTPMessage(data)
+		if err == nil {
+			data = message.Body
+		}
+	}
+	return ComputeDigest(data)
+}
@@ -0,0 +1,125 @@
+package warc
+
+/*
+	Copyright (C) 2015  Wolfgang Meyers
+
+    This program is free software; you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation; either version 2 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License along
+    with this program; if not, write to the Free Software Foundation, Inc.,
+    51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+*/
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+)
+
+var GZIP_MAGIC []byte = []byte{0x1f, 0x8b, 0x08}
+
+// A ReadError describes a record that a lenient reader could not read.
+type ReadError struct {
+	// The offset of the record, or of the gzip member or zstd frame holding it
+	Offset int64
+	// The number of bytes from Offset to the offset of the next record
+	// that was found, or to the end of the file
+	Skipped int64
+	Err     error
+}
+
+func (re *ReadError) Error() string {
+	return fmt.Sprintf("Skipped %v bytes at offset %v: %v", re.Skipped, re.Offset, re.Err)
+}
+
+// Skips forward to the next line that starts with "WARC/", or to the next
+// gzip member or zstd frame if the current one is corrupt. Returns the
+// offset of the record found there, or io.EOF at the end of the file.
+func (rs *recordStream) resync() (int64, error) {
+	for {
+		err := rs.scanVersionLine()
+		if err == nil {
+			return rs.next()
+		}
+		if !rs.compressed() {
+			return -1, err
+		}
+		if err == io.EOF {
+			err = rs.nextMember()
+			if err == nil || err == io.EOF {
+				if err == io.EOF {
+					return -1, err
+				}
+				continue
+			}
+		}
+		// the member or frame is corrupt
+		if err := rs.scanMember(); err != nil {
+			return -1, err
+		}
+	}
+}
+
+// Skips to the next line that starts with "WARC/", which may be the current one.
+func (rs *recordStream) scanVersionLine() error {
+	lineStart := true
+	for {
+		if lineStart {
+			b, err := rs.reader.Peek(5)
+			if err == nil && string(b) == "WARC/" {
+				return nil
+			}
+		}
+		_, err := rs.reader.ReadSlice('\n')
+		if err == bufio.ErrBufferFull {
+			lineStart = false
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		lineStart = true
+	}
+}
+
+// Scans the file for the magic number of the next gzip member or zstd
+// frame, and starts decompressing it.
+func (rs *recordStream) scanMember() error {
+	filebuf, ok := rs.source.(*bufio.Reader)
+	if !ok {
+		return io.ErrUnexpectedEOF
+	}
+	magic := GZIP_MAGIC
+	if rs.zstdfile != nil {
+		magic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+	}
+	for {
+		buf, _ := filebuf.Peek(filebuf.Size())
+		if len(buf) < len(magic) {
+			filebuf.Discard(len(buf))
+			return io.EOF
+		}
+		i := bytes.Index(buf, magic)
+		if i < 0 {
+			filebuf.Discard(len(buf) - len(magic) + 1)
+			continue
+		}
+		filebuf.Discard(i)
+		start := rs.position()
+		if err := rs.nextMember(); err == nil {
+			return nil
+		}
+		// not a member after all, or a corrupt one
+		if rs.position() == start {
+			filebuf.Discard(1)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package warc
+
+import (
+	"bytes"
+	"fmt"
+	. "gopkg.in/check.v1"
+)
+
+type LenientSuite struct{}
+
+var lenientSuite = Suite(&LenientSuite{})
+
+// Writes three records, returning the file and the offsets of the records.
+func writeLenientSample(compress bool) ([]byte, []int64) {
+	records := getSampleRecords(4, map[string]string{
+		"WARC-Type": "resource",
+	}, func(i int) []byte {
+		return bytes.Repeat([]byte(fmt.Sprintf("record %v\n", i)), 100)
+	})[1:]
+	for i, record := range records {
+		record.Set("WARC-Record-ID", fmt.Sprintf("<urn:uuid:%v>", i+1))
+	}
+	buf := bytes.Buffer{}
+	offsets, _ := writeSampleRecords(NewWARCWriter(&buf, compress), records)
+	return buf.Bytes(), offsets
+}
+
+// Reads a file leniently, returning the URLs of the records and the errors.
+func readLeniently(c *C, data []byte) ([]string, []*ReadError) {
+	f, err := NewWARCFile(&ClosingBuffer{bytes.NewReader(data)})
+	c.Assert(err, IsNil)
+	errors := []*ReadError{}
+	f.GetReader().SetLenient(func(err *ReadError) {
+		errors = append(errors, err)
+	})
+	urls := []string{}
+	for {
+		record, err := f.ReadRecord()
+		if err != nil {
+			c.Assert(err.Error(), Equals, "EOF")
+			break
+		}
+		urls = append(urls, record.GetUrl())
+	}
+	return urls, errors
+}
+
+func (s *LenientSuite) TestBadHeader(c *C) {
+	data, offsets := writeLenientSample(false)
+	data = bytes.Replace(data, []byte("WARC-Record-ID: <urn:uuid:2>"), []byte("WARC-Record-ID <urn uuid 2>"), 1)
+	urls, errors := readLeniently(c, data)
+	c.Assert(urls, DeepEquals, []string{"http://example.com/1", "http://example.com/3"})
+	c.Assert(len(errors), Equals, 1)
+	c.Assert(errors[0].Offset, Equals, offsets[1])
+	c.Assert(errors[0].Skipped, Equals, offsets[2]-offsets[1]-1)
+	c.Assert(errors[0].Error(), Matches, "(?s)Skipped .* bytes at offset .*: Bad header line: .*")
+
+	// strict reading stops at the bad record
+	f, err := NewWARCFile(&ClosingBuffer{bytes.NewReader(data)})
+	c.Assert(err, IsNil)
+	_, err = f.ReadRecord()
+	c.Assert(err, IsNil)
+	_, err = f.ReadRecord()
+	c.Assert(err, ErrorMatches, "(?s)Bad header line: .*")
+}
+
+func (s *LenientSuite) TestWrongLength(c *C) {
+	data, _ := writeLenientSample(false)
+	data = bytes.Replace(data, []byte("Content-Length: 900"), []byte("Content-Length: 1200"), 1)
+	urls, errors := readLeniently(c, data)
+	// the first record swallows the start of the second one
+	c.Assert(urls, DeepEquals, []string{"http://example.com/3"})
+	c.Assert(len(errors), Equals, 1)
+	c.Assert(errors[0].Offset, Equals, int64(0))
+}
+
+func (s *LenientSuite) TestHugeLength(c *C) {
+	data, offsets := writeLenientSample(false)
+	data = append(data[:offsets[2]], bytes.Replace(data[offsets[2]:], []byte("Content-Length: 900"), []byte("Content-Length: 9000000000000000000"), 1)...)
+	urls, errors := readLeniently(c, data)
+	c.Assert(urls, DeepEquals, []string{"http://example.com/1", "http://example.com/2"})
+	c.Assert(len(errors), Equals, 1)
+	c.Assert(errors[0].Offset, Equals, offsets[2])
+	c.Assert(errors[0].Error(), Matches, "Skipped .* bytes at offset .*: Truncated record at offset .* of 9000000000000000000 bytes")
+
+	f, err := NewWARCFile(&ClosingBuffer{bytes.NewReader(data)})
+	c.Assert(err, IsNil)
+	for i := 0; i < 2; i++ {
+		_, err = f.ReadRecord()
+		c.Assert(err, IsNil)
+	}
+	_, err = f.ReadRecord()
+	c.Assert(err, ErrorMatches, "Truncated record at offset .*: 904 of 9000000000000000000 bytes")
+}
+
+func (s *LenientSuite) TestCorruptGzipMember(c *C) {
+	data, offsets := writeLenientSample(true)
+	// damage the compressed data of the second member
+	for i := offsets[1] + 20; i < offsets[1]+40; i++ {
+		data[i] ^= 0xff
+	}
+	urls, errors := readLeniently(c, data)
+	c.Assert(urls, DeepEquals, []string{"http://example.com/1", "http://example.com/3"})
+	c.Assert(len(errors), Equals, 1)
+	c.Assert(errors[0].Offset, Equals, offsets[1])
+	c.Assert(errors[0].Skipped, Equals, offsets[2]-offsets[1])
+}
+
+func (s *LenientSuite) TestGarbageBetweenMembers(c *C) {
+	data, offsets := writeLenientSample(true)
+	garbage := bytes.Repeat([]byte("garbage"), 1000)
+	damaged := append(append(append([]byte{}, data[:offsets[2]]...), garbage...), data[offsets[2]:]...)
+	urls, errors := readLeniently(c, damaged)
+	c.Assert(urls, DeepEquals, []string{"http://example.com/1", "http://example.com/2", "http://example.com/3"})
+	c.Assert(len(errors), Equals, 1)
+	c.Assert(errors[0].Offset, Equals, offsets[2])
+	c.Assert(errors[0].Skipped, Equals, int64(len(garbage)))
+}
+
+func (s *LenientSuite) TestTruncated(c *C) {
+	data, offsets := writeLenientSample(false)
+	urls, errors := readLeniently(c, data[:len(data)-100])
+	c.Assert(urls, DeepEquals, []string{"http://example.com/1", "http://example.com/2"})
+	c.Assert(len(errors), Equals, 1)
+	c.Assert(errors[0].Offset, Equals, offsets[2])
+	c.Assert(errors[0].Skipped, Equals, int64(len(data)-100)-offsets[2])
+}
@@ -0,0 +1,223 @@
+package warc
+
+/*
+	Copyright (C) 2015  Wolfgang Meyers
+
+    This program is free software; you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation; either version 2 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License along
+    with this program; if not, write to the Free Software Foundation, Inc.,
+    51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+*/
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"iter"
+	"runtime"
+	"sort"
+	"sync"
+)
+
+// Options for ReadParallel
+type ParallelReadOptions struct {
+	// The number of byte ranges decoded at the same time. Defaults to the number of CPUs.
+	Workers int
+	// The number of byte ranges to split the file into. Defaults to four times
+	// the number of workers, so that workers that finish early can take on more.
+	Ranges int
+	// Offsets of records in the file, for instance from the Location of CDX
+	// entries. If set, ranges start at these offsets instead of at gzip
+	// members or zstd frames found by scanning the file. This is the only
+	// way to split uncompressed files.
+	Offsets []int64
+}
+
+// The size of the chunks that are scanned for gzip members and zstd frames
+var SCAN_CHUNK_SIZE int = 64 * 1024
+
+// Splits a WARC file of the given size into at most parts byte ranges that
+// start with a record, returning the offsets at which the ranges start, the
+// first of which is 0. If offsets is empty, ranges start at gzip members or
+// zstd frames, found by scanning the file for their magic numbers and
+// checking that a record can be read there, so that the ranges can be
+// decompressed independently. Uncompressed files are only split at offsets.
+func SplitWARC(reader io.ReaderAt, size int64, parts int, offsets []int64) ([]int64, error) {
+	starts := []int64{0}
+	if offsets != nil {
+		offsets = append([]int64{}, offsets...)
+		sort.Slice(offsets, func(i, j int) bool { return offsets[i] < offsets[j] })
+	}
+	var magic []byte
+	if offsets == nil {
+		header := make([]byte, 4)
+		reader.ReadAt(header, 0)
+		if bytes.HasPrefix(header, GZIP_MAGIC) {
+			magic = GZIP_MAGIC
+		} else if isZstd(bufio.NewReader(bytes.NewReader(header))) {
+			magic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+		} else {
+			return starts, nil
+		}
+	}
+	for i := 1; i < parts; i++ {
+		point := size * int64(i) / int64(parts)
+		if point <= starts[len(starts)-1] {
+			continue
+		}
+		var start int64
+		if offsets != nil {
+			j := sort.Search(len(offsets), func(j int) bool { return offsets[j] >= point })
+			if j == len(offsets) {
+				break
+			}
+			start = offsets[j]
+		} else {
+			var err error
+			if start, err = findMember(reader, size, point, magic); err != nil {
+				return nil, err
+			}
+		}
+		if start >= size {
+			break
+		}
+		if start > starts[len(starts)-1] {
+			starts = append(starts, start)
+		}
+	}
+	return starts, nil
+}
+
+// Finds the first gzip member or zstd frame at or after from that holds a
+// record, returning size if there is none.
+func findMember(reader io.ReaderAt, size int64, from int64, magic []byte) (int64, error) {
+	chunk := make([]byte, SCAN_CHUNK_SIZE+len(magic)-1)
+	for position := from; position < size; position += int64(SCAN_CHUNK_SIZE) {
+		n, err := reader.ReadAt(chunk, position)
+		if err != nil && err != io.EOF {
+			return -1, err
+		}
+		for i := 0; i < n; {
+			j := bytes.Index(chunk[i:n], magic)
+			if j < 0 || i+j >= SCAN_CHUNK_SIZE {
+				break
+			}
+			candidate := position + int64(i+j)
+			if _, err := ReadRecordAt(reader, candidate); err == nil {
+				return candidate, nil
+			}
+			i += j + 1
+		}
+	}
+	return size, nil
+}
+
+// Reads the records of a WARC file of the given size on several cores.
+// The file is split into byte ranges with SplitWARC, which are decoded at
+// the same time. The records of each range are yielded in order, but the
+// ranges are interleaved, so records are not in the order of the file;
+// their offsets are the offsets in the file. The first error ends the
+// iteration, as does breaking out of the loop or ctx being done.
+func ReadParallel(ctx context.Context, reader io.ReaderAt, size int64, options ParallelReadOptions) iter.Seq2[*WARCRecord, error] {
+	return func(yield func(*WARCRecord, error) bool) {
+		workers := options.Workers
+		if workers <= 0 {
+			workers = runtime.NumCPU()
+		}
+		parts := options.Ranges
+		if parts <= 0 {
+			parts = 4 * workers
+		}
+		starts, err := SplitWARC(reader, size, parts, options.Offsets)
+		if err != nil {
+			yield(nil, err)
+			return
+		}
+		dictionary, err := readZstdDictionaryAt(reader)
+		if err != nil {
+			yield(nil, err)
+			return
+		}
+		ctx, cancel := context.WithCancel(ctx)
+		ranges := make(chan int, len(starts))
+		for i := range starts {
+			ranges <- i
+		}
+		close(ranges)
+		type result struct {
+			record *WARCRecord
+			err    error
+		}
+		results := make(chan result, workers)
+		send := func(record *WARCRecord, err error) bool {
+			select {
+			case results <- result{record, err}:
+				return err == nil
+			case <-ctx.Done():
+				return false
+			}
+		}
+		wg := sync.WaitGroup{}
+		for w := 0; w < workers; w++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := range ranges {
+					start, end := starts[i], size
+					if i+1 < len(starts) {
+						end = starts[i+1]
+					}
+					if !readRange(ctx, reader, start, end, dictionary, send) {
+						return
+					}
+				}
+			}()
+		}
+		go func() {
+			wg.Wait()
+			close(results)
+		}()
+		defer func() {
+			cancel()
+			for range results {
+			}
+		}()
+		for result := range results {
+			if !yield(result.record, result.err) || result.err != nil {
+				return
+			}
+		}
+		if err := ctx.Err(); err != nil {
+			yield(nil, err)
+		}
+	}
+}
+
+// Reads the records of the byte range from start to end, passing them to
+// send with their offsets in the file. Returns false if send does.
+func readRange(ctx context.Context, reader io.ReaderAt, start int64, end int64, dictionary []byte,
+	send func(*WARCRecord, error) bool) bool {
+	wf, err := newWARCFile(io.NopCloser(io.NewSectionReader(reader, start, end-start)), dictionary)
+	if err != nil {
+		return send(nil, err)
+	}
+	for record, err := range wf.RecordsContext(ctx) {
+		if err != nil {
+			return send(nil, err)
+		}
+		record.offset += int(start)
+		if !send(record, nil) {
+			return false
+		}
+	}
+	return true
+}
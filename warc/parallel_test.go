@@ -0,0 +1,151 @@
+package warc
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	. "gopkg.in/check.v1"
+)
+
+type ParallelSuite struct{}
+
+var parallelSuite = Suite(&ParallelSuite{})
+
+func getParallelRecords(count int) []*WARCRecord {
+	return getSampleRecords(count, map[string]string{
+		"WARC-Type":    "response",
+		"Content-Type": CONTENT_TYPES["response"],
+	}, func(i int) []byte {
+		return []byte(fmt.Sprintf("HTTP/1.1 200 OK\r\nContent-Type: text/plain\r\n\r\nrecord %v", i))
+	})
+}
+
+// Writes records with writer, returning the offsets of the records.
+func writeParallelFile(c *C, writer *WARCWriter, records []*WARCRecord) []int64 {
+	offsets, err := writeSampleRecords(writer, records)
+	c.Assert(err, IsNil)
+	return offsets
+}
+
+// Reads a file in parallel, checking that each record is found at its offset.
+func checkParallelRead(c *C, data []byte, offsets []int64, options ParallelReadOptions) {
+	urls := map[int]string{}
+	for record, err := range ReadParallel(context.Background(), bytes.NewReader(data), int64(len(data)), options) {
+		c.Assert(err, IsNil)
+		_, exists := urls[record.Offset()]
+		c.Assert(exists, Equals, false)
+		urls[record.Offset()] = record.GetUrl()
+	}
+	c.Assert(len(urls), Equals, len(offsets))
+	for i, offset := range offsets {
+		c.Assert(urls[int(offset)], Equals, fmt.Sprintf("http://example.com/%v", i))
+	}
+}
+
+func (s *ParallelSuite) TestGzip(c *C) {
+	buf := bytes.Buffer{}
+	offsets := writeParallelFile(c, NewWARCWriter(&buf, true), getParallelRecords(200))
+	data := buf.Bytes()
+	starts, err := SplitWARC(bytes.NewReader(data), int64(len(data)), 8, nil)
+	c.Assert(err, IsNil)
+	c.Assert(starts, HasLen, 8)
+	c.Assert(starts[0], Equals, int64(0))
+	isOffset := map[int64]bool{}
+	for _, offset := range offsets {
+		isOffset[offset] = true
+	}
+	for i, start := range starts {
+		c.Assert(isOffset[start], Equals, true)
+		if i > 0 {
+			c.Assert(start > starts[i-1], Equals, true)
+		}
+	}
+	checkParallelRead(c, data, offsets, ParallelReadOptions{Workers: 4})
+	checkParallelRead(c, data, offsets, ParallelReadOptions{Workers: 1, Ranges: 1})
+}
+
+func (s *ParallelSuite) TestZstd(c *C) {
+	buf := bytes.Buffer{}
+	writer, err := NewZstdWARCWriter(&buf, getZstdDictionary(c))
+	c.Assert(err, IsNil)
+	offsets := writeParallelFile(c, writer, getParallelRecords(100))
+	starts, err := SplitWARC(bytes.NewReader(buf.Bytes()), int64(buf.Len()), 4, nil)
+	c.Assert(err, IsNil)
+	c.Assert(starts, HasLen, 4)
+	checkParallelRead(c, buf.Bytes(), offsets, ParallelReadOptions{Workers: 4})
+}
+
+func (s *ParallelSuite) TestUncompressed(c *C) {
+	buf := bytes.Buffer{}
+	offsets := writeParallelFile(c, NewWARCWriter(&buf, false), getParallelRecords(100))
+	data := buf.Bytes()
+	starts, err := SplitWARC(bytes.NewReader(data), int64(len(data)), 4, nil)
+	c.Assert(err, IsNil)
+	c.Assert(starts, DeepEquals, []int64{0})
+	checkParallelRead(c, data, offsets, ParallelReadOptions{Workers: 4})
+
+	// split with the offsets of an index
+	entries, err := IndexWARC(bytes.NewReader(data), "sample.warc")
+	c.Assert(err, IsNil)
+	indexed := []int64{}
+	for _, entry := range entries {
+		offset, _, err := entry.Location()
+		c.Assert(err, IsNil)
+		indexed = append(indexed, offset)
+	}
+	starts, err = SplitWARC(bytes.NewReader(data), int64(len(data)), 4, indexed)
+	c.Assert(err, IsNil)
+	c.Assert(starts, HasLen, 4)
+	checkParallelRead(c, data, offsets, ParallelReadOptions{Workers: 4, Offsets: indexed})
+}
+
+func (s *ParallelSuite) TestFalseMagic(c *C) {
+	// a stored gzip member holding the gzip magic number
+	buf := bytes.Buffer{}
+	gzout, err := gzip.NewWriterLevel(&buf, gzip.NoCompression)
+	c.Assert(err, IsNil)
+	record := NewWARCRecordFromBytes(map[string]string{"WARC-Type": "resource"},
+		bytes.Repeat([]byte{0x1f, 0x8b, 0x08, 0, 0, 0, 0, 0, 0, 0xff}, 1000))
+	record.WriteTo(gzout)
+	gzout.Close()
+	first := int64(buf.Len())
+	writer := NewWARCWriter(&buf, true)
+	offsets := writeParallelFile(c, writer, getParallelRecords(10))
+	data := buf.Bytes()
+	starts, err := SplitWARC(bytes.NewReader(data), int64(len(data)), 2, nil)
+	c.Assert(err, IsNil)
+	c.Assert(starts, DeepEquals, []int64{0, first + offsets[0]})
+}
+
+func (s *ParallelSuite) TestError(c *C) {
+	buf := bytes.Buffer{}
+	offsets := writeParallelFile(c, NewWARCWriter(&buf, true), getParallelRecords(50))
+	data := buf.Bytes()
+	copy(data[offsets[30]+10:], bytes.Repeat([]byte{0xff}, 20))
+	var lastErr error
+	count := 0
+	for _, err := range ReadParallel(context.Background(), bytes.NewReader(data), int64(len(data)), ParallelReadOptions{Workers: 2}) {
+		if err != nil {
+			lastErr = err
+		} else {
+			count++
+		}
+	}
+	c.Assert(lastErr, NotNil)
+	c.Assert(count < 50, Equals, true)
+}
+
+func (s *ParallelSuite) TestBreak(c *C) {
+	buf := bytes.Buffer{}
+	writeParallelFile(c, NewWARCWriter(&buf, true), getParallelRecords(100))
+	count := 0
+	for _, err := range ReadParallel(context.Background(), bytes.NewReader(buf.Bytes()), int64(buf.Len()), ParallelReadOptions{Workers: 4}) {
+		c.Assert(err, IsNil)
+		count++
+		if count == 5 {
+			break
+		}
+	}
+	c.Assert(count, Equals, 5)
+}
@@ -0,0 +1,168 @@
+package warc
+
+/*
+	Copyright (C) 2015  Wolfgang Meyers
+
+    This program is free software; you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation; either version 2 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License along
+    with this program; if not, write to the Free Software Foundation, Inc.,
+    51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+*/
+import (
+	"context"
+	"io"
+	"iter"
+	"runtime"
+	"sync"
+)
+
+// Options for ProcessRecords
+type PipelineOptions struct {
+	// The number of workers. Defaults to the number of CPUs.
+	Workers int
+	// Yield results in the order of the records instead of as they are ready
+	Ordered bool
+	// The maximum number of records that are read but whose results were
+	// not yet yielded. Defaults to twice the number of workers.
+	Buffer int
+}
+
+type pipelineItem[T any] struct {
+	index  int
+	record *WARCRecord
+	result T
+	err    error
+}
+
+// Processes the records of reader in parallel. One goroutine reads the
+// records, which are handed to workers that call process, and the results
+// are yielded as they are ready, or in the order of the records if
+// options.Ordered is set. Reading waits while options.Buffer records are
+// in flight, so that a slow consumer holds up the pipeline.
+//
+// The first error, from reading or processing, is yielded and ends the
+// iteration, as does breaking out of the loop or ctx being done, which
+// cancels the context passed to process. No goroutines are left running
+// once the iteration ends. Records are safe to hand to workers, as their
+// payloads are read into memory or streamed from other files.
+//
+//	results := warc.ProcessRecords(ctx, wf.GetReader(), warc.PipelineOptions{Ordered: true},
+//		func(ctx context.Context, record *warc.WARCRecord) (int, error) {
+//			return len(record.GetPayload().GetData()), nil
+//		})
+//	for length, err := range results {
+//		...
+//	}
+func ProcessRecords[T any](ctx context.Context, reader RecordReader, options PipelineOptions,
+	process func(context.Context, *WARCRecord) (T, error)) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		ctx, cancel := context.WithCancel(ctx)
+		workers := options.Workers
+		if workers <= 0 {
+			workers = runtime.NumCPU()
+		}
+		buffer := options.Buffer
+		if buffer <= 0 {
+			buffer = 2 * workers
+		}
+		read := reader.ReadRecord
+		if warcReader, ok := reader.(*WARCReader); ok {
+			read = func() (*WARCRecord, error) {
+				return warcReader.ReadRecordContext(ctx)
+			}
+		}
+		// a slot is taken for each record read and released when its result
+		// is yielded, so results never has to hold more items than slots
+		slots := make(chan struct{}, buffer)
+		records := make(chan *pipelineItem[T])
+		results := make(chan *pipelineItem[T], buffer)
+		wg := sync.WaitGroup{}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer close(records)
+			for index := 0; ; index++ {
+				select {
+				case slots <- struct{}{}:
+				case <-ctx.Done():
+					return
+				}
+				record, err := read()
+				if err != nil {
+					if err != io.EOF {
+						results <- &pipelineItem[T]{index: index, err: err}
+					}
+					return
+				}
+				records <- &pipelineItem[T]{index: index, record: record}
+			}
+		}()
+		for i := 0; i < workers; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for item := range records {
+					if ctx.Err() == nil {
+						item.result, item.err = process(ctx, item.record)
+					} else {
+						item.err = ctx.Err()
+					}
+					item.record = nil
+					results <- item
+				}
+			}()
+		}
+		go func() {
+			wg.Wait()
+			close(results)
+		}()
+		defer func() {
+			cancel()
+			// wait for the goroutines to finish
+			for range results {
+			}
+		}()
+
+		deliver := func(item *pipelineItem[T]) bool {
+			<-slots
+			if item.err != nil {
+				var zero T
+				yield(zero, item.err)
+				return false
+			}
+			return yield(item.result, nil)
+		}
+		pending := map[int]*pipelineItem[T]{}
+		next := 0
+		for item := range results {
+			if !options.Ordered {
+				if !deliver(item) {
+					return
+				}
+				continue
+			}
+			pending[item.index] = item
+			for pending[next] != nil {
+				item := pending[next]
+				delete(pending, next)
+				next++
+				if !deliver(item) {
+					return
+				}
+			}
+		}
+		if err := ctx.Err(); err != nil {
+			var zero T
+			yield(zero, err)
+		}
+	}
+}
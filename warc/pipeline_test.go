@@ -0,0 +1,173 @@
+package warc
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	. "gopkg.in/check.v1"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+type PipelineSuite struct{}
+
+var pipelineSuite = Suite(&PipelineSuite{})
+
+// countingRecordReader counts the records read.
+type countingRecordReader struct {
+	RecordReader
+	count atomic.Int32
+}
+
+func (cr *countingRecordReader) ReadRecord() (*WARCRecord, error) {
+	cr.count.Add(1)
+	return cr.RecordReader.ReadRecord()
+}
+
+func getPipelineFile(c *C, count int) *WARCFile {
+	buf := bytes.Buffer{}
+	_, err := writeSampleRecords(NewWARCWriter(&buf, true), getSampleRecords(count, map[string]string{
+		"WARC-Type": "resource",
+	}, func(i int) []byte {
+		return []byte(fmt.Sprintf("record %v", i))
+	}))
+	c.Assert(err, IsNil)
+	f, err := NewWARCFile(&ClosingBuffer{bytes.NewReader(buf.Bytes())})
+	c.Assert(err, IsNil)
+	return f
+}
+
+// Returns the payload of a record after a delay that varies by record.
+func slowPayload(ctx context.Context, record *WARCRecord) (string, error) {
+	time.Sleep(time.Duration(len(record.GetUrl())%3) * time.Millisecond)
+	return string(record.GetPayload().GetData()), nil
+}
+
+func expectedPayloads(count int) []string {
+	payloads := []string{}
+	for i := 0; i < count; i++ {
+		payloads = append(payloads, fmt.Sprintf("record %v", i))
+	}
+	return payloads
+}
+
+func (s *PipelineSuite) TestOrdered(c *C) {
+	f := getPipelineFile(c, 50)
+	results := []string{}
+	for result, err := range ProcessRecords(context.Background(), f.GetReader(), PipelineOptions{Workers: 4, Ordered: true}, slowPayload) {
+		c.Assert(err, IsNil)
+		results = append(results, result)
+	}
+	c.Assert(results, DeepEquals, expectedPayloads(50))
+}
+
+func (s *PipelineSuite) TestUnordered(c *C) {
+	f := getPipelineFile(c, 50)
+	results := []string{}
+	for result, err := range ProcessRecords(context.Background(), f.GetReader(), PipelineOptions{}, slowPayload) {
+		c.Assert(err, IsNil)
+		results = append(results, result)
+	}
+	expected := expectedPayloads(50)
+	sort.Strings(results)
+	sort.Strings(expected)
+	c.Assert(results, DeepEquals, expected)
+}
+
+func (s *PipelineSuite) TestBackpressure(c *C) {
+	reader := &countingRecordReader{RecordReader: getPipelineFile(c, 30).GetReader()}
+	consumed := 0
+	for _, err := range ProcessRecords(context.Background(), reader, PipelineOptions{Workers: 2, Buffer: 3}, slowPayload) {
+		c.Assert(err, IsNil)
+		consumed++
+		time.Sleep(time.Millisecond)
+		c.Assert(int(reader.count.Load()) <= consumed+3, Equals, true)
+	}
+	c.Assert(consumed, Equals, 30)
+}
+
+func (s *PipelineSuite) TestBreak(c *C) {
+	reader := &countingRecordReader{RecordReader: getPipelineFile(c, 50).GetReader()}
+	processed := atomic.Int32{}
+	count := 0
+	for _, err := range ProcessRecords(context.Background(), reader, PipelineOptions{Workers: 2, Buffer: 4, Ordered: true},
+		func(ctx context.Context, record *WARCRecord) (string, error) {
+			processed.Add(1)
+			return slowPayload(ctx, record)
+		}) {
+		c.Assert(err, IsNil)
+		count++
+		if count == 3 {
+			break
+		}
+	}
+	// the goroutines are done once the loop is left
+	c.Assert(count, Equals, 3)
+	read := reader.count.Load()
+	c.Assert(read <= 3+4+1, Equals, true)
+	time.Sleep(10 * time.Millisecond)
+	c.Assert(reader.count.Load(), Equals, read)
+	c.Assert(processed.Load() <= read, Equals, true)
+}
+
+func (s *PipelineSuite) TestProcessError(c *C) {
+	f := getPipelineFile(c, 50)
+	results := []string{}
+	var lastErr error
+	for result, err := range ProcessRecords(context.Background(), f.GetReader(), PipelineOptions{Workers: 4, Ordered: true},
+		func(ctx context.Context, record *WARCRecord) (string, error) {
+			if record.GetUrl() == "http://example.com/10" {
+				return "", errors.New("Failed")
+			}
+			return slowPayload(ctx, record)
+		}) {
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		results = append(results, result)
+	}
+	c.Assert(lastErr, ErrorMatches, "Failed")
+	c.Assert(results, DeepEquals, expectedPayloads(10))
+}
+
+func (s *PipelineSuite) TestReadError(c *C) {
+	data, _ := writeLenientSample(false)
+	data = bytes.Replace(data, []byte("WARC-Record-ID: <urn:uuid:2>"), []byte("WARC-Record-ID <urn uuid 2>"), 1)
+	f, err := NewWARCFile(&ClosingBuffer{bytes.NewReader(data)})
+	c.Assert(err, IsNil)
+	errors := []error{}
+	count := 0
+	for _, err := range ProcessRecords(context.Background(), f.GetReader(), PipelineOptions{Ordered: true}, slowPayload) {
+		if err != nil {
+			errors = append(errors, err)
+		} else {
+			count++
+		}
+	}
+	c.Assert(count, Equals, 1)
+	c.Assert(errors, HasLen, 1)
+	c.Assert(errors[0], ErrorMatches, "(?s)Bad header line: .*")
+}
+
+func (s *PipelineSuite) TestCancel(c *C) {
+	f := getPipelineFile(c, 50)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	count := 0
+	var lastErr error
+	for _, err := range ProcessRecords(ctx, f.GetReader(), PipelineOptions{Workers: 2}, slowPayload) {
+		if err != nil {
+			lastErr = err
+			break
+		}
+		count++
+		if count == 5 {
+			cancel()
+		}
+	}
+	c.Assert(lastErr, Equals, context.Canceled)
+	c.Assert(count < 50, Equals, true)
+}
@@ -0,0 +1,173 @@
+package warc
+
+/*
+	Copyright (C) 2015  Wolfgang Meyers
+
+    This program is free software; you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation; either version 2 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License along
+    with this program; if not, write to the Free Software Foundation, Inc.,
+    51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+*/
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// Compression formats of WARC files
+var COMPRESSION_NONE string = "none"
+var COMPRESSION_GZIP string = "gzip"
+var COMPRESSION_ZSTD string = "zstd"
+
+// Options for Recompress
+type RecompressOptions struct {
+	// COMPRESSION_GZIP (the default), COMPRESSION_ZSTD or COMPRESSION_NONE
+	Compression string
+	// An optional dictionary for COMPRESSION_ZSTD
+	Dictionary []byte
+}
+
+type RecompressResult struct {
+	// The number of records that were written
+	Records int
+	// The digest of the bytes of each record, in order
+	Digests []string
+}
+
+// Creates a WARCWriter for the given compression format.
+func newWriterFor(out io.Writer, compression string, dictionary []byte) (*WARCWriter, error) {
+	switch compression {
+	case COMPRESSION_NONE:
+		return NewWARCWriter(out, false), nil
+	case COMPRESSION_GZIP, "":
+		return NewWARCWriter(out, true), nil
+	case COMPRESSION_ZSTD:
+		return NewZstdWARCWriter(out, dictionary)
+	}
+	return nil, errors.New(fmt.Sprintf("Unsupported compression: %v", compression))
+}
+
+// Rewrites a WARC file in any supported compression, including files
+// compressed as a single gzip member or zstd frame, with each record in
+// a gzip member or zstd frame of its own, or uncompressed. Records are
+// copied byte for byte, without parsing and writing their headers again.
+func Recompress(in io.Reader, out io.Writer, options RecompressOptions) (*RecompressResult, error) {
+	stream, err := newRecordStream(in, nil)
+	if err != nil {
+		return nil, err
+	}
+	writer, err := newWriterFor(out, options.Compression, options.Dictionary)
+	if err != nil {
+		return nil, err
+	}
+	result := &RecompressResult{}
+	for {
+		offset, err := stream.next()
+		if err == io.EOF {
+			return result, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		hash := sha1.New()
+		_, err = writer.writeMember(func(w io.Writer) error {
+			return copyRawRecord(stream.reader, io.MultiWriter(w, hash))
+		})
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("Record at offset %v: %v", offset, err))
+		}
+		result.Records++
+		result.Digests = append(result.Digests, "sha1:"+base32.StdEncoding.EncodeToString(hash.Sum(nil)))
+	}
+}
+
+// Verifies that recompressed holds the records described by result,
+// with the same bytes and in the same order.
+func VerifyRecompression(result *RecompressResult, recompressed io.Reader) error {
+	stream, err := newRecordStream(recompressed, nil)
+	if err != nil {
+		return err
+	}
+	for i := 0; ; i++ {
+		_, err := stream.next()
+		if err == io.EOF {
+			if i != result.Records {
+				return errors.New(fmt.Sprintf("Found %v records, expected %v", i, result.Records))
+			}
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if i >= result.Records {
+			return errors.New(fmt.Sprintf("Found more than %v records", result.Records))
+		}
+		hash := sha1.New()
+		if err := copyRawRecord(stream.reader, hash); err != nil {
+			return errors.New(fmt.Sprintf("Reading record %v: %v", i+1, err))
+		}
+		if digest := "sha1:" + base32.StdEncoding.EncodeToString(hash.Sum(nil)); digest != result.Digests[i] {
+			return errors.New(fmt.Sprintf("Digest of record %v is %v, expected %v", i+1, digest, result.Digests[i]))
+		}
+	}
+}
+
+// Copies the bytes of the record at the start of reader to w, including
+// the CRLFCRLF that ends the record. The header is only parsed to find
+// the length of the block.
+func copyRawRecord(reader *bufio.Reader, w io.Writer) error {
+	raw := bytes.Buffer{}
+	for {
+		line, err := reader.ReadString('\n')
+		raw.WriteString(line)
+		if err != nil {
+			return io.ErrUnexpectedEOF
+		}
+		if line == "\r\n" {
+			break
+		}
+	}
+	header, err := (&WARCReader{}).ReadHeader(bufio.NewReader(bytes.NewReader(raw.Bytes())))
+	if err != nil {
+		return err
+	}
+	value, _ := header.Get("Content-Length")
+	length, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || length < 0 {
+		return errors.New(fmt.Sprintf("Bad Content-Length: %v", value))
+	}
+	if _, err := w.Write(raw.Bytes()); err != nil {
+		return err
+	}
+	if _, err := io.CopyN(w, reader, length); err != nil {
+		if err == io.EOF {
+			return io.ErrUnexpectedEOF
+		}
+		return err
+	}
+	for i := 0; i < 2; i++ {
+		line, err := reader.ReadString('\n')
+		if line != "\r\n" {
+			if err != nil {
+				return io.ErrUnexpectedEOF
+			}
+			return errors.New(fmt.Sprintf("Expected the end of the record, found %q", line))
+		}
+	}
+	_, err = w.Write([]byte("\r\n\r\n"))
+	return err
+}
@@ -0,0 +1,97 @@
+package warc
+
+import (
+	"bytes"
+	"compress/gzip"
+	. "gopkg.in/check.v1"
+)
+
+type RecompressSuite struct{}
+
+var recompressSuite = Suite(&RecompressSuite{})
+
+// Headers in an order that WARCHeader.WriteTo would not produce,
+// to check that records are copied as they are.
+var sampleRawRecords string = "WARC/1.0\r\n" +
+	"Content-Length: 10\r\n" +
+	"WARC-Date: 2000-01-02T03:04:05Z\r\n" +
+	"WARC-Type: resource\r\n" +
+	"warc-record-id: <record-1>\r\n" +
+	"\r\n" +
+	"Helloworld\r\n\r\n" +
+	"WARC/1.1\r\n" +
+	"WARC-Type: metadata\r\n" +
+	"WARC-Record-ID: <record-2>\r\n" +
+	"WARC-Date: 2000-01-02T03:04:06Z\r\n" +
+	"Content-Length: 0\r\n" +
+	"\r\n" +
+	"\r\n\r\n"
+
+func getSingleGzipStream() []byte {
+	buf := bytes.Buffer{}
+	gzout := gzip.NewWriter(&buf)
+	gzout.Write([]byte(sampleRawRecords))
+	gzout.Close()
+	return buf.Bytes()
+}
+
+func (s *RecompressSuite) TestUncompress(c *C) {
+	out := bytes.Buffer{}
+	result, err := Recompress(bytes.NewReader(getSingleGzipStream()), &out, RecompressOptions{
+		Compression: COMPRESSION_NONE,
+	})
+	c.Assert(err, IsNil)
+	c.Assert(result.Records, Equals, 2)
+	c.Assert(out.String(), Equals, sampleRawRecords)
+	c.Assert(VerifyRecompression(result, bytes.NewReader(out.Bytes())), IsNil)
+}
+
+func (s *RecompressSuite) TestPerRecordCompression(c *C) {
+	for _, compression := range []string{COMPRESSION_GZIP, COMPRESSION_ZSTD} {
+		out := bytes.Buffer{}
+		result, err := Recompress(bytes.NewReader(getSingleGzipStream()), &out, RecompressOptions{
+			Compression: compression,
+		})
+		c.Assert(err, IsNil)
+		c.Assert(VerifyRecompression(result, bytes.NewReader(out.Bytes())), IsNil)
+
+		f, err := NewWARCFile(&ClosingBuffer{bytes.NewReader(out.Bytes())})
+		c.Assert(err, IsNil)
+		first, err := f.ReadRecord()
+		c.Assert(err, IsNil)
+		second, err := f.ReadRecord()
+		c.Assert(err, IsNil)
+		c.Assert(second.Offset() > 0, Equals, true)
+		record, err := ReadRecordAt(bytes.NewReader(out.Bytes()), int64(second.Offset()))
+		c.Assert(err, IsNil)
+		c.Assert(record.GetHeader().GetRecordId(), Equals, "<record-2>")
+		c.Assert(first.GetHeader().GetRecordId(), Equals, "<record-1>")
+
+		// and back again
+		plain := bytes.Buffer{}
+		_, err = Recompress(bytes.NewReader(out.Bytes()), &plain, RecompressOptions{Compression: COMPRESSION_NONE})
+		c.Assert(err, IsNil)
+		c.Assert(plain.String(), Equals, sampleRawRecords)
+	}
+}
+
+func (s *RecompressSuite) TestVerifyFails(c *C) {
+	out := bytes.Buffer{}
+	result, err := Recompress(bytes.NewReader([]byte(sampleRawRecords)), &out, RecompressOptions{
+		Compression: COMPRESSION_NONE,
+	})
+	c.Assert(err, IsNil)
+	changed := bytes.Replace(out.Bytes(), []byte("Helloworld"), []byte("Hellowarld"), 1)
+	c.Assert(VerifyRecompression(result, bytes.NewReader(changed)), ErrorMatches, "Digest of record 1 .*")
+	c.Assert(VerifyRecompression(result, bytes.NewReader(out.Bytes()[:40])), NotNil)
+	result.Records = 1
+	c.Assert(VerifyRecompression(result, bytes.NewReader(out.Bytes())), ErrorMatches, "Found more than 1 records")
+}
+
+func (s *RecompressSuite) TestTruncated(c *C) {
+	out := bytes.Buffer{}
+	_, err := Recompress(bytes.NewReader([]byte(sampleRawRecords[:50])), &out, RecompressOptions{})
+	c.Assert(err, NotNil)
+	_, err = Recompress(bytes.NewReader([]byte(sampleRawRecords)), &out, RecompressOptions{Compression: "bzip2"})
+	c.Assert(err, ErrorMatches, "Unsupported compression: bzip2")
+}
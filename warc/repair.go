@@ -0,0 +1,458 @@
+package warc
+
+/*
+	Copyright (C) 2015  Wolfgang Meyers
+
+    This program is free software; you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation; either version 2 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License along
+    with this program; if not, write to the Free Software Foundation, Inc.,
+    51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+*/
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Options for Repair
+type RepairOptions struct {
+	// COMPRESSION_GZIP, COMPRESSION_ZSTD or COMPRESSION_NONE. By default,
+	// the compression of the damaged file is used.
+	Compression string
+	// Drop an incomplete final record instead of truncating it
+	DropIncomplete bool
+	// The WARC-Date of records that have none and follow no dated
+	// record, and of the changelog. Defaults to the current time.
+	Date time.Time
+}
+
+// A change made by Repair
+type RepairChange struct {
+	// The offset in the damaged file of the record, or of its gzip member or zstd frame
+	Offset  int64
+	Message string
+}
+
+func (rc *RepairChange) String() string {
+	return fmt.Sprintf("offset %v: %v", rc.Offset, rc.Message)
+}
+
+type RepairResult struct {
+	// The number of records written, without the changelog
+	Records int
+	Changes []*RepairChange
+}
+
+// Rewrites a damaged WARC file, such as one left behind by a crawler
+// that crashed, into a valid one:
+//
+//   - data that cannot be parsed as a record is skipped, up to the next
+//     WARC version line or gzip member
+//   - an incomplete final record is truncated, or dropped
+//   - wrong Content-Length values are fixed by scanning for the CRLFCRLF
+//     that ends the record, followed by the next record
+//   - the content of broken gzip members and zstd frames is compressed again
+//   - missing mandatory headers are added
+//
+// Records that need no changes are copied byte for byte. If anything was
+// changed, a metadata record listing the changes is written at the end.
+// Compressed files are read one gzip member or zstd frame at a time,
+// so a file compressed as a single stream is held in memory.
+func Repair(in io.Reader, out io.Writer, options RepairOptions) (*RepairResult, error) {
+	stream, err := newRecordStream(in, nil)
+	if err != nil {
+		return nil, err
+	}
+	compression := options.Compression
+	if compression == "" {
+		compression = COMPRESSION_NONE
+		if stream.gzipfile != nil {
+			compression = COMPRESSION_GZIP
+		} else if stream.zstdfile != nil {
+			compression = COMPRESSION_ZSTD
+		}
+	}
+	writer, err := newWriterFor(out, compression, nil)
+	if err != nil {
+		return nil, err
+	}
+	date := options.Date
+	if date.IsZero() {
+		date = time.Now()
+	}
+	rp := &repairer{
+		writer:  writer,
+		options: options,
+		date:    FormatDate(date),
+		result:  &RepairResult{},
+	}
+	if !stream.compressed() {
+		err = rp.repairRecords(&repairReader{reader: stream.reader}, -1)
+	} else {
+		err = rp.repairMembers(stream)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(rp.result.Changes) > 0 {
+		if err := rp.writeChangelog(); err != nil {
+			return nil, err
+		}
+	}
+	return rp.result, nil
+}
+
+type repairer struct {
+	writer   *WARCWriter
+	options  RepairOptions
+	date     string
+	lastDate string
+	result   *RepairResult
+}
+
+func (rp *repairer) change(offset int64, format string, args ...interface{}) {
+	rp.result.Changes = append(rp.result.Changes, &RepairChange{
+		Offset:  offset,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+// Repairs the records of each gzip member or zstd frame in turn.
+func (rp *repairer) repairMembers(stream *recordStream) error {
+	for {
+		offset, err := stream.next()
+		if err == io.EOF {
+			return nil
+		}
+		broken := err != nil
+		if broken {
+			offset = stream.offset()
+		} else {
+			content, readErr := io.ReadAll(stream.reader)
+			if readErr != nil {
+				rp.change(offset, "Recovered %v bytes from a broken gzip member or zstd frame: %v", len(content), readErr)
+			}
+			reader := &repairReader{reader: bufio.NewReader(bytes.NewReader(content))}
+			if err := rp.repairRecords(reader, offset); err != nil {
+				return err
+			}
+			if readErr == nil {
+				continue
+			}
+		}
+		next, err := stream.resync()
+		if err != nil && err != io.EOF {
+			return err
+		}
+		if err == io.EOF {
+			next = stream.position()
+		}
+		if broken && next > offset {
+			rp.change(offset, "Skipped %v bytes of damaged data", next-offset)
+		}
+		if err == io.EOF {
+			return nil
+		}
+	}
+}
+
+// Repairs the records read from reader. memberOffset is the offset of the
+// gzip member or zstd frame holding them, or -1 for uncompressed files.
+func (rp *repairer) repairRecords(reader *repairReader, memberOffset int64) error {
+	for {
+		offset := reader.offset
+		line, err := reader.readLine()
+		if err == io.EOF && line == "" {
+			return nil
+		}
+		if memberOffset >= 0 {
+			offset = memberOffset
+		}
+		if line == "\r\n" || line == "\n" {
+			continue
+		}
+		if !strings.HasPrefix(line, "WARC/") || !RE_VERSION.MatchString(strings.TrimRight(line, "\r\n")+"\r\n") {
+			skipped := len(line) + reader.skipToVersionLine()
+			rp.change(offset, "Skipped %v bytes that are not a WARC record", skipped)
+			continue
+		}
+		if err := rp.repairRecord(reader, offset, line); err != nil {
+			return err
+		}
+	}
+}
+
+type headerLine struct {
+	name  string
+	value string
+	raw   string
+}
+
+func (rp *repairer) repairRecord(reader *repairReader, offset int64, versionLine string) error {
+	changed := false
+	lines := []*headerLine{}
+	for {
+		line, err := reader.readLine()
+		if line == "\r\n" || line == "\n" {
+			if line == "\n" {
+				changed = true
+			}
+			break
+		}
+		if err != nil || strings.HasPrefix(line, "WARC/") {
+			// the header was cut short by the end of the file or a new record
+			if strings.HasPrefix(line, "WARC/") {
+				reader.unread([]byte(line))
+			}
+			rp.change(offset, "Dropped a record with an incomplete header")
+			return nil
+		}
+		match := RE_HEADER.FindStringSubmatch(strings.TrimRight(line, "\r\n") + "\r\n")
+		if len(match) == 0 || !strings.HasPrefix(line, match[1]) {
+			rp.change(offset, "Dropped bad header line %q", line)
+			changed = true
+			continue
+		}
+		if !strings.HasSuffix(line, "\r\n") {
+			changed = true
+		}
+		lines = append(lines, &headerLine{canonicalHeaderName(strings.ToLower(match[1])), strings.TrimSpace(match[2]), match[0]})
+	}
+	get := func(name string) (string, bool) {
+		for _, line := range lines {
+			if line.name == name {
+				return line.value, true
+			}
+		}
+		return "", false
+	}
+	set := func(name string, value string) {
+		changed = true
+		raw := name + ": " + value + "\r\n"
+		for _, line := range lines {
+			if line.name == name {
+				line.value, line.raw = value, raw
+				return
+			}
+		}
+		lines = append(lines, &headerLine{name, value, raw})
+	}
+
+	value, exists := get("Content-Length")
+	length, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || length < 0 {
+		length = -1
+	}
+	block, terminated, complete := reader.readBlock(length)
+	if !complete && rp.options.DropIncomplete {
+		rp.change(offset, "Dropped an incomplete record of %v bytes", len(block))
+		return nil
+	}
+	if !complete {
+		rp.change(offset, "Truncated an incomplete record to %v bytes", len(block))
+		set("WARC-Truncated", "unspecified")
+	} else if !terminated {
+		rp.change(offset, "Added the missing CRLFCRLF at the end of the record")
+		changed = true
+	}
+	if !exists {
+		rp.change(offset, "Added missing Content-Length %v", len(block))
+	} else if length != int64(len(block)) {
+		rp.change(offset, "Corrected Content-Length %v to %v", value, len(block))
+	}
+	if !exists || length != int64(len(block)) {
+		set("Content-Length", strconv.Itoa(len(block)))
+		if digest, exists := get("WARC-Block-Digest"); exists {
+			if matches, _ := digestMatches(digest, block); !matches {
+				set("WARC-Block-Digest", ComputeDigest(block))
+			}
+		}
+	}
+	if _, exists := get("WARC-Record-ID"); !exists {
+		set("WARC-Record-ID", NewRecordId())
+		rp.change(offset, "Added missing WARC-Record-ID")
+	}
+	if date, exists := get("WARC-Date"); exists {
+		rp.lastDate = date
+	} else {
+		date := rp.lastDate
+		if date == "" {
+			date = rp.date
+		}
+		set("WARC-Date", date)
+		rp.change(offset, "Added missing WARC-Date %v", date)
+	}
+	if _, exists := get("WARC-Type"); !exists {
+		recordType := "resource"
+		contentType, _ := get("Content-Type")
+		if strings.HasPrefix(contentType, "application/http") && strings.Contains(contentType, "msgtype=request") {
+			recordType = "request"
+		} else if strings.HasPrefix(contentType, "application/http") {
+			recordType = "response"
+		}
+		set("WARC-Type", recordType)
+		rp.change(offset, "Added missing WARC-Type %v", recordType)
+	}
+
+	if changed {
+		versionLine = strings.TrimRight(versionLine, "\r\n") + "\r\n"
+	}
+	_, err = rp.writer.writeMember(func(w io.Writer) error {
+		header := bytes.NewBufferString(versionLine)
+		for _, line := range lines {
+			header.WriteString(line.raw)
+		}
+		header.WriteString("\r\n")
+		if _, err := w.Write(header.Bytes()); err != nil {
+			return err
+		}
+		if _, err := w.Write(block); err != nil {
+			return err
+		}
+		_, err := w.Write([]byte("\r\n\r\n"))
+		return err
+	})
+	if err == nil {
+		rp.result.Records++
+	}
+	return err
+}
+
+func (rp *repairer) writeChangelog() error {
+	fields := []string{"software: " + SOFTWARE}
+	for _, change := range rp.result.Changes {
+		fields = append(fields, "repair: "+change.String())
+	}
+	record := NewWARCRecordFromBytes(map[string]string{
+		"WARC-Type":    "metadata",
+		"WARC-Date":    rp.date,
+		"Content-Type": CONTENT_TYPES["metadata"],
+	}, []byte(strings.Join(fields, "\r\n")+"\r\n"))
+	_, err := rp.writer.WriteRecord(record)
+	return err
+}
+
+// repairReader reads the decompressed content of a damaged file,
+// allowing data that was read too far to be pushed back.
+type repairReader struct {
+	reader  *bufio.Reader
+	pending []byte
+	// the number of bytes read
+	offset int64
+}
+
+func (rr *repairReader) Read(p []byte) (int, error) {
+	if len(rr.pending) > 0 {
+		n := copy(p, rr.pending)
+		rr.pending = rr.pending[n:]
+		rr.offset += int64(n)
+		return n, nil
+	}
+	n, err := rr.reader.Read(p)
+	rr.offset += int64(n)
+	return n, err
+}
+
+func (rr *repairReader) unread(data []byte) {
+	rr.pending = append(append([]byte{}, data...), rr.pending...)
+	rr.offset -= int64(len(data))
+}
+
+func (rr *repairReader) readLine() (string, error) {
+	prefix := ""
+	if len(rr.pending) > 0 {
+		if i := bytes.IndexByte(rr.pending, '\n'); i >= 0 {
+			line := string(rr.pending[:i+1])
+			rr.pending = rr.pending[i+1:]
+			rr.offset += int64(len(line))
+			return line, nil
+		}
+		prefix = string(rr.pending)
+		rr.offset += int64(len(prefix))
+		rr.pending = nil
+	}
+	line, err := rr.reader.ReadString('\n')
+	rr.offset += int64(len(line))
+	return prefix + line, err
+}
+
+// Skips to the next line that starts with "WARC/", returning the number of bytes skipped.
+func (rr *repairReader) skipToVersionLine() int {
+	skipped := 0
+	for {
+		line, err := rr.readLine()
+		if strings.HasPrefix(line, "WARC/") {
+			rr.unread([]byte(line))
+			return skipped
+		}
+		skipped += len(line)
+		if err != nil {
+			return skipped
+		}
+	}
+}
+
+// The end of a record followed by the start of the next one
+var RECORD_BOUNDARY []byte = []byte("\r\n\r\nWARC/")
+
+// Reads the block of a record. If length is the length of the block, i.e.
+// the block is followed by CRLFCRLF, the block is returned as is. Otherwise
+// the end of the block is found by scanning for CRLFCRLF followed by the
+// next record, or the end of the data. Returns whether the block was
+// followed by CRLFCRLF, and whether the record is complete.
+func (rr *repairReader) readBlock(length int64) ([]byte, bool, bool) {
+	data := []byte{}
+	if length >= 0 {
+		buf := bytes.Buffer{}
+		io.CopyN(&buf, rr, length+4)
+		data = buf.Bytes()
+		if int64(len(data)) == length+4 && string(data[length:]) == "\r\n\r\n" {
+			return data[:length], true, true
+		}
+		if int64(len(data)) == length {
+			// only the end of the record is missing
+			return data, false, true
+		}
+	}
+	chunk := make([]byte, 32*1024)
+	searched := 0
+	for {
+		if i := bytes.Index(data[searched:], RECORD_BOUNDARY); i >= 0 {
+			end := searched + i
+			rr.unread(data[end+4:])
+			return data[:end], true, true
+		}
+		if len(data) >= len(RECORD_BOUNDARY) {
+			searched = len(data) - len(RECORD_BOUNDARY) + 1
+		}
+		n, err := rr.Read(chunk)
+		data = append(data, chunk[:n]...)
+		if err != nil && n == 0 {
+			break
+		}
+	}
+	if bytes.HasSuffix(data, []byte("\r\n\r\n")) {
+		return data[:len(data)-4], true, true
+	}
+	if length >= 0 && int64(len(data)) > length {
+		// a valid length and a missing or damaged end of record
+		if !bytes.HasPrefix([]byte("\r\n\r\n"), data[length:]) {
+			rr.unread(data[length:])
+		}
+		return data[:length], false, true
+	}
+	return data, false, false
+}
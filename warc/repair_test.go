@@ -0,0 +1,169 @@
+package warc
+
+import (
+	"bytes"
+	"fmt"
+	. "gopkg.in/check.v1"
+	"time"
+)
+
+type RepairSuite struct{}
+
+var repairSuite = Suite(&RepairSuite{})
+
+func repair(c *C, data []byte, options RepairOptions) ([]byte, *RepairResult) {
+	out := bytes.Buffer{}
+	result, err := Repair(bytes.NewReader(data), &out, options)
+	c.Assert(err, IsNil)
+	report, err := Validate(bytes.NewReader(out.Bytes()), "repaired.warc")
+	c.Assert(err, IsNil)
+	c.Assert(report.Errors, Equals, 0, Commentf("%v", messages(report)))
+	return out.Bytes(), result
+}
+
+func changes(result *RepairResult) []string {
+	messages := []string{}
+	for _, change := range result.Changes {
+		messages = append(messages, change.String())
+	}
+	return messages
+}
+
+func (s *RepairSuite) TestNothingToRepair(c *C) {
+	data, _ := writeLenientSample(false)
+	repaired, result := repair(c, data, RepairOptions{})
+	c.Assert(result.Records, Equals, 3)
+	c.Assert(result.Changes, HasLen, 0)
+	c.Assert(repaired, DeepEquals, data)
+}
+
+func (s *RepairSuite) TestWrongLength(c *C) {
+	for _, length := range []string{"1200", "800", "abc"} {
+		data, offsets := writeLenientSample(false)
+		data = bytes.Replace(data, []byte("Content-Length: 900"), []byte("Content-Length: "+length), 1)
+		repaired, result := repair(c, data, RepairOptions{})
+		c.Assert(result.Records, Equals, 3)
+		c.Assert(changes(result), DeepEquals, []string{"offset 0: Corrected Content-Length " + length + " to 900"})
+		urls, errors := readLeniently(c, repaired)
+		c.Assert(errors, HasLen, 0)
+		c.Assert(urls, HasLen, 4)
+		record, err := ReadRecordAt(bytes.NewReader(repaired), 0)
+		c.Assert(err, IsNil)
+		c.Assert(record.GetPayload().GetData(), HasLen, 900)
+		c.Assert(repaired[offsets[1]:offsets[2]], DeepEquals, data[offsets[1]+int64(len(length))-3:offsets[2]+int64(len(length))-3])
+	}
+}
+
+func (s *RepairSuite) TestChangelog(c *C) {
+	data, _ := writeLenientSample(false)
+	data = bytes.Replace(data, []byte("Content-Length: 900"), []byte("Content-Length: 901"), 1)
+	date := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	repaired, _ := repair(c, data, RepairOptions{Date: date})
+	f, err := NewWARCFile(&ClosingBuffer{bytes.NewReader(repaired)})
+	c.Assert(err, IsNil)
+	var record *WARCRecord
+	for i := 0; i < 4; i++ {
+		record, err = f.ReadRecord()
+		c.Assert(err, IsNil)
+	}
+	c.Assert(record.GetType(), Equals, "metadata")
+	c.Assert(record.GetDate(), Equals, "2020-01-02T03:04:05Z")
+	c.Assert(ParseWARCFields(record.GetPayload().GetData())["repair"], Equals,
+		"offset 0: Corrected Content-Length 901 to 900")
+}
+
+func (s *RepairSuite) TestTruncatedGzip(c *C) {
+	data, offsets := writeLenientSample(true)
+	// a file left open by a crawler that crashed
+	repaired, result := repair(c, data[:len(data)-12], RepairOptions{})
+	c.Assert(result.Records, Equals, 3)
+	c.Assert(changes(result), HasLen, 2)
+	c.Assert(changes(result)[0], Matches, "offset .*: Recovered .* bytes from a broken gzip member or zstd frame: unexpected EOF")
+	c.Assert(changes(result)[1], Matches, "offset .*: Added the missing CRLFCRLF at the end of the record")
+	c.Assert(result.Changes[0].Offset, Equals, offsets[2])
+	urls, errors := readLeniently(c, repaired)
+	c.Assert(errors, HasLen, 0)
+	c.Assert(urls, DeepEquals, []string{"http://example.com/1", "http://example.com/2", "http://example.com/3", ""})
+	record, err := ReadRecordAt(bytes.NewReader(repaired), offsets[2])
+	c.Assert(err, IsNil)
+	c.Assert(record.GetPayload().GetData(), HasLen, 900)
+}
+
+func (s *RepairSuite) TestTruncated(c *C) {
+	data, offsets := writeLenientSample(false)
+	repaired, result := repair(c, data[:len(data)-100], RepairOptions{})
+	c.Assert(result.Records, Equals, 3)
+	c.Assert(changes(result), DeepEquals, []string{
+		fmt.Sprintf("offset %v: Truncated an incomplete record to 804 bytes", offsets[2]),
+		fmt.Sprintf("offset %v: Corrected Content-Length 900 to 804", offsets[2]),
+	})
+	record, err := ReadRecordAt(bytes.NewReader(repaired), offsets[2])
+	c.Assert(err, IsNil)
+	truncated, _ := record.Get("WARC-Truncated")
+	c.Assert(truncated, Equals, "unspecified")
+	c.Assert(record.GetPayload().GetData(), DeepEquals, data[len(data)-904:len(data)-100])
+
+	_, result = repair(c, data[:len(data)-100], RepairOptions{DropIncomplete: true})
+	c.Assert(result.Records, Equals, 2)
+	c.Assert(changes(result), DeepEquals, []string{
+		fmt.Sprintf("offset %v: Dropped an incomplete record of 804 bytes", offsets[2]),
+	})
+
+	repaired, result = repair(c, data[:offsets[2]+30], RepairOptions{})
+	c.Assert(result.Records, Equals, 2)
+	c.Assert(changes(result), DeepEquals, []string{
+		fmt.Sprintf("offset %v: Dropped a record with an incomplete header", offsets[2]),
+	})
+	c.Assert(repaired[:offsets[2]], DeepEquals, data[:offsets[2]])
+}
+
+func (s *RepairSuite) TestCorruptGzipMember(c *C) {
+	data, offsets := writeLenientSample(true)
+	for i := offsets[1] + 20; i < offsets[1]+40; i++ {
+		data[i] ^= 0xff
+	}
+	repaired, result := repair(c, data, RepairOptions{Compression: COMPRESSION_NONE})
+	c.Assert(result.Records, Equals, 2)
+	c.Assert(result.Changes[0].Offset, Equals, offsets[1])
+	urls, _ := readLeniently(c, repaired)
+	c.Assert(urls, DeepEquals, []string{"http://example.com/1", "http://example.com/3", ""})
+}
+
+func (s *RepairSuite) TestMissingHeaders(c *C) {
+	data := []byte("garbage\r\n" +
+		"WARC/1.0\r\n" +
+		"WARC-Date: 2000-01-02T03:04:05Z\r\n" +
+		"WARC-Target-URI: http://example.com/\r\n" +
+		"Bad header\r\n" +
+		"Content-Type: application/http;msgtype=response\r\n" +
+		"\r\n" +
+		"HTTP/1.1 200 OK\r\n\r\nHello\r\n\r\n")
+	repaired, result := repair(c, data, RepairOptions{})
+	c.Assert(changes(result), DeepEquals, []string{
+		"offset 0: Skipped 9 bytes that are not a WARC record",
+		"offset 9: Dropped bad header line \"Bad header\\r\\n\"",
+		"offset 9: Added missing Content-Length 24",
+		"offset 9: Added missing WARC-Record-ID",
+		"offset 9: Added missing WARC-Type response",
+	})
+	record, err := ReadRecordAt(bytes.NewReader(repaired), 0)
+	c.Assert(err, IsNil)
+	c.Assert(record.GetType(), Equals, "response")
+	c.Assert(record.GetDate(), Equals, "2000-01-02T03:04:05Z")
+	c.Assert(string(record.GetPayload().GetData()), Equals, "HTTP/1.1 200 OK\r\n\r\nHello")
+}
+
+func (s *RepairSuite) TestMixedCaseHeaders(c *C) {
+	data := []byte("WARC/1.0\r\n" +
+		"Warc-Type: resource\r\n" +
+		"Warc-Record-Id: <urn:uuid:1>\r\n" +
+		"Warc-Date: 2000-01-02T03:04:05Z\r\n" +
+		"Warc-Target-Uri: http://example.com/\r\n" +
+		"content-type: text/plain\r\n" +
+		"content-length: 5\r\n" +
+		"\r\n" +
+		"Hello\r\n\r\n")
+	repaired, result := repair(c, data, RepairOptions{})
+	c.Assert(result.Changes, HasLen, 0)
+	c.Assert(repaired, DeepEquals, data)
+}
@@ -0,0 +1,250 @@
+package warc
+
+/*
+	Copyright (C) 2015  Wolfgang Meyers
+
+    This program is free software; you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation; either version 2 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License along
+    with this program; if not, write to the Free Software Foundation, Inc.,
+    51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+*/
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var ErrRecordNotFound error = errors.New("Record not found")
+
+// Revisits referring to revisits are followed at most this many times.
+var MAX_REVISIT_DEPTH int = 10
+
+// RecordLookup finds the original records that revisit records refer to.
+// Both methods return ErrRecordNotFound if there is no matching record.
+type RecordLookup interface {
+	// Returns the record with the given WARC-Record-ID.
+	GetRecordById(id string) (*WARCRecord, error)
+	// Returns the capture of uri made at date. If date is empty or there is
+	// no capture at that date, the latest capture with the given payload
+	// digest is returned instead. Revisit records are never returned.
+	GetRecordByURI(uri string, date string, digest string) (*WARCRecord, error)
+}
+
+// Identifies a record by the file it is stored in and its offset in that file.
+type RecordLocation struct {
+	Filename string
+	Offset   int64
+}
+
+type indexEntry struct {
+	location RecordLocation
+	date     string
+	digest   string
+}
+
+type segmentEntry struct {
+	location    RecordLocation
+	number      int
+	length      int
+	totalLength int
+}
+
+// RecordIndex is a RecordLookup over records stored in one or more WARC files.
+// Only the location of each record is kept in memory; records are read from
+// their files when they are looked up.
+type RecordIndex struct {
+	byId  map[string]*indexEntry
+	byURI map[string][]*indexEntry
+	// continuation records by WARC-Segment-Origin-ID
+	segments map[string][]*segmentEntry
+	lock     sync.RWMutex
+}
+
+func NewRecordIndex() *RecordIndex {
+	return &RecordIndex{
+		byId:     map[string]*indexEntry{},
+		byURI:    map[string][]*indexEntry{},
+		segments: map[string][]*segmentEntry{},
+	}
+}
+
+// Adds a record that was read from filename to the index.
+func (ri *RecordIndex) Add(record *WARCRecord, filename string) {
+	entry := &indexEntry{
+		location: RecordLocation{filename, int64(record.Offset())},
+		date:     record.GetDate(),
+		digest:   record.GetChecksum(),
+	}
+	ri.lock.Lock()
+	defer ri.lock.Unlock()
+	if id := record.GetHeader().GetRecordId(); id != "" {
+		ri.byId[id] = entry
+	}
+	t := record.GetType()
+	if t == "continuation" {
+		origin, _ := record.Get("WARC-Segment-Origin-ID")
+		number, _ := record.Get("WARC-Segment-Number")
+		totalLength, _ := record.Get("WARC-Segment-Total-Length")
+		segment := &segmentEntry{
+			location: entry.location,
+			length:   record.GetHeader().GetContentLength(),
+		}
+		segment.number, _ = strconv.Atoi(number)
+		segment.totalLength, _ = strconv.Atoi(totalLength)
+		ri.segments[origin] = append(ri.segments[origin], segment)
+	}
+	if (t == "response" || t == "resource") && record.GetUrl() != "" {
+		ri.byURI[record.GetUrl()] = append(ri.byURI[record.GetUrl()], entry)
+	}
+}
+
+// Reads all records of the WARC file at filename and adds them to the index.
+func (ri *RecordIndex) AddFile(filename string) error {
+	f, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	wf, err := NewWARCFile(f)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	defer wf.Close()
+	for {
+		record, err := wf.ReadRecord()
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return errors.New(fmt.Sprintf("%v: %v", filename, err))
+		}
+		ri.Add(record, filename)
+	}
+}
+
+// Returns the location of the record with the given WARC-Record-ID.
+func (ri *RecordIndex) LookupId(id string) (RecordLocation, bool) {
+	ri.lock.RLock()
+	defer ri.lock.RUnlock()
+	entry, exists := ri.byId[id]
+	if !exists {
+		return RecordLocation{}, false
+	}
+	return entry.location, true
+}
+
+// Returns the location of the capture of uri, see RecordLookup.GetRecordByURI
+func (ri *RecordIndex) LookupURI(uri string, date string, digest string) (RecordLocation, bool) {
+	ri.lock.RLock()
+	defer ri.lock.RUnlock()
+	var found *indexEntry
+	for _, entry := range ri.byURI[uri] {
+		if date != "" && entry.date == date && (digest == "" || entry.digest == digest) {
+			return entry.location, true
+		}
+		if digest != "" && entry.digest == digest && (found == nil || entry.date > found.date) {
+			found = entry
+		}
+	}
+	if found == nil {
+		return RecordLocation{}, false
+	}
+	return found.location, true
+}
+
+func (ri *RecordIndex) GetRecordById(id string) (*WARCRecord, error) {
+	location, exists := ri.LookupId(id)
+	if !exists {
+		return nil, ErrRecordNotFound
+	}
+	return ri.load(location)
+}
+
+func (ri *RecordIndex) GetRecordByURI(uri string, date string, digest string) (*WARCRecord, error) {
+	location, exists := ri.LookupURI(uri, date, digest)
+	if !exists {
+		return nil, ErrRecordNotFound
+	}
+	return ri.load(location)
+}
+
+func (ri *RecordIndex) load(location RecordLocation) (*WARCRecord, error) {
+	f, err := os.Open(location.Filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadRecordAt(f, location.Offset)
+}
+
+// Finds the record holding the payload of a revisit record,
+// following revisits that refer to other revisits.
+func findOriginal(revisit *WARCRecord, lookup RecordLookup) (*WARCRecord, error) {
+	record := revisit
+	for depth := 0; depth < MAX_REVISIT_DEPTH; depth++ {
+		var original *WARCRecord
+		var err error = ErrRecordNotFound
+		if id, exists := record.Get("WARC-Refers-To"); exists && id != "" {
+			original, err = lookup.GetRecordById(id)
+			if err != nil && err != ErrRecordNotFound {
+				return nil, err
+			}
+		}
+		if err == ErrRecordNotFound {
+			uri, exists := record.Get("WARC-Refers-To-Target-URI")
+			if !exists {
+				uri = record.GetUrl()
+			}
+			date, _ := record.Get("WARC-Refers-To-Date")
+			original, err = lookup.GetRecordByURI(uri, date, record.GetChecksum())
+			if err != nil {
+				return nil, err
+			}
+		}
+		if original.GetType() != "revisit" {
+			return original, nil
+		}
+		record = original
+	}
+	return nil, errors.New(fmt.Sprintf("Too many nested revisits for %v", revisit.GetHeader().GetRecordId()))
+}
+
+// Combines a revisit record with the original record it refers to.
+func mergeRevisit(revisit *WARCRecord, original *WARCRecord) *WARCRecord {
+	header := revisit.GetHeader().Copy()
+	block := original.GetPayload().GetData()
+	revisitMessage, revisitErr := revisit.GetHTTPMessage()
+	originalMessage, originalErr := original.GetHTTPMessage()
+	profile, _ := revisit.Get("WARC-Profile")
+	notModified := strings.HasSuffix(profile, "/server-not-modified") ||
+		(revisitErr == nil && revisitMessage.StatusCode() == 304)
+	if revisitErr == nil && originalErr == nil && !notModified {
+		block = append(append([]byte{}, revisitMessage.HeaderBytes()...), originalMessage.Body...)
+	} else if contentType, exists := original.Get("Content-Type"); exists {
+		// the whole original block is used, including its HTTP headers, if any
+		header.Set("Content-Type", contentType)
+	}
+	header.Set("WARC-Type", "response")
+	header.Set("Content-Length", strconv.Itoa(len(block)))
+	header.Set("WARC-Refers-To", original.GetHeader().GetRecordId())
+	header.Delete("WARC-Profile")
+	header.Delete("WARC-Truncated")
+	header.Delete("WARC-Block-Digest")
+	record := NewWARCRecordFromBytes(nil, block)
+	record.header = header
+	record.offset = revisit.offset
+	return record
+}
@@ -0,0 +1,92 @@
+package warc
+
+import (
+	. "gopkg.in/check.v1"
+	"os"
+	"path/filepath"
+)
+
+type ResolveSuite struct {
+	index    *RecordIndex
+	original *WARCRecord
+	revisit  *WARCRecord
+}
+
+var resolveSuite = Suite(&ResolveSuite{})
+
+func writeWarcFile(c *C, path string, records ...*WARCRecord) {
+	f, err := os.Create(path)
+	c.Assert(err, IsNil)
+	defer f.Close()
+	writer := NewWARCWriter(f, true)
+	for _, record := range records {
+		_, err := writer.WriteRecord(record)
+		c.Assert(err, IsNil)
+	}
+}
+
+func (s *ResolveSuite) SetUpTest(c *C) {
+	dir := c.MkDir()
+	dedup := NewMemoryDedupIndex()
+	warcinfo := NewWARCRecordFromBytes(map[string]string{"WARC-Type": "warcinfo"}, []byte("software: go-warc\r\n"))
+	s.original = getSampleResponse("http://example.com/a", "Helloworld")
+	Deduplicate(s.original, dedup)
+	writeWarcFile(c, filepath.Join(dir, "first.warc.gz"), warcinfo, s.original)
+
+	second := NewWARCRecordFromBytes(map[string]string{
+		"WARC-Type":       "response",
+		"WARC-Target-URI": "http://example.com/b",
+		"WARC-Date":       "2013-02-10T16:15:52Z",
+	}, []byte("HTTP/1.1 200 OK\r\nContent-Type: text/plain\r\nX-Second: yes\r\n\r\nHelloworld"))
+	revisit, err := Deduplicate(second, dedup)
+	c.Assert(err, IsNil)
+	s.revisit = revisit
+	writeWarcFile(c, filepath.Join(dir, "second.warc.gz"), s.revisit)
+
+	s.index = NewRecordIndex()
+	c.Assert(s.index.AddFile(filepath.Join(dir, "first.warc.gz")), IsNil)
+	c.Assert(s.index.AddFile(filepath.Join(dir, "second.warc.gz")), IsNil)
+}
+
+func (s *ResolveSuite) checkResolved(c *C, record *WARCRecord) {
+	c.Assert(record.GetType(), Equals, "response")
+	c.Assert(record.GetUrl(), Equals, "http://example.com/b")
+	v, _ := record.Get("WARC-Refers-To")
+	c.Assert(v, Equals, s.original.GetHeader().GetRecordId())
+	message, err := record.GetHTTPMessage()
+	c.Assert(err, IsNil)
+	c.Assert(message.Header.Get("X-Second"), Equals, "yes")
+	c.Assert(string(message.Body), Equals, "Helloworld")
+	c.Assert(record.GetHeader().GetContentLength(), Equals, len(record.GetPayload().GetData()))
+}
+
+func (s *ResolveSuite) TestResolveByRecordId(c *C) {
+	record, err := s.revisit.ResolveRevisit(s.index)
+	c.Assert(err, IsNil)
+	s.checkResolved(c, record)
+}
+
+func (s *ResolveSuite) TestResolveByURIAndDate(c *C) {
+	s.revisit.GetHeader().Delete("WARC-Refers-To")
+	record, err := s.revisit.ResolveRevisit(s.index)
+	c.Assert(err, IsNil)
+	s.checkResolved(c, record)
+
+	s.revisit.GetHeader().Delete("WARC-Refers-To-Date")
+	record, err = s.revisit.ResolveRevisit(s.index)
+	c.Assert(err, IsNil)
+	s.checkResolved(c, record)
+}
+
+func (s *ResolveSuite) TestNotFound(c *C) {
+	s.revisit.Set("WARC-Refers-To", "<urn:uuid:unknown>")
+	s.revisit.Set("WARC-Refers-To-Target-URI", "http://example.com/unknown")
+	_, err := s.revisit.ResolveRevisit(s.index)
+	c.Assert(err, Equals, ErrRecordNotFound)
+}
+
+func (s *ResolveSuite) TestNotRevisit(c *C) {
+	record, err := s.original.ResolveRevisit(s.index)
+	c.Assert(err, IsNil)
+	c.Assert(record, Equals, s.original)
+}
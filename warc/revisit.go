@@ -0,0 +1,240 @@
+package warc
+
+/*
+	Copyright (C) 2015  Wolfgang Meyers
+
+    This program is free software; you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation; either version 2 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License along
+    with this program; if not, write to the Free Software Foundation, Inc.,
+    51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+*/
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+// WARC-Profile values of revisit records
+var PROFILE_IDENTICAL_PAYLOAD_DIGEST string = "http://netpreserve.org/warc/1.0/revisit/identical-payload-digest"
+var PROFILE_SERVER_NOT_MODIFIED string = "http://netpreserve.org/warc/1.0/revisit/server-not-modified"
+
+// The same profiles as defined by WARC 1.1
+var PROFILE_IDENTICAL_PAYLOAD_DIGEST_1_1 string = "http://netpreserve.org/warc/1.1/revisit/identical-payload-digest"
+var PROFILE_SERVER_NOT_MODIFIED_1_1 string = "http://netpreserve.org/warc/1.1/revisit/server-not-modified"
+
+// A DedupEntry describes a previously archived record that a revisit
+// record can refer to.
+type DedupEntry struct {
+	PayloadDigest string
+	RecordId      string
+	TargetURI     string
+	Date          string
+}
+
+// Creates a DedupEntry describing record. The payload digest is taken from
+// the WARC-Payload-Digest header, or computed if the header is missing.
+func NewDedupEntry(record *WARCRecord) *DedupEntry {
+	digest := record.GetChecksum()
+	if digest == "" {
+		digest = ComputePayloadDigest(record)
+	}
+	return &DedupEntry{
+		PayloadDigest: digest,
+		RecordId:      record.GetHeader().GetRecordId(),
+		TargetURI:     record.GetUrl(),
+		Date:          record.GetDate(),
+	}
+}
+
+// DedupIndex looks up previously archived payloads by payload digest.
+// Implementations must be safe for concurrent use.
+type DedupIndex interface {
+	// Returns the entry for the first record archived with the given payload digest.
+	Lookup(digest string) (*DedupEntry, bool)
+	// Adds an entry. Entries for digests that are already known are ignored.
+	Add(entry *DedupEntry) error
+}
+
+// MemoryDedupIndex is a DedupIndex that is kept in memory.
+type MemoryDedupIndex struct {
+	entries map[string]*DedupEntry
+	lock    sync.RWMutex
+}
+
+func NewMemoryDedupIndex() *MemoryDedupIndex {
+	return &MemoryDedupIndex{entries: map[string]*DedupEntry{}}
+}
+
+func (mi *MemoryDedupIndex) Lookup(digest string) (*DedupEntry, bool) {
+	mi.lock.RLock()
+	defer mi.lock.RUnlock()
+	entry, exists := mi.entries[digest]
+	return entry, exists
+}
+
+func (mi *MemoryDedupIndex) Add(entry *DedupEntry) error {
+	mi.add(entry)
+	return nil
+}
+
+func (mi *MemoryDedupIndex) add(entry *DedupEntry) bool {
+	mi.lock.Lock()
+	defer mi.lock.Unlock()
+	if _, exists := mi.entries[entry.PayloadDigest]; exists {
+		return false
+	}
+	mi.entries[entry.PayloadDigest] = entry
+	return true
+}
+
+// The number of entries in the index.
+func (mi *MemoryDedupIndex) Len() int {
+	mi.lock.RLock()
+	defer mi.lock.RUnlock()
+	return len(mi.entries)
+}
+
+// FileDedupIndex is a DedupIndex that is persisted in a text file, so that
+// it can be reused across crawls. Each line holds one entry with the
+// tab-separated fields digest, record id, target uri and date.
+// The file is read completely when the index is opened, and new entries
+// are appended to it as they are added.
+type FileDedupIndex struct {
+	*MemoryDedupIndex
+	file *os.File
+	lock sync.Mutex
+}
+
+// Opens the dedup index stored at path, creating the file if it does not exist.
+func NewFileDedupIndex(path string) (*FileDedupIndex, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	index := &FileDedupIndex{
+		MemoryDedupIndex: NewMemoryDedupIndex(),
+		file:             file,
+	}
+	scanner := bufio.NewScanner(file)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := scanner.Text()
+		if line == "" {
+			continue
+		}
+		fields := strings.Split(line, "\t")
+		if len(fields) != 4 {
+			file.Close()
+			return nil, errors.New(fmt.Sprintf("Bad dedup index line %v: %v", lineNumber, line))
+		}
+		index.add(&DedupEntry{
+			PayloadDigest: fields[0],
+			RecordId:      fields[1],
+			TargetURI:     fields[2],
+			Date:          fields[3],
+		})
+	}
+	if err := scanner.Err(); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return index, nil
+}
+
+func (fi *FileDedupIndex) Add(entry *DedupEntry) error {
+	fi.lock.Lock()
+	defer fi.lock.Unlock()
+	if !fi.add(entry) {
+		return nil
+	}
+	line := strings.Join([]string{entry.PayloadDigest, entry.RecordId, entry.TargetURI, entry.Date}, "\t")
+	_, err := fi.file.Write([]byte(line + "\n"))
+	return err
+}
+
+func (fi *FileDedupIndex) Close() error {
+	return fi.file.Close()
+}
+
+// Creates a revisit record for targetUri. httpHeaders holds the HTTP status
+// line and headers of the new capture, which form the block of the record.
+//
+// For the identical-payload-digest profile, original must describe the
+// record holding the payload. For the server-not-modified profile original
+// may be nil if the earlier capture is not known.
+func NewRevisitRecord(profile string, targetUri string, date string, httpHeaders []byte, original *DedupEntry) *WARCRecord {
+	headers := map[string]string{
+		"WARC-Type":       "revisit",
+		"WARC-Profile":    profile,
+		"WARC-Target-URI": targetUri,
+		"Content-Type":    CONTENT_TYPES["revisit"],
+	}
+	if date != "" {
+		headers["WARC-Date"] = date
+	}
+	if original != nil {
+		if original.RecordId != "" {
+			headers["WARC-Refers-To"] = original.RecordId
+		}
+		if original.TargetURI != "" {
+			headers["WARC-Refers-To-Target-URI"] = original.TargetURI
+		}
+		if original.Date != "" {
+			headers["WARC-Refers-To-Date"] = original.Date
+		}
+		if original.PayloadDigest != "" {
+			headers["WARC-Payload-Digest"] = original.PayloadDigest
+		}
+	}
+	return NewWARCRecordFromBytes(headers, httpHeaders)
+}
+
+// Checks a response record against index. If a record with the same payload
+// digest was archived before, a revisit record referring to it is returned
+// in place of the response. Otherwise the response is added to the index
+// and returned unchanged. Records of other types are returned unchanged.
+//
+// Lookups are by payload digest only, so a payload archived under one URL
+// is also deduplicated when it is fetched from another.
+func Deduplicate(record *WARCRecord, index DedupIndex) (*WARCRecord, error) {
+	if record.GetType() != "response" {
+		return record, nil
+	}
+	message, err := record.GetHTTPMessage()
+	if err != nil {
+		return nil, err
+	}
+	if record.GetChecksum() == "" {
+		record.Set("WARC-Payload-Digest", ComputeDigest(message.Body))
+	}
+	entry := NewDedupEntry(record)
+	original, exists := index.Lookup(entry.PayloadDigest)
+	if !exists {
+		return record, index.Add(entry)
+	}
+	profile := PROFILE_IDENTICAL_PAYLOAD_DIGEST
+	if record.GetHeader().GetVersion() == "WARC/1.1" {
+		profile = PROFILE_IDENTICAL_PAYLOAD_DIGEST_1_1
+	}
+	revisit := NewRevisitRecord(profile, record.GetUrl(), record.GetDate(), message.HeaderBytes(), original)
+	revisit.GetHeader().SetVersion(record.GetHeader().GetVersion())
+	for _, name := range []string{"WARC-IP-Address", "WARC-Warcinfo-ID", "WARC-Concurrent-To"} {
+		if value, exists := record.Get(name); exists {
+			revisit.Set(name, value)
+		}
+	}
+	return revisit, nil
+}
@@ -0,0 +1,92 @@
+package warc
+
+import (
+	. "gopkg.in/check.v1"
+	"os"
+	"path/filepath"
+)
+
+func getSampleResponse(url string, body string) *WARCRecord {
+	return NewWARCRecordFromBytes(map[string]string{
+		"WARC-Type":       "response",
+		"WARC-Target-URI": url,
+		"WARC-Date":       "2012-02-10T16:15:52Z",
+	}, []byte("HTTP/1.1 200 OK\r\nContent-Type: text/plain\r\n\r\n"+body))
+}
+
+type RevisitSuite struct{}
+
+var revisitSuite = Suite(&RevisitSuite{})
+
+func (s *RevisitSuite) TestHTTPMessage(c *C) {
+	message, err := getSampleResponse("http://example.com/", "Helloworld").GetHTTPMessage()
+	c.Assert(err, IsNil)
+	c.Assert(message.StatusCode(), Equals, 200)
+	c.Assert(message.Header.Get("Content-Type"), Equals, "text/plain")
+	c.Assert(string(message.Body), Equals, "Helloworld")
+	c.Assert(string(message.HeaderBytes()), Equals, "HTTP/1.1 200 OK\r\nContent-Type: text/plain\r\n\r\n")
+}
+
+func (s *RevisitSuite) TestDeduplicate(c *C) {
+	index := NewMemoryDedupIndex()
+	first := getSampleResponse("http://example.com/a", "Helloworld")
+	record, err := Deduplicate(first, index)
+	c.Assert(err, IsNil)
+	c.Assert(record, Equals, first)
+	c.Assert(first.GetChecksum(), Equals, "sha1:DQ6D7IFDFK7TI45D5CHQPI3XAJPCRQB6")
+
+	// same payload from a different url
+	second := getSampleResponse("http://example.com/b", "Helloworld")
+	record, err = Deduplicate(second, index)
+	c.Assert(err, IsNil)
+	c.Assert(record.GetType(), Equals, "revisit")
+	c.Assert(record.GetUrl(), Equals, "http://example.com/b")
+	v, _ := record.Get("WARC-Profile")
+	c.Assert(v, Equals, PROFILE_IDENTICAL_PAYLOAD_DIGEST)
+	v, _ = record.Get("WARC-Refers-To")
+	c.Assert(v, Equals, first.GetHeader().GetRecordId())
+	v, _ = record.Get("WARC-Refers-To-Target-URI")
+	c.Assert(v, Equals, "http://example.com/a")
+	v, _ = record.Get("WARC-Refers-To-Date")
+	c.Assert(v, Equals, "2012-02-10T16:15:52Z")
+	c.Assert(record.GetChecksum(), Equals, first.GetChecksum())
+	c.Assert(string(record.GetPayload().GetData()), Equals, "HTTP/1.1 200 OK\r\nContent-Type: text/plain\r\n\r\n")
+
+	third := getSampleResponse("http://example.com/a", "Goodbye")
+	record, err = Deduplicate(third, index)
+	c.Assert(err, IsNil)
+	c.Assert(record.GetType(), Equals, "response")
+	c.Assert(index.Len(), Equals, 2)
+}
+
+func (s *RevisitSuite) TestServerNotModified(c *C) {
+	record := NewRevisitRecord(PROFILE_SERVER_NOT_MODIFIED, "http://example.com/", "",
+		[]byte("HTTP/1.1 304 Not Modified\r\n\r\n"), nil)
+	c.Assert(record.GetType(), Equals, "revisit")
+	_, exists := record.Get("WARC-Refers-To")
+	c.Assert(exists, Equals, false)
+	message, err := record.GetHTTPMessage()
+	c.Assert(err, IsNil)
+	c.Assert(message.StatusCode(), Equals, 304)
+}
+
+func (s *RevisitSuite) TestFileDedupIndex(c *C) {
+	path := filepath.Join(c.MkDir(), "dedup.idx")
+	index, err := NewFileDedupIndex(path)
+	c.Assert(err, IsNil)
+	err = index.Add(NewDedupEntry(getSampleResponse("http://example.com/", "Helloworld")))
+	c.Assert(err, IsNil)
+	c.Assert(index.Close(), IsNil)
+
+	index, err = NewFileDedupIndex(path)
+	c.Assert(err, IsNil)
+	defer index.Close()
+	entry, exists := index.Lookup("sha1:DQ6D7IFDFK7TI45D5CHQPI3XAJPCRQB6")
+	c.Assert(exists, Equals, true)
+	c.Assert(entry.TargetURI, Equals, "http://example.com/")
+	c.Assert(entry.Date, Equals, "2012-02-10T16:15:52Z")
+
+	os.WriteFile(path, []byte("garbage\n"), 0644)
+	_, err = NewFileDedupIndex(path)
+	c.Assert(err, NotNil)
+}
@@ -0,0 +1,162 @@
+package warc
+
+/*
+	Copyright (C) 2015  Wolfgang Meyers
+
+    This program is free software; you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation; either version 2 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License along
+    with this program; if not, write to the Free Software Foundation, Inc.,
+    51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+*/
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/wolfgangmeyers/go-warc/warc/utils"
+	"io"
+	"sort"
+	"strconv"
+)
+
+// Whether record is the first segment of a segmented record.
+func IsFirstSegment(record *WARCRecord) bool {
+	number, _ := record.Get("WARC-Segment-Number")
+	return number == "1" && record.GetType() != "continuation"
+}
+
+// Reassembles a segmented record from its first segment. The continuation
+// records are located through the index, which must contain all files
+// holding segments of the record. The payload of the returned record is
+// streamed: continuation records are read one at a time as it is consumed.
+func (ri *RecordIndex) Reassemble(first *WARCRecord) (*WARCRecord, error) {
+	id := first.GetHeader().GetRecordId()
+	ri.lock.RLock()
+	segments := append([]*segmentEntry{}, ri.segments[id]...)
+	ri.lock.RUnlock()
+	sort.Slice(segments, func(i, j int) bool {
+		return segments[i].number < segments[j].number
+	})
+	totalLength := first.GetHeader().GetContentLength()
+	locations := []RecordLocation{}
+	for i, segment := range segments {
+		if segment.number != i+2 {
+			return nil, errors.New(fmt.Sprintf("Missing segment %v of %v", i+2, id))
+		}
+		totalLength += segment.length
+		locations = append(locations, segment.location)
+	}
+	if len(segments) == 0 || segments[len(segments)-1].totalLength == 0 {
+		return nil, errors.New(fmt.Sprintf("Missing last segment of %v", id))
+	}
+	if expected := segments[len(segments)-1].totalLength; expected != totalLength {
+		return nil, errors.New(fmt.Sprintf("Segments of %v have length %v, expected %v", id, totalLength, expected))
+	}
+	header := first.GetHeader().Copy()
+	header.Delete("WARC-Segment-Number")
+	header.Delete("WARC-Block-Digest")
+	header.Set("Content-Length", strconv.Itoa(totalLength))
+	firstData := first.GetPayload().GetData()
+	reader := io.MultiReader(
+		bytes.NewReader(firstData),
+		&segmentReader{index: ri, id: id, locations: locations, length: totalLength - len(firstData)},
+	)
+	record := NewWARCRecord(header, utils.NewStreamingFilePart(reader, totalLength), nil)
+	record.offset = first.offset
+	return record, nil
+}
+
+// Reads the payloads of continuation records one after the other,
+// failing at the end if they do not add up to length bytes.
+type segmentReader struct {
+	index     *RecordIndex
+	id        string
+	locations []RecordLocation
+	current   io.Reader
+	read      int
+	length    int
+}
+
+func (sr *segmentReader) Read(p []byte) (int, error) {
+	for {
+		if sr.current != nil {
+			n, err := sr.current.Read(p)
+			sr.read += n
+			if n > 0 || err != io.EOF {
+				return n, err
+			}
+			sr.current = nil
+		}
+		if len(sr.locations) == 0 {
+			if sr.read != sr.length {
+				return 0, errors.New(fmt.Sprintf("Continuation records of %v hold %v bytes, expected %v", sr.id, sr.read, sr.length))
+			}
+			return 0, io.EOF
+		}
+		record, err := sr.index.load(sr.locations[0])
+		if err != nil {
+			return 0, err
+		}
+		sr.locations = sr.locations[1:]
+		sr.current = bytes.NewReader(record.GetPayload().GetData())
+	}
+}
+
+// Splits record into segments with blocks of at most segmentSize bytes.
+// The first segment keeps the headers of record; the others are
+// continuation records referring to it through WARC-Segment-Origin-ID.
+// A record that fits into a single segment is returned unchanged.
+func SegmentRecord(record *WARCRecord, segmentSize int) []*WARCRecord {
+	data := []byte{}
+	if record.GetPayload() != nil {
+		data = record.GetPayload().GetData()
+	}
+	if len(data) <= segmentSize {
+		return []*WARCRecord{record}
+	}
+	originId := record.GetHeader().GetRecordId()
+	segments := []*WARCRecord{}
+	for start, number := 0, 1; start < len(data); start, number = start+segmentSize, number+1 {
+		end := start + segmentSize
+		if end > len(data) {
+			end = len(data)
+		}
+		var header *WARCHeader
+		if number == 1 {
+			header = record.GetHeader().Copy()
+		} else {
+			header = NewWARCHeader(map[string]string{
+				"WARC-Type":              "continuation",
+				"WARC-Segment-Origin-ID": originId,
+				"WARC-Date":              record.GetDate(),
+			}, false)
+			header.SetVersion(record.GetHeader().GetVersion())
+			for _, name := range []string{"WARC-Target-URI", "WARC-Warcinfo-ID"} {
+				if value, exists := record.Get(name); exists {
+					header.Set(name, value)
+				}
+			}
+			header.Set("WARC-Record-ID", NewRecordId())
+			if end == len(data) {
+				header.Set("WARC-Segment-Total-Length", strconv.Itoa(len(data)))
+			}
+		}
+		header.Set("WARC-Segment-Number", strconv.Itoa(number))
+		header.Set("Content-Length", strconv.Itoa(end-start))
+		header.Set("WARC-Block-Digest", ComputeDigest(data[start:end]))
+		payload, err := utils.NewFilePart(bytes.NewReader(data[start:end]), end-start)
+		if err != nil {
+			panic(err)
+		}
+		segments = append(segments, NewWARCRecord(header, payload, nil))
+	}
+	return segments
+}
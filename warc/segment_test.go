@@ -0,0 +1,139 @@
+package warc
+
+import (
+	. "gopkg.in/check.v1"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+type SegmentSuite struct{}
+
+var segmentSuite = Suite(&SegmentSuite{})
+
+func (s *SegmentSuite) TestSegmentRecord(c *C) {
+	record := NewWARCRecordFromBytes(map[string]string{
+		"WARC-Type":       "resource",
+		"WARC-Target-URI": "file:///disk.img",
+	}, []byte(strings.Repeat("x", 25)))
+	segments := SegmentRecord(record, 10)
+	c.Assert(len(segments), Equals, 3)
+	c.Assert(segments[0].GetType(), Equals, "resource")
+	c.Assert(IsFirstSegment(segments[0]), Equals, true)
+	c.Assert(segments[1].GetType(), Equals, "continuation")
+	v, _ := segments[2].Get("WARC-Segment-Origin-ID")
+	c.Assert(v, Equals, record.GetHeader().GetRecordId())
+	v, _ = segments[2].Get("WARC-Segment-Number")
+	c.Assert(v, Equals, "3")
+	v, _ = segments[2].Get("WARC-Segment-Total-Length")
+	c.Assert(v, Equals, "25")
+	_, exists := segments[1].Get("WARC-Segment-Total-Length")
+	c.Assert(exists, Equals, false)
+	c.Assert(segments[2].GetHeader().GetContentLength(), Equals, 5)
+
+	c.Assert(len(SegmentRecord(record, 25)), Equals, 1)
+}
+
+func (s *SegmentSuite) TestRotateAndReassemble(c *C) {
+	dir := c.MkDir()
+	writer := NewRotatingWARCWriter(filepath.Join(dir, "crawl-%05d.warc.gz"), 100, true)
+	small := NewWARCRecordFromBytes(map[string]string{"WARC-Type": "resource"}, []byte("small"))
+	data := strings.Repeat("0123456789", 25)
+	large := NewWARCRecordFromBytes(map[string]string{"WARC-Type": "resource"}, []byte(data))
+	for _, record := range []*WARCRecord{small, large, small} {
+		_, _, err := writer.WriteRecord(record)
+		c.Assert(err, IsNil)
+	}
+	c.Assert(writer.Close(), IsNil)
+	filenames := writer.Filenames()
+	c.Assert(len(filenames), Equals, 5)
+	c.Assert(filepath.Base(filenames[0]), Equals, "crawl-00000.warc.gz")
+
+	index := NewRecordIndex()
+	for _, filename := range filenames {
+		c.Assert(index.AddFile(filename), IsNil)
+	}
+	records := []*WARCRecord{}
+	for _, filename := range filenames {
+		f, err := os.Open(filename)
+		c.Assert(err, IsNil)
+		wf, err := NewWARCFile(f)
+		c.Assert(err, IsNil)
+		wf.GetReader().SetSegmentIndex(index)
+		for {
+			record, err := wf.ReadRecord()
+			if err != nil {
+				break
+			}
+			records = append(records, record)
+		}
+		wf.Close()
+	}
+	c.Assert(len(records), Equals, 3)
+	c.Assert(string(records[0].GetPayload().GetData()), Equals, "small")
+	c.Assert(string(records[2].GetPayload().GetData()), Equals, "small")
+	record := records[1]
+	c.Assert(record.GetHeader().GetRecordId(), Equals, large.GetHeader().GetRecordId())
+	c.Assert(record.GetHeader().GetContentLength(), Equals, 250)
+	c.Assert(record.GetPayload().IsStreaming(), Equals, true)
+	payload, err := io.ReadAll(record.GetPayload().GetReader())
+	c.Assert(err, IsNil)
+	c.Assert(string(payload), Equals, data)
+}
+
+func (s *SegmentSuite) TestMissingSegment(c *C) {
+	dir := c.MkDir()
+	writer := NewRotatingWARCWriter(filepath.Join(dir, "crawl-%05d.warc"), 10, false)
+	large := NewWARCRecordFromBytes(map[string]string{"WARC-Type": "resource"}, []byte(strings.Repeat("x", 25)))
+	_, _, err := writer.WriteRecord(large)
+	c.Assert(err, IsNil)
+	writer.Close()
+	c.Assert(len(writer.Filenames()), Equals, 3)
+	segments := SegmentRecord(large, 10)
+	index := NewRecordIndex()
+	_, err = index.Reassemble(segments[0])
+	c.Assert(err, NotNil)
+}
+
+func (s *SegmentSuite) TestShortContinuation(c *C) {
+	dir := c.MkDir()
+	large := NewWARCRecordFromBytes(map[string]string{"WARC-Type": "resource"}, []byte(strings.Repeat("x", 25)))
+	segments := SegmentRecord(large, 10)
+	write := func(name string, records ...*WARCRecord) string {
+		f, err := os.Create(filepath.Join(dir, name))
+		c.Assert(err, IsNil)
+		writer := NewWARCWriter(f, false)
+		for _, record := range records {
+			_, err := writer.WriteRecord(record)
+			c.Assert(err, IsNil)
+		}
+		c.Assert(f.Close(), IsNil)
+		return f.Name()
+	}
+	first := write("first.warc", segments[0], segments[1])
+	last := write("last.warc", segments[2])
+	index := NewRecordIndex()
+	c.Assert(index.AddFile(first), IsNil)
+	c.Assert(index.AddFile(last), IsNil)
+	// the last segment loses bytes after it was indexed
+	short := NewWARCRecordFromBytes(map[string]string{}, []byte("xxx"))
+	for _, name := range segments[2].GetHeader().Keys() {
+		if name != "content-length" && name != "warc-block-digest" {
+			value, _ := segments[2].Get(name)
+			short.Set(name, value)
+		}
+	}
+	write("last.warc", short)
+
+	record, err := index.Reassemble(segments[0])
+	c.Assert(err, IsNil)
+	data := record.GetPayload().GetData()
+	c.Assert(len(data), Equals, 23)
+	c.Assert(record.GetPayload().Err(), ErrorMatches, "Continuation records of .* hold 13 bytes, expected 15")
+
+	record, err = index.Reassemble(segments[0])
+	c.Assert(err, IsNil)
+	_, err = record.WriteTo(io.Discard)
+	c.Assert(err, ErrorMatches, "Continuation records of .* hold 13 bytes, expected 15")
+}
@@ -0,0 +1,208 @@
+package warc
+
+/*
+	Copyright (C) 2015  Wolfgang Meyers
+
+    This program is free software; you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation; either version 2 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License along
+    with this program; if not, write to the Free Software Foundation, Inc.,
+    51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+*/
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"github.com/klauspost/compress/zstd"
+	"github.com/wolfgangmeyers/go-warc/warc/utils"
+	"io"
+)
+
+// recordStream provides the decompressed content of a file that is either
+// uncompressed, made of gzip members or made of zstd frames, and keeps track
+// of offsets. Records may span all of an uncompressed file, but must not
+// span gzip members or zstd frames.
+type recordStream struct {
+	// the file that gzip members are read from
+	source io.Reader
+	// reports the position in the file, or -1 if it is not known
+	position func() int64
+	// nil for uncompressed files
+	gzipfile *gzip.Reader
+	// the file that zstd frames are read from, nil unless it is a .warc.zst file
+	zstdfile    *bufio.Reader
+	zstdDecoder *zstd.Decoder
+	// decompressed content of the current gzip member, or the file itself
+	reader       *bufio.Reader
+	memberOffset int64
+	// if set, reads fail once it is done
+	ctx context.Context
+}
+
+// contextReader fails reads once the context of its stream is done, so
+// that reading a record can be cancelled between any two reads.
+type contextReader struct {
+	// nil if reads are not guarded
+	stream *recordStream
+	reader io.Reader
+}
+
+func (cr *contextReader) Read(p []byte) (int, error) {
+	if cr.stream == nil {
+		return cr.reader.Read(p)
+	}
+	if ctx := cr.stream.ctx; ctx != nil && ctx.Err() != nil {
+		return 0, ctx.Err()
+	}
+	return cr.reader.Read(p)
+}
+
+// Returns reader, failing reads once the context of the stream is done.
+func (rs *recordStream) guard(reader io.Reader) io.Reader {
+	return &contextReader{stream: rs, reader: reader}
+}
+
+func isGzip(filebuf *bufio.Reader) bool {
+	magic, err := filebuf.Peek(2)
+	return err == nil && magic[0] == 0x1f && magic[1] == 0x8b
+}
+
+// Creates a recordStream reading from reader. The dictionary is used for
+// zstd frames if the stream does not start with a dictionary of its own,
+// which is the case when reading from the middle of a .warc.zst file.
+func newRecordStream(reader io.Reader, dictionary []byte) (*recordStream, error) {
+	rs := &recordStream{}
+	counter := utils.NewCountingReader(reader)
+	// uncompressed files are guarded as they are read, compressed
+	// ones as they are decompressed, see below
+	guarded := &contextReader{stream: rs, reader: counter}
+	filebuf := bufio.NewReader(guarded)
+	rs.source = filebuf
+	// the gzip reader reads from the buffer one byte at a time, so the
+	// position in the file is what has been read minus what is still buffered.
+	rs.position = func() int64 {
+		return counter.Count() - int64(filebuf.Buffered())
+	}
+	rs.reader = filebuf
+	if isGzip(filebuf) || isZstd(filebuf) {
+		// a read that fails would break the decompressor
+		guarded.stream = nil
+	}
+	if isGzip(filebuf) {
+		gzipfile, err := gzip.NewReader(filebuf)
+		if err != nil {
+			return nil, err
+		}
+		gzipfile.Multistream(false)
+		rs.gzipfile = gzipfile
+		rs.reader = bufio.NewReader(rs.guard(gzipfile))
+	} else if isZstd(filebuf) {
+		if magic, _ := peekMagic(filebuf); magic == ZSTD_DICTIONARY_FRAME_MAGIC {
+			_, content, err := readSkippableFrame(filebuf, MAX_ZSTD_DICTIONARY_SIZE)
+			if err != nil {
+				return nil, err
+			}
+			if dictionary, err = loadZstdDictionary(content); err != nil {
+				return nil, err
+			}
+		}
+		decoder, err := newZstdDecoder(dictionary)
+		if err != nil {
+			return nil, err
+		}
+		rs.zstdfile = filebuf
+		rs.zstdDecoder = decoder
+		// the first frame is started by next()
+		rs.reader = bufio.NewReader(bytes.NewReader(nil))
+	}
+	return rs, nil
+}
+
+// Positions the stream at the start of the next record, skipping blank
+// lines and moving on to the next gzip member or zstd frame when the current
+// one is exhausted. Returns the offset of the record, which for compressed files
+// is the offset of the member or frame holding it, or io.EOF at the end of the file.
+func (rs *recordStream) next() (int64, error) {
+	for {
+		b, err := rs.reader.ReadByte()
+		if err == nil {
+			if b == '\r' || b == '\n' {
+				continue
+			}
+			rs.reader.UnreadByte()
+			return rs.offset(), nil
+		}
+		if err != io.EOF || !rs.compressed() {
+			return -1, err
+		}
+		if err := rs.nextMember(); err != nil {
+			return -1, err
+		}
+	}
+}
+
+// Whether the stream is made of gzip members or zstd frames.
+func (rs *recordStream) compressed() bool {
+	return rs.gzipfile != nil || rs.zstdfile != nil
+}
+
+// The offset of the current gzip member or zstd frame, or the
+// current position in an uncompressed file.
+func (rs *recordStream) offset() int64 {
+	if rs.compressed() {
+		return rs.memberOffset
+	}
+	return rs.position()
+}
+
+// Starts decompressing the next gzip member or zstd frame.
+func (rs *recordStream) nextMember() error {
+	if rs.zstdfile != nil {
+		return rs.nextZstdFrame()
+	}
+	rs.memberOffset = rs.position()
+	if err := rs.gzipfile.Reset(rs.source); err != nil {
+		return err
+	}
+	rs.gzipfile.Multistream(false)
+	rs.reader = bufio.NewReader(rs.guard(rs.gzipfile))
+	return nil
+}
+
+// Starts decoding the next zstd frame, skipping any skippable frames.
+func (rs *recordStream) nextZstdFrame() error {
+	for {
+		magic, err := peekMagic(rs.zstdfile)
+		if err != nil {
+			if _, err := rs.zstdfile.Peek(1); err == io.EOF {
+				return io.EOF
+			}
+			return io.ErrUnexpectedEOF
+		}
+		if !isSkippableFrame(magic) {
+			break
+		}
+		if err := skipSkippableFrame(rs.zstdfile); err != nil {
+			return err
+		}
+	}
+	rs.memberOffset = rs.position()
+	frame, err := newZstdFrameReader(rs.zstdfile)
+	if err != nil {
+		return err
+	}
+	if err := rs.zstdDecoder.Reset(frame); err != nil {
+		return err
+	}
+	rs.reader = bufio.NewReader(rs.guard(rs.zstdDecoder))
+	return nil
+}
@@ -20,6 +20,7 @@ package utils
 import (
 	"bytes"
 	"errors"
+	"fmt"
 	"io"
 	"math"
 	"strings"
@@ -76,43 +77,90 @@ type FilePart struct {
 	length   int
 	offset   int
 	buf      []byte
+	// streaming parts read their contents from fileobj as they are consumed
+	streaming bool
+	// counts what streaming parts read from the underlying reader
+	source *CountingReader
+	// the error that ended reading the contents of a streaming part
+	err error
 }
 
-// Creates a new FilePart object
+// Creates a new FilePart object. The contents are read in steps, so a
+// length that is larger than what fileobj holds gives a shorter FilePart
+// instead of allocating the whole length up front.
 func NewFilePart(fileobj io.Reader, length int) (*FilePart, error) {
-	filePart := &FilePart{
-		fileobj: fileobj,
-		length:  length,
-		offset:  0,
-		buf:     []byte{},
-	}
 	// Fix for thread-safety: fully read the contents of the FilePart
 	// initially and put the contents in the buffer. This allows the
 	// contents to be used by a different thread, freeing up the underlying
-	// reader.
-	buf, err := filePart.Read(-1)
-	if err != nil && err.Error() != "EOF" {
-		return nil, err
-	}
-	for len(buf) < length && err == nil {
-		tmp, err := filePart.Read(-1)
-		if err == nil {
-			buf = append(buf, tmp...)
+	// reader, which is what warc.ProcessRecords relies on.
+	contents := bytes.Buffer{}
+	if length > 0 {
+		if _, err := io.CopyN(&contents, fileobj, int64(length)); err != nil && err != io.EOF {
+			return nil, err
 		}
 	}
+	buf := contents.Bytes()
+	return &FilePart{
+		fileobj:  bytes.NewBuffer(buf),
+		filedata: buf,
+		length:   length,
+		offset:   0,
+		buf:      []byte{},
+	}, nil
+}
 
-	filePart.offset = 0
-	filePart.filedata = buf
-	filePart.fileobj = bytes.NewBuffer(buf)
-	return filePart, nil
+// Creates a FilePart that reads its contents from fileobj as they are
+// consumed instead of capturing them on instantiation. This allows
+// payloads that do not fit into memory to be processed through GetReader,
+// but the FilePart is not safe to hand to another thread.
+func NewStreamingFilePart(fileobj io.Reader, length int) *FilePart {
+	source := NewCountingReader(fileobj)
+	return &FilePart{
+		fileobj:   io.LimitReader(source, int64(length)),
+		length:    length,
+		offset:    0,
+		buf:       []byte{},
+		streaming: true,
+		source:    source,
+	}
 }
 
 // GetData returns the data that was cached from the
 // initial read of the FilePart during instantiation.
+// For a streaming FilePart, the contents are read into memory on the
+// first call. If reading them fails, or part of them was already
+// consumed, GetData returns what it could read and Err tells why.
 func (fp *FilePart) GetData() []byte {
+	if fp.streaming && fp.filedata == nil {
+		consumed := fp.source.Count() - int64(len(fp.buf))
+		data, err := io.ReadAll(fp.fileobj)
+		if err != nil {
+			fp.err = err
+		} else if fp.source.Count() < int64(fp.length) {
+			fp.err = errors.New(fmt.Sprintf("Read %v of %v bytes", fp.source.Count(), fp.length))
+		} else if consumed > 0 {
+			fp.err = errors.New(fmt.Sprintf("The first %v of %v bytes were consumed before GetData", consumed, fp.length))
+		}
+		fp.filedata = append(fp.buf, data...)
+		fp.buf = []byte{}
+		fp.offset = fp.length - len(fp.filedata)
+		fp.fileobj = bytes.NewBuffer(fp.filedata)
+		fp.streaming = false
+	}
 	return fp.filedata
 }
 
+// Returns the error that ended reading the contents of a streaming
+// FilePart in GetData, or nil if GetData returned all of them.
+func (fp *FilePart) Err() error {
+	return fp.err
+}
+
+// Whether the contents are read from the underlying reader as they are consumed
+func (fp *FilePart) IsStreaming() bool {
+	return fp.streaming
+}
+
 // reads up until the size specified
 func (fp *FilePart) Read(size int) ([]byte, error) {
 	if size == -1 {
@@ -203,3 +251,24 @@ func (fp *FilePart) GetLength() int {
 func findNewline(chunk []byte) int {
 	return bytes.IndexByte(chunk, '\n')
 }
+
+// Counts the bytes read from an underlying reader
+type CountingReader struct {
+	reader io.Reader
+	count  int64
+}
+
+func NewCountingReader(reader io.Reader) *CountingReader {
+	return &CountingReader{reader: reader}
+}
+
+func (cr *CountingReader) Read(p []byte) (int, error) {
+	n, err := cr.reader.Read(p)
+	cr.count += int64(n)
+	return n, err
+}
+
+// The number of bytes read so far
+func (cr *CountingReader) Count() int64 {
+	return cr.count
+}
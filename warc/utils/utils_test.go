@@ -1,10 +1,13 @@
 package utils
 
 import (
+	"errors"
 	. "gopkg.in/check.v1"
-	"testing"
+	"io"
 	"sort"
 	"strings"
+	"testing"
+	"testing/iotest"
 )
 
 func Test(t *testing.T) {
@@ -124,3 +127,52 @@ func (s *FilePartSuite) TestIterate(c *C) {
 		c.Assert(result[i], Equals, expected[i])
 	}
 }
+
+func (s *FilePartSuite) TestStreamingErrors(c *C) {
+	part := NewStreamingFilePart(strings.NewReader(s.text), 11)
+	c.Assert(string(part.GetData()), Equals, "aaaa\nbbbb\nc")
+	c.Assert(part.Err(), IsNil)
+
+	part = NewStreamingFilePart(strings.NewReader("aaaa"), 11)
+	c.Assert(string(part.GetData()), Equals, "aaaa")
+	c.Assert(part.Err(), ErrorMatches, "Read 4 of 11 bytes")
+
+	part = NewStreamingFilePart(io.MultiReader(strings.NewReader("aaaa"), iotest.ErrReader(errors.New("broken"))), 11)
+	c.Assert(string(part.GetData()), Equals, "aaaa")
+	c.Assert(part.Err(), ErrorMatches, "broken")
+
+	part = NewStreamingFilePart(strings.NewReader(s.text), 11)
+	io.ReadFull(part.GetReader(), make([]byte, 5))
+	c.Assert(string(part.GetData()), Equals, "bbbb\nc")
+	c.Assert(part.Err(), ErrorMatches, "The first 5 of 11 bytes were consumed before GetData")
+}
+
+type CountingReaderSuite struct{}
+
+var crSuite = Suite(&CountingReaderSuite{})
+
+func (s *CountingReaderSuite) TestCount(c *C) {
+	reader := NewCountingReader(strings.NewReader("aaaa\nbbbb\n"))
+	buf := make([]byte, 3)
+	reader.Read(buf)
+	c.Assert(reader.Count(), Equals, int64(3))
+	reader.Read(make([]byte, 100))
+	c.Assert(reader.Count(), Equals, int64(10))
+}
+
+func (s *FilePartSuite) TestStreaming(c *C) {
+	part := NewStreamingFilePart(strings.NewReader(s.text), 10)
+	c.Assert(part.IsStreaming(), Equals, true)
+	data, _ := part.Read(3)
+	c.Assert(string(data), Equals, "aaa")
+	c.Assert(string(part.GetData()), Equals, "a\nbbbb\n")
+	c.Assert(part.IsStreaming(), Equals, false)
+	data, _ = part.Read(-1)
+	c.Assert(string(data), Equals, "a\nbbbb\n")
+}
+
+func (s *FilePartSuite) TestTruncated(c *C) {
+	part, err := NewFilePart(strings.NewReader("aaaa"), 10)
+	c.Assert(err, IsNil)
+	c.Assert(string(part.GetData()), Equals, "aaaa")
+}
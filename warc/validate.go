@@ -0,0 +1,352 @@
+package warc
+
+/*
+	Copyright (C) 2015  Wolfgang Meyers
+
+    This program is free software; you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation; either version 2 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License along
+    with this program; if not, write to the Free Software Foundation, Inc.,
+    51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+*/
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Severities of validation issues
+var SEVERITY_ERROR string = "error"
+var SEVERITY_WARNING string = "warning"
+
+// Record types defined by the WARC 1.0 and 1.1 specifications
+var WARC_TYPES map[string]bool = map[string]bool{
+	"warcinfo":     true,
+	"response":     true,
+	"resource":     true,
+	"request":      true,
+	"metadata":     true,
+	"revisit":      true,
+	"conversion":   true,
+	"continuation": true,
+}
+
+// Fields that every record must have
+var MANDATORY_FIELDS []string = []string{"WARC-Record-ID", "Content-Length", "WARC-Date", "WARC-Type"}
+
+// Record types that must have a WARC-Target-URI
+var TARGET_URI_TYPES map[string]bool = map[string]bool{
+	"response":     true,
+	"resource":     true,
+	"request":      true,
+	"revisit":      true,
+	"conversion":   true,
+	"continuation": true,
+}
+
+var RE_RECORD_ID *regexp.Regexp = regexp.MustCompile("^<[a-zA-Z][a-zA-Z0-9+.-]*:[^<>\\s]+>$")
+
+// WARC 1.0 dates have a precision of seconds; WARC 1.1 dates may be
+// more or less precise.
+var RE_DATE_1_0 *regexp.Regexp = regexp.MustCompile("^\\d{4}-\\d{2}-\\d{2}T\\d{2}:\\d{2}:\\d{2}Z$")
+var RE_DATE_1_1 *regexp.Regexp = regexp.MustCompile("^\\d{4}(-\\d{2}(-\\d{2}(T\\d{2}:\\d{2}(:\\d{2}(\\.\\d{1,9})?)?Z)?)?)?$")
+
+// A problem found by Validate
+type ValidationIssue struct {
+	// The offset of the record, or of its gzip member or zstd frame
+	Offset   int64  `json:"offset"`
+	RecordId string `json:"record_id,omitempty"`
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+}
+
+// The result of validating a WARC file
+type ValidationReport struct {
+	Filename string             `json:"filename"`
+	Records  int                `json:"records"`
+	Errors   int                `json:"errors"`
+	Warnings int                `json:"warnings"`
+	Issues   []*ValidationIssue `json:"issues"`
+}
+
+// Whether no errors were found. Warnings do not make a file invalid.
+func (vr *ValidationReport) Valid() bool {
+	return vr.Errors == 0
+}
+
+func (vr *ValidationReport) add(offset int64, recordId string, severity string, message string) {
+	vr.Issues = append(vr.Issues, &ValidationIssue{
+		Offset:   offset,
+		RecordId: recordId,
+		Severity: severity,
+		Message:  message,
+	})
+	if severity == SEVERITY_ERROR {
+		vr.Errors++
+	} else {
+		vr.Warnings++
+	}
+}
+
+// Validates a WARC file against the WARC 1.0 and 1.1 specifications,
+// checking the syntax of the header of each record, its mandatory fields,
+// the Content-Type for its type, the CRLFCRLF that ends it, its block and
+// payload digests, and that it starts a new gzip member or zstd frame in
+// compressed files. Validation stops at the first record that cannot be
+// parsed. An error is only returned if the file cannot be read at all.
+func Validate(reader io.Reader, filename string) (*ValidationReport, error) {
+	stream, err := newRecordStream(reader, nil)
+	if err != nil {
+		return nil, err
+	}
+	report := &ValidationReport{Filename: filename, Issues: []*ValidationIssue{}}
+	previous := int64(-1)
+	for {
+		offset, err := stream.next()
+		if err == io.EOF {
+			return report, nil
+		}
+		if err != nil {
+			report.add(previous, "", SEVERITY_ERROR, fmt.Sprintf("Cannot read past record: %v", err))
+			return report, nil
+		}
+		if stream.compressed() && offset == previous {
+			report.add(offset, "", SEVERITY_WARNING, "Record does not start a new gzip member or zstd frame")
+		}
+		previous = offset
+		report.Records++
+		if err := validateRecord(stream, offset, report); err != nil {
+			report.add(offset, "", SEVERITY_ERROR, err.Error())
+			return report, nil
+		}
+	}
+}
+
+// Validates the record at the start of the stream. Returns an error if
+// the record cannot be parsed, so that the following records cannot be found.
+func validateRecord(stream *recordStream, offset int64, report *ValidationReport) error {
+	reader := stream.reader
+	versionLine, err := reader.ReadString('\n')
+	if err != nil {
+		return errors.New("Truncated version line")
+	}
+	match := RE_VERSION.FindStringSubmatch(versionLine)
+	if len(match) == 0 || match[0] != versionLine {
+		return errors.New(fmt.Sprintf("Bad version line: %q", versionLine))
+	}
+	version := match[1]
+	fields := map[string][]string{}
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return errors.New("Truncated header")
+		}
+		if line == "\r\n" {
+			break
+		}
+		match := RE_HEADER.FindStringSubmatch(line)
+		if len(match) == 0 || match[0] != line {
+			return errors.New(fmt.Sprintf("Bad header line: %q", line))
+		}
+		name := canonicalHeaderName(strings.ToLower(match[1]))
+		fields[name] = append(fields[name], strings.TrimSpace(match[2]))
+	}
+	get := func(name string) string {
+		if values := fields[name]; len(values) > 0 {
+			return values[0]
+		}
+		return ""
+	}
+	recordId := get("WARC-Record-ID")
+	issue := func(severity string, format string, args ...interface{}) {
+		report.add(offset, recordId, severity, fmt.Sprintf(format, args...))
+	}
+
+	length := int64(-1)
+	if value := get("Content-Length"); value != "" {
+		length, err = strconv.ParseInt(value, 10, 64)
+		if err != nil || length < 0 {
+			return errors.New(fmt.Sprintf("Bad Content-Length: %v", value))
+		}
+	}
+	if !SUPPORTED_VERSIONS[version] {
+		issue(SEVERITY_ERROR, "Unsupported WARC version: %v", version)
+	}
+	for _, name := range MANDATORY_FIELDS {
+		if len(fields[name]) == 0 {
+			issue(SEVERITY_ERROR, "Missing mandatory field %v", name)
+		}
+	}
+	for name, values := range fields {
+		// only WARC-Concurrent-To may be repeated
+		if len(values) > 1 && name != "WARC-Concurrent-To" {
+			issue(SEVERITY_ERROR, "Field %v is repeated", name)
+		}
+	}
+	if recordId != "" && !RE_RECORD_ID.MatchString(recordId) {
+		issue(SEVERITY_ERROR, "Bad WARC-Record-ID: %v", recordId)
+	}
+	for _, name := range []string{"WARC-Concurrent-To", "WARC-Refers-To", "WARC-Warcinfo-ID", "WARC-Segment-Origin-ID"} {
+		for _, value := range fields[name] {
+			if !RE_RECORD_ID.MatchString(value) {
+				issue(SEVERITY_ERROR, "Bad %v: %v", name, value)
+			}
+		}
+	}
+	for _, name := range []string{"WARC-Date", "WARC-Refers-To-Date"} {
+		if date := get(name); date != "" && !validDate(date, version) {
+			issue(SEVERITY_ERROR, "Bad %v for WARC/%v: %v", name, version, date)
+		}
+	}
+	for _, name := range []string{"WARC-Target-URI", "WARC-Refers-To-Target-URI", "WARC-Profile"} {
+		if uri := get(name); uri != "" && !validURI(uri, version) {
+			issue(SEVERITY_ERROR, "Bad %v: %v", name, uri)
+		}
+	}
+
+	recordType := get("WARC-Type")
+	contentType := get("Content-Type")
+	targetURI := get("WARC-Target-URI")
+	if recordType != "" && !WARC_TYPES[recordType] {
+		issue(SEVERITY_WARNING, "Unknown WARC-Type: %v", recordType)
+	}
+	if TARGET_URI_TYPES[recordType] && targetURI == "" {
+		issue(SEVERITY_ERROR, "Missing WARC-Target-URI for %v record", recordType)
+	}
+	if length > 0 && contentType == "" && recordType != "continuation" {
+		issue(SEVERITY_WARNING, "Missing Content-Type")
+	}
+	isHTTP := strings.HasPrefix(targetURI, "http:") || strings.HasPrefix(targetURI, "https:")
+	switch recordType {
+	case "warcinfo":
+		if contentType != "" && contentType != CONTENT_TYPES["warcinfo"] {
+			issue(SEVERITY_WARNING, "Content-Type of warcinfo record is %v, expected %v", contentType, CONTENT_TYPES["warcinfo"])
+		}
+	case "response", "request":
+		expected := "application/http"
+		if isHTTP && contentType != "" && !strings.HasPrefix(contentType, expected) {
+			issue(SEVERITY_WARNING, "Content-Type of HTTP %v record is %v, expected %v", recordType, contentType, CONTENT_TYPES[recordType])
+		}
+	case "revisit":
+		if get("WARC-Profile") == "" {
+			issue(SEVERITY_ERROR, "Missing WARC-Profile for revisit record")
+		}
+	case "continuation":
+		if get("WARC-Segment-Origin-ID") == "" {
+			issue(SEVERITY_ERROR, "Missing WARC-Segment-Origin-ID for continuation record")
+		}
+		if get("WARC-Segment-Number") == "" {
+			issue(SEVERITY_ERROR, "Missing WARC-Segment-Number for continuation record")
+		}
+	}
+	if number := get("WARC-Segment-Number"); number != "" {
+		if n, err := strconv.Atoi(number); err != nil || n < 1 || (n == 1) == (recordType == "continuation") {
+			issue(SEVERITY_ERROR, "Bad WARC-Segment-Number: %v", number)
+		}
+	}
+
+	if length < 0 {
+		length = 0
+	}
+	block := bytes.Buffer{}
+	if _, err := io.CopyN(&block, reader, length); err != nil {
+		return errors.New(fmt.Sprintf("Truncated block: %v of %v bytes", block.Len(), length))
+	}
+	for i := 0; i < 2; i++ {
+		line, err := reader.ReadString('\n')
+		if line != "\r\n" {
+			if err != nil && line == "" {
+				return errors.New("Missing CRLFCRLF at the end of the record")
+			}
+			return errors.New(fmt.Sprintf("Expected CRLFCRLF at the end of the record, found %q", line))
+		}
+	}
+
+	data := block.Bytes()
+	if digest := get("WARC-Block-Digest"); digest != "" {
+		if matches, err := digestMatches(digest, data); err != nil {
+			issue(SEVERITY_WARNING, "Cannot check WARC-Block-Digest: %v", err)
+		} else if !matches {
+			issue(SEVERITY_ERROR, "WARC-Block-Digest %v does not match the block", digest)
+		}
+	}
+	if digest := get("WARC-Payload-Digest"); digest != "" && recordType != "revisit" {
+		payload := data
+		chunked := false
+		if strings.HasPrefix(contentType, "application/http") {
+			if message, err := ParseHTTPMessage(data); err == nil {
+				payload = message.Body
+				chunked = strings.Contains(strings.ToLower(message.Header.Get("Transfer-Encoding")), "chunked")
+			}
+		}
+		if matches, err := digestMatches(digest, payload); err != nil {
+			issue(SEVERITY_WARNING, "Cannot check WARC-Payload-Digest: %v", err)
+		} else if !matches && chunked {
+			// crawlers disagree on whether the transfer encoding is part of the payload
+			issue(SEVERITY_WARNING, "WARC-Payload-Digest %v does not match the chunked payload", digest)
+		} else if !matches {
+			issue(SEVERITY_ERROR, "WARC-Payload-Digest %v does not match the payload", digest)
+		}
+	}
+	return nil
+}
+
+func validDate(date string, version string) bool {
+	if version == "1.0" {
+		return RE_DATE_1_0.MatchString(date)
+	}
+	return RE_DATE_1_1.MatchString(date)
+}
+
+func validURI(uri string, version string) bool {
+	// WARC 1.0 shows URIs in angle brackets, which many files follow
+	if version == "1.0" && strings.HasPrefix(uri, "<") && strings.HasSuffix(uri, ">") {
+		uri = uri[1 : len(uri)-1]
+	}
+	u, err := url.Parse(uri)
+	return err == nil && u.Scheme != "" && !strings.ContainsAny(uri, " <>")
+}
+
+// Checks a labelled digest such as "sha1:<base32>" against data.
+// Digests may be in base32 or hex.
+func digestMatches(digest string, data []byte) (bool, error) {
+	parts := strings.SplitN(digest, ":", 2)
+	if len(parts) != 2 {
+		return false, errors.New(fmt.Sprintf("Bad digest: %v", digest))
+	}
+	var h hash.Hash
+	switch strings.ToLower(strings.Replace(parts[0], "-", "", -1)) {
+	case "sha1":
+		h = sha1.New()
+	case "sha256":
+		h = sha256.New()
+	case "md5":
+		h = md5.New()
+	default:
+		return false, errors.New(fmt.Sprintf("Unsupported digest algorithm: %v", parts[0]))
+	}
+	h.Write(data)
+	sum := h.Sum(nil)
+	value := parts[1]
+	return strings.EqualFold(value, base32.StdEncoding.EncodeToString(sum)) ||
+		strings.EqualFold(value, hex.EncodeToString(sum)), nil
+}
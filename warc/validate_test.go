@@ -0,0 +1,160 @@
+package warc
+
+import (
+	"bytes"
+	"compress/gzip"
+	. "gopkg.in/check.v1"
+	"strings"
+)
+
+type ValidateSuite struct{}
+
+var validateSuite = Suite(&ValidateSuite{})
+
+func writeValidRecords(compress bool) []byte {
+	record := getSampleRecords(1, map[string]string{
+		"Content-Type": CONTENT_TYPES["response"],
+	}, func(i int) []byte {
+		return []byte("HTTP/1.1 200 OK\r\nContent-Type: text/plain\r\n\r\nHello")
+	})[0]
+	record.Set("WARC-Payload-Digest", ComputePayloadDigest(record))
+	buf := bytes.Buffer{}
+	writeSampleRecords(NewWARCWriter(&buf, compress), []*WARCRecord{
+		record,
+		NewWARCRecordFromBytes(map[string]string{
+			"WARC-Type":    "warcinfo",
+			"Content-Type": CONTENT_TYPES["warcinfo"],
+		}, []byte("software: go-warc\r\n")),
+	})
+	return buf.Bytes()
+}
+
+func messages(report *ValidationReport) []string {
+	result := []string{}
+	for _, issue := range report.Issues {
+		result = append(result, issue.Severity+": "+issue.Message)
+	}
+	return result
+}
+
+func (s *ValidateSuite) TestValid(c *C) {
+	for _, compress := range []bool{false, true} {
+		report, err := Validate(bytes.NewReader(writeValidRecords(compress)), "sample.warc")
+		c.Assert(err, IsNil)
+		c.Assert(messages(report), DeepEquals, []string{})
+		c.Assert(report.Records, Equals, 2)
+		c.Assert(report.Valid(), Equals, true)
+	}
+}
+
+func (s *ValidateSuite) TestMixedCaseHeaders(c *C) {
+	data := "WARC/1.0\r\n" +
+		"Warc-Type: resource\r\n" +
+		"Warc-Record-Id: <urn:uuid:00000000-0000-0000-0000-000000000001>\r\n" +
+		"warc-date: 2000-01-02T03:04:05Z\r\n" +
+		"Warc-Target-Uri: http://example.com/\r\n" +
+		"content-type: text/plain\r\n" +
+		"CONTENT-LENGTH: 5\r\n" +
+		"\r\n" +
+		"Hello\r\n\r\n"
+	report, err := Validate(bytes.NewReader([]byte(data)), "sample.warc")
+	c.Assert(err, IsNil)
+	c.Assert(messages(report), DeepEquals, []string{})
+}
+
+func (s *ValidateSuite) TestHeaderProblems(c *C) {
+	data := "WARC/1.0\r\n" +
+		"WARC-Type: response\r\n" +
+		"WARC-Record-ID: record-1\r\n" +
+		"WARC-Date: 2000-01-02T03:04:05.5Z\r\n" +
+		"WARC-Date: 2000-01-02T03:04:05Z\r\n" +
+		"Content-Type: text/plain\r\n" +
+		"WARC-Block-Digest: sha1:AAAA\r\n" +
+		"Content-Length: 5\r\n" +
+		"\r\n" +
+		"Hello\r\n\r\n" +
+		"WARC/1.1\r\n" +
+		"WARC-Type: revisit\r\n" +
+		"WARC-Record-ID: <urn:uuid:1>\r\n" +
+		"WARC-Date: 2000-01-02T03:04:05.5Z\r\n" +
+		"WARC-Target-URI: http://example.com/\r\n" +
+		"WARC-Block-Digest: sha1:" + strings.ToLower(ComputeDigest([]byte{})[5:]) + "\r\n" +
+		"Content-Length: 0\r\n" +
+		"\r\n" +
+		"\r\n\r\n" +
+		"WARC/1.1\r\n" +
+		"WARC-Type: unknown\r\n" +
+		"WARC-Record-ID: <urn:uuid:2>\r\n" +
+		"WARC-Date: 2000-01-02\r\n" +
+		"WARC-Block-Digest: crc32:0\r\n" +
+		"\r\n" +
+		"\r\n\r\n"
+	report, err := Validate(strings.NewReader(data), "sample.warc")
+	c.Assert(err, IsNil)
+	c.Assert(report.Records, Equals, 3)
+	c.Assert(report.Valid(), Equals, false)
+	c.Assert(report.Errors, Equals, 7)
+	c.Assert(report.Warnings, Equals, 2)
+	c.Assert(report.Issues[0].Offset, Equals, int64(0))
+	c.Assert(report.Issues[0].RecordId, Equals, "record-1")
+	c.Assert(messages(report), DeepEquals, []string{
+		"error: Field WARC-Date is repeated",
+		"error: Bad WARC-Record-ID: record-1",
+		"error: Bad WARC-Date for WARC/1.0: 2000-01-02T03:04:05.5Z",
+		"error: Missing WARC-Target-URI for response record",
+		"error: WARC-Block-Digest sha1:AAAA does not match the block",
+		"error: Missing WARC-Profile for revisit record",
+		"error: Missing mandatory field Content-Length",
+		"warning: Unknown WARC-Type: unknown",
+		"warning: Cannot check WARC-Block-Digest: Unsupported digest algorithm: crc32",
+	})
+}
+
+func (s *ValidateSuite) TestPayloadDigest(c *C) {
+	record := NewWARCRecordFromBytes(map[string]string{
+		"WARC-Target-URI":     "http://example.com/",
+		"Content-Type":        CONTENT_TYPES["response"],
+		"WARC-Payload-Digest": ComputeDigest([]byte("Hello")),
+	}, []byte("HTTP/1.1 200 OK\r\nContent-Type: text/plain\r\n\r\nHellp"))
+	buf := bytes.Buffer{}
+	record.WriteTo(&buf)
+	report, err := Validate(&buf, "sample.warc")
+	c.Assert(err, IsNil)
+	c.Assert(messages(report), DeepEquals, []string{
+		"error: WARC-Payload-Digest " + ComputeDigest([]byte("Hello")) + " does not match the payload",
+	})
+}
+
+func (s *ValidateSuite) TestStructure(c *C) {
+	data := writeValidRecords(false)
+	// a record without the CRLFCRLF that ends it
+	broken := bytes.Replace(data, []byte("Hello\r\n\r\n"), []byte("Hello"), 1)
+	report, err := Validate(bytes.NewReader(broken), "sample.warc")
+	c.Assert(err, IsNil)
+	c.Assert(messages(report), DeepEquals, []string{
+		"error: Expected CRLFCRLF at the end of the record, found \"WARC/1.0\\r\\n\"",
+	})
+
+	report, err = Validate(bytes.NewReader(data[:len(data)-20]), "sample.warc")
+	c.Assert(err, IsNil)
+	c.Assert(messages(report), DeepEquals, []string{"error: Truncated block: 3 of 19 bytes"})
+	c.Assert(report.Issues[0].Offset > 0, Equals, true)
+
+	report, err = Validate(strings.NewReader("WARC/1.0\r\nWARC-Type response\r\n\r\n"), "sample.warc")
+	c.Assert(err, IsNil)
+	c.Assert(messages(report), DeepEquals, []string{"error: Bad header line: \"WARC-Type response\\r\\n\""})
+}
+
+func (s *ValidateSuite) TestGzipMembers(c *C) {
+	// both records in a single gzip member
+	buf := bytes.Buffer{}
+	gzout := gzip.NewWriter(&buf)
+	gzout.Write(writeValidRecords(false))
+	gzout.Close()
+	report, err := Validate(&buf, "sample.warc.gz")
+	c.Assert(err, IsNil)
+	c.Assert(report.Valid(), Equals, true)
+	c.Assert(messages(report), DeepEquals, []string{
+		"warning: Record does not start a new gzip member or zstd frame",
+	})
+}
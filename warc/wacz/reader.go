@@ -0,0 +1,295 @@
+package wacz
+
+/*
+	Copyright (C) 2015  Wolfgang Meyers
+
+    This program is free software; you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation; either version 2 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License along
+    with this program; if not, write to the Free Software Foundation, Inc.,
+    51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+*/
+import (
+	"archive/zip"
+	"bufio"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/wolfgangmeyers/go-warc/warc"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// The compressed index that may be used instead of INDEX_PATH
+var COMPRESSED_INDEX_PATH string = "indexes/index.cdx.gz"
+
+// WACZFile reads a WACZ package. WARC records are read directly from
+// the zip file, without extracting the WARC files.
+type WACZFile struct {
+	reader  io.ReaderAt
+	archive *zip.Reader
+	files   map[string]*zip.File
+	closer  io.Closer
+	pkg     *DataPackage
+	index   []*warc.CDXEntry
+}
+
+// Opens a WACZ file.
+func Open(filename string) (*WACZFile, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	wf, err := NewWACZFile(f, info.Size())
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	wf.closer = f
+	return wf, nil
+}
+
+// Creates a WACZFile reading the package from reader, which holds size bytes.
+func NewWACZFile(reader io.ReaderAt, size int64) (*WACZFile, error) {
+	archive, err := zip.NewReader(reader, size)
+	if err != nil {
+		return nil, err
+	}
+	wf := &WACZFile{
+		reader:  reader,
+		archive: archive,
+		files:   map[string]*zip.File{},
+	}
+	for _, file := range archive.File {
+		wf.files[file.Name] = file
+	}
+	data, err := wf.readFile(DATAPACKAGE_PATH)
+	if err != nil {
+		return nil, err
+	}
+	wf.pkg = &DataPackage{}
+	if err := json.Unmarshal(data, wf.pkg); err != nil {
+		return nil, errors.New(fmt.Sprintf("Bad %v: %v", DATAPACKAGE_PATH, err))
+	}
+	return wf, nil
+}
+
+func (wf *WACZFile) readFile(path string) ([]byte, error) {
+	file, exists := wf.files[path]
+	if !exists {
+		return nil, errors.New(fmt.Sprintf("Missing %v", path))
+	}
+	reader, err := file.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return io.ReadAll(reader)
+}
+
+// The contents of datapackage.json
+func (wf *WACZFile) GetDataPackage() *DataPackage {
+	return wf.pkg
+}
+
+// The names of the WARC files in the archive directory.
+func (wf *WACZFile) WARCFiles() []string {
+	names := []string{}
+	for name := range wf.files {
+		if strings.HasPrefix(name, ARCHIVE_DIR) && name != ARCHIVE_DIR {
+			names = append(names, strings.TrimPrefix(name, ARCHIVE_DIR))
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Verifies the sha256 hashes and sizes of all files listed in
+// datapackage.json, and the hash of datapackage.json itself if the
+// package contains a datapackage-digest.json. Also checks that all
+// WARC files are listed and that the package has an index.
+func (wf *WACZFile) Validate() error {
+	listed := map[string]bool{}
+	for _, resource := range wf.pkg.Resources {
+		listed[resource.Path] = true
+		file, exists := wf.files[resource.Path]
+		if !exists {
+			return errors.New(fmt.Sprintf("Missing %v", resource.Path))
+		}
+		reader, err := file.Open()
+		if err != nil {
+			return err
+		}
+		hash := sha256.New()
+		n, err := io.Copy(hash, reader)
+		reader.Close()
+		if err != nil {
+			return errors.New(fmt.Sprintf("Reading %v: %v", resource.Path, err))
+		}
+		if n != resource.Bytes {
+			return errors.New(fmt.Sprintf("%v has %v bytes, expected %v", resource.Path, n, resource.Bytes))
+		}
+		if digest := "sha256:" + hex.EncodeToString(hash.Sum(nil)); digest != resource.Hash {
+			return errors.New(fmt.Sprintf("Hash of %v is %v, expected %v", resource.Path, digest, resource.Hash))
+		}
+	}
+	for _, name := range wf.WARCFiles() {
+		if !listed[ARCHIVE_DIR+name] {
+			return errors.New(fmt.Sprintf("%v is not listed in %v", ARCHIVE_DIR+name, DATAPACKAGE_PATH))
+		}
+	}
+	if !listed[INDEX_PATH] && !listed[COMPRESSED_INDEX_PATH] {
+		return errors.New("The package has no index")
+	}
+	if _, exists := wf.files[DATAPACKAGE_DIGEST_PATH]; !exists {
+		return nil
+	}
+	data, err := wf.readFile(DATAPACKAGE_DIGEST_PATH)
+	if err != nil {
+		return err
+	}
+	digest := &DataPackageDigest{}
+	if err := json.Unmarshal(data, digest); err != nil {
+		return errors.New(fmt.Sprintf("Bad %v: %v", DATAPACKAGE_DIGEST_PATH, err))
+	}
+	data, err = wf.readFile(DATAPACKAGE_PATH)
+	if err != nil {
+		return err
+	}
+	if hash := sha256Digest(data); hash != digest.Hash {
+		return errors.New(fmt.Sprintf("Hash of %v is %v, expected %v", DATAPACKAGE_PATH, hash, digest.Hash))
+	}
+	return nil
+}
+
+// Loads the CDXJ index of the package, from indexes/index.cdx or indexes/index.cdx.gz.
+func (wf *WACZFile) Index() ([]*warc.CDXEntry, error) {
+	if wf.index != nil {
+		return wf.index, nil
+	}
+	path := INDEX_PATH
+	if _, exists := wf.files[path]; !exists {
+		path = COMPRESSED_INDEX_PATH
+	}
+	file, exists := wf.files[path]
+	if !exists {
+		return nil, errors.New("The package has no index")
+	}
+	reader, err := file.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	var input io.Reader = reader
+	if path == COMPRESSED_INDEX_PATH {
+		gzipfile, err := gzip.NewReader(reader)
+		if err != nil {
+			return nil, err
+		}
+		input = gzipfile
+	}
+	entries := []*warc.CDXEntry{}
+	scanner := bufio.NewScanner(input)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		if scanner.Text() == "" {
+			continue
+		}
+		entry, err := warc.ParseCDXEntry(scanner.Text())
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	wf.index = entries
+	return entries, nil
+}
+
+// Returns the index entries for url, oldest first.
+func (wf *WACZFile) Lookup(url string) ([]*warc.CDXEntry, error) {
+	entries, err := wf.Index()
+	if err != nil {
+		return nil, err
+	}
+	key := warc.SURT(url)
+	start := sort.Search(len(entries), func(i int) bool {
+		return entries[i].URLKey >= key
+	})
+	result := []*warc.CDXEntry{}
+	for i := start; i < len(entries) && entries[i].URLKey == key; i++ {
+		result = append(result, entries[i])
+	}
+	return result, nil
+}
+
+// Returns a reader for the contents of a WARC file in the archive
+// directory, which must be stored without zip compression.
+func (wf *WACZFile) OpenWARC(name string) (*io.SectionReader, error) {
+	file, exists := wf.files[ARCHIVE_DIR+name]
+	if !exists {
+		return nil, errors.New(fmt.Sprintf("Missing %v", ARCHIVE_DIR+name))
+	}
+	if file.Method != zip.Store {
+		return nil, errors.New(fmt.Sprintf("%v is compressed and cannot be read by offset", ARCHIVE_DIR+name))
+	}
+	offset, err := file.DataOffset()
+	if err != nil {
+		return nil, err
+	}
+	return io.NewSectionReader(wf.reader, offset, int64(file.CompressedSize64)), nil
+}
+
+// Opens a WARC file in the archive directory for reading its records in order.
+func (wf *WACZFile) GetWARCFile(name string) (*warc.WARCFile, error) {
+	section, err := wf.OpenWARC(name)
+	if err != nil {
+		return nil, err
+	}
+	return warc.NewWARCFile(io.NopCloser(section))
+}
+
+// Reads the record at offset in a WARC file in the archive directory.
+func (wf *WACZFile) ReadRecordAt(name string, offset int64) (*warc.WARCRecord, error) {
+	section, err := wf.OpenWARC(name)
+	if err != nil {
+		return nil, err
+	}
+	return warc.ReadRecordAt(section, offset)
+}
+
+// Reads the record that an index entry refers to.
+func (wf *WACZFile) GetRecord(entry *warc.CDXEntry) (*warc.WARCRecord, error) {
+	offset, _, err := entry.Location()
+	if err != nil {
+		return nil, err
+	}
+	return wf.ReadRecordAt(entry.Filename, offset)
+}
+
+func (wf *WACZFile) Close() error {
+	if wf.closer == nil {
+		return nil
+	}
+	return wf.closer.Close()
+}
@@ -0,0 +1,128 @@
+package wacz
+
+import (
+	"archive/zip"
+	"bytes"
+	"github.com/wolfgangmeyers/go-warc/warc"
+	. "gopkg.in/check.v1"
+	"os"
+	"path/filepath"
+)
+
+type WACZReaderSuite struct {
+	dir string
+}
+
+var waczReaderSuite = Suite(&WACZReaderSuite{})
+
+func (s *WACZReaderSuite) SetUpTest(c *C) {
+	s.dir = c.MkDir()
+}
+
+func (s *WACZReaderSuite) createWacz(c *C) []byte {
+	files := []string{
+		writeWarc(c, s.dir, "one.warc", warc.COMPRESSION_NONE, "http://example.com/"),
+		writeWarc(c, s.dir, "two.warc.gz", warc.COMPRESSION_GZIP, "http://example.org/"),
+	}
+	out := bytes.Buffer{}
+	c.Assert(Create(&out, files, Options{}), IsNil)
+	return out.Bytes()
+}
+
+// Copies a package, replacing the contents of the files in changes.
+func rewriteWacz(c *C, data []byte, changes map[string][]byte) []byte {
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	c.Assert(err, IsNil)
+	out := bytes.Buffer{}
+	writer := zip.NewWriter(&out)
+	for _, file := range archive.File {
+		content := readZipFile(c, file)
+		if changed, exists := changes[file.Name]; exists {
+			content = changed
+		}
+		w, err := writer.CreateHeader(&zip.FileHeader{Name: file.Name, Method: file.Method})
+		c.Assert(err, IsNil)
+		w.Write(content)
+	}
+	c.Assert(writer.Close(), IsNil)
+	return out.Bytes()
+}
+
+func (s *WACZReaderSuite) TestRead(c *C) {
+	path := filepath.Join(s.dir, "sample.wacz")
+	c.Assert(os.WriteFile(path, s.createWacz(c), 0644), IsNil)
+	wf, err := Open(path)
+	c.Assert(err, IsNil)
+	defer wf.Close()
+	c.Assert(wf.Validate(), IsNil)
+	c.Assert(wf.GetDataPackage().WACZVersion, Equals, WACZ_VERSION)
+	c.Assert(wf.WARCFiles(), DeepEquals, []string{"one.warc.gz", "two.warc.gz"})
+
+	entries, err := wf.Lookup("http://example.org/image.png")
+	c.Assert(err, IsNil)
+	c.Assert(len(entries), Equals, 1)
+	c.Assert(entries[0].Filename, Equals, "two.warc.gz")
+	record, err := wf.GetRecord(entries[0])
+	c.Assert(err, IsNil)
+	c.Assert(record.GetUrl(), Equals, "http://example.org/image.png")
+	message, err := record.GetHTTPMessage()
+	c.Assert(err, IsNil)
+	c.Assert(string(message.Body), Equals, "PNG")
+
+	entries, err = wf.Lookup("http://example.net/")
+	c.Assert(err, IsNil)
+	c.Assert(len(entries), Equals, 0)
+
+	f, err := wf.GetWARCFile("one.warc.gz")
+	c.Assert(err, IsNil)
+	count := 0
+	f.GetReader().Iterate(func(record *warc.WARCRecord, err error) {
+		if record != nil {
+			count++
+		}
+	})
+	c.Assert(count, Equals, 2)
+
+	_, err = wf.ReadRecordAt("three.warc.gz", 0)
+	c.Assert(err, ErrorMatches, "Missing archive/three.warc.gz")
+}
+
+func (s *WACZReaderSuite) TestValidate(c *C) {
+	data := s.createWacz(c)
+	wf, err := NewWACZFile(bytes.NewReader(data), int64(len(data)))
+	c.Assert(err, IsNil)
+	c.Assert(wf.Validate(), IsNil)
+
+	changed := rewriteWacz(c, data, map[string][]byte{ARCHIVE_DIR + "one.warc.gz": []byte("changed")})
+	wf, err = NewWACZFile(bytes.NewReader(changed), int64(len(changed)))
+	c.Assert(err, IsNil)
+	c.Assert(wf.Validate(), ErrorMatches, "archive/one.warc.gz has 7 bytes, expected .*")
+
+	changed = rewriteWacz(c, data, map[string][]byte{DATAPACKAGE_DIGEST_PATH: []byte(`{"path":"datapackage.json","hash":"sha256:00"}`)})
+	wf, err = NewWACZFile(bytes.NewReader(changed), int64(len(changed)))
+	c.Assert(err, IsNil)
+	c.Assert(wf.Validate(), ErrorMatches, "Hash of datapackage.json is .*, expected sha256:00")
+
+	changed = rewriteWacz(c, data, map[string][]byte{DATAPACKAGE_PATH: []byte("{")})
+	_, err = NewWACZFile(bytes.NewReader(changed), int64(len(changed)))
+	c.Assert(err, ErrorMatches, "Bad datapackage.json: .*")
+}
+
+func (s *WACZReaderSuite) TestCompressedWARC(c *C) {
+	data := s.createWacz(c)
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	c.Assert(err, IsNil)
+	out := bytes.Buffer{}
+	writer := zip.NewWriter(&out)
+	for _, file := range archive.File {
+		w, err := writer.CreateHeader(&zip.FileHeader{Name: file.Name, Method: zip.Deflate})
+		c.Assert(err, IsNil)
+		w.Write(readZipFile(c, file))
+	}
+	c.Assert(writer.Close(), IsNil)
+	wf, err := NewWACZFile(bytes.NewReader(out.Bytes()), int64(out.Len()))
+	c.Assert(err, IsNil)
+	c.Assert(wf.Validate(), IsNil)
+	_, err = wf.ReadRecordAt("one.warc.gz", 0)
+	c.Assert(err, ErrorMatches, ".* cannot be read by offset")
+}
@@ -0,0 +1,305 @@
+// Package wacz creates and reads WACZ files, the zip based packaging of
+// WARC files with their indexes that web archive replay tools load.
+package wacz
+
+/*
+	Copyright (C) 2015  Wolfgang Meyers
+
+    This program is free software; you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation; either version 2 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License along
+    with this program; if not, write to the Free Software Foundation, Inc.,
+    51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+*/
+import (
+	"archive/zip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/nu7hatch/gouuid"
+	"github.com/wolfgangmeyers/go-warc/warc"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+var WACZ_VERSION string = "1.1.1"
+
+// Paths of the files in a WACZ package
+var DATAPACKAGE_PATH string = "datapackage.json"
+var DATAPACKAGE_DIGEST_PATH string = "datapackage-digest.json"
+var INDEX_PATH string = "indexes/index.cdx"
+var PAGES_PATH string = "pages/pages.jsonl"
+var ARCHIVE_DIR string = "archive/"
+
+// A file in the package, as listed in datapackage.json
+type Resource struct {
+	Name  string `json:"name"`
+	Path  string `json:"path"`
+	Hash  string `json:"hash"`
+	Bytes int64  `json:"bytes"`
+}
+
+// The contents of datapackage.json
+type DataPackage struct {
+	Profile      string      `json:"profile"`
+	Resources    []*Resource `json:"resources"`
+	WACZVersion  string      `json:"wacz_version"`
+	Title        string      `json:"title,omitempty"`
+	Description  string      `json:"description,omitempty"`
+	MainPageURL  string      `json:"mainPageUrl,omitempty"`
+	MainPageDate string      `json:"mainPageDate,omitempty"`
+	Created      string      `json:"created"`
+	Software     string      `json:"software"`
+}
+
+// The contents of datapackage-digest.json
+type DataPackageDigest struct {
+	Path string `json:"path"`
+	Hash string `json:"hash"`
+}
+
+// A line of pages.jsonl
+type Page struct {
+	ID    string `json:"id"`
+	URL   string `json:"url"`
+	TS    string `json:"ts"`
+	Title string `json:"title,omitempty"`
+}
+
+// The first line of pages.jsonl
+var PAGES_HEADER string = `{"format":"json-pages-1.0","id":"pages","title":"All Pages"}`
+
+// Options for Create
+type Options struct {
+	Title       string
+	Description string
+	// The URL of the page that replay should start with
+	MainPageURL string
+	// The creation date, which defaults to the current time
+	Created time.Time
+}
+
+func sha256Digest(data []byte) string {
+	hash := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(hash[:])
+}
+
+// The name of a WARC file in the archive directory, which always holds
+// WARC files compressed per record with gzip.
+func archiveName(filename string) string {
+	name := filepath.Base(filename)
+	name = strings.TrimSuffix(strings.TrimSuffix(name, ".gz"), ".zst")
+	return name + ".gz"
+}
+
+// Creates a WACZ package from WARC files. The WARC files are added to the
+// archive directory compressed with a gzip member per record, so files
+// gzipped as a single stream or compressed with zstd may be given.
+// The CDXJ index is built by reading the WARC files, and pages.jsonl
+// lists the HTML pages that were captured with status 200.
+func Create(out io.Writer, warcFiles []string, options Options) error {
+	created := options.Created
+	if created.IsZero() {
+		created = time.Now()
+	}
+	pkg := &DataPackage{
+		Profile:     "data-package",
+		WACZVersion: WACZ_VERSION,
+		Title:       options.Title,
+		Description: options.Description,
+		MainPageURL: options.MainPageURL,
+		Created:     warc.FormatDate(created),
+		Software:    warc.SOFTWARE,
+	}
+	archive := zip.NewWriter(out)
+	addFile := func(path string, method uint16, write func(io.Writer) error) error {
+		writer, err := archive.CreateHeader(&zip.FileHeader{
+			Name:     path,
+			Method:   method,
+			Modified: created,
+		})
+		if err != nil {
+			return err
+		}
+		hash := sha256.New()
+		counter := &countingWriter{}
+		if err := write(io.MultiWriter(writer, hash, counter)); err != nil {
+			return err
+		}
+		pkg.Resources = append(pkg.Resources, &Resource{
+			Name:  filepath.Base(path),
+			Path:  path,
+			Hash:  "sha256:" + hex.EncodeToString(hash.Sum(nil)),
+			Bytes: counter.n,
+		})
+		return nil
+	}
+
+	entries := []*warc.CDXEntry{}
+	names := map[string]bool{}
+	for _, filename := range warcFiles {
+		name := archiveName(filename)
+		if names[name] {
+			return errors.New(fmt.Sprintf("Duplicate WARC file name: %v", name))
+		}
+		names[name] = true
+		fileEntries, err := addWARCFile(filename, name, func(tmp io.Reader) error {
+			// WARC files are stored, so that records can be read by offset
+			return addFile(ARCHIVE_DIR+name, zip.Store, func(w io.Writer) error {
+				_, err := io.Copy(w, tmp)
+				return err
+			})
+		})
+		if err != nil {
+			return errors.New(fmt.Sprintf("%v: %v", filename, err))
+		}
+		entries = append(entries, fileEntries...)
+	}
+	warc.SortCDXEntries(entries)
+	err := addFile(INDEX_PATH, zip.Store, func(w io.Writer) error {
+		return warc.WriteCDXJ(w, entries)
+	})
+	if err != nil {
+		return err
+	}
+	pages, err := findPages(entries)
+	if err != nil {
+		return err
+	}
+	err = addFile(PAGES_PATH, zip.Deflate, func(w io.Writer) error {
+		if _, err := io.WriteString(w, PAGES_HEADER+"\n"); err != nil {
+			return err
+		}
+		for _, page := range pages {
+			line, err := json.Marshal(page)
+			if err != nil {
+				return err
+			}
+			if _, err := w.Write(append(line, '\n')); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, page := range pages {
+		if page.URL == pkg.MainPageURL {
+			pkg.MainPageDate = page.TS
+			break
+		}
+	}
+
+	data, err := json.MarshalIndent(pkg, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeZipFile(archive, DATAPACKAGE_PATH, data, created); err != nil {
+		return err
+	}
+	digest, err := json.MarshalIndent(&DataPackageDigest{
+		Path: DATAPACKAGE_PATH,
+		Hash: sha256Digest(data),
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeZipFile(archive, DATAPACKAGE_DIGEST_PATH, digest, created); err != nil {
+		return err
+	}
+	return archive.Close()
+}
+
+// Recompresses a WARC file to a temporary file, indexes it and passes it to add.
+func addWARCFile(filename string, name string, add func(io.Reader) error) ([]*warc.CDXEntry, error) {
+	in, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer in.Close()
+	tmp, err := os.CreateTemp("", "wacz-*.warc.gz")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+	if _, err := warc.Recompress(in, tmp, warc.RecompressOptions{Compression: warc.COMPRESSION_GZIP}); err != nil {
+		return nil, err
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	entries, err := warc.IndexWARC(tmp, name)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	return entries, add(tmp)
+}
+
+// Lists the HTML pages captured with status 200, by date.
+func findPages(entries []*warc.CDXEntry) ([]*Page, error) {
+	pages := []*Page{}
+	for _, entry := range entries {
+		if entry.Mime != "text/html" || (entry.Status != "200" && entry.Status != "") {
+			continue
+		}
+		date, err := time.Parse("20060102150405", entry.Timestamp)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("Bad timestamp of %v: %v", entry.URL, entry.Timestamp))
+		}
+		// page ids are derived from the capture, so that packages are reproducible
+		id, err := uuid.NewV5(uuid.NamespaceURL, []byte(entry.Timestamp+" "+entry.URL))
+		if err != nil {
+			return nil, err
+		}
+		pages = append(pages, &Page{
+			ID:  strings.Replace(id.String(), "-", "", -1),
+			URL: entry.URL,
+			TS:  warc.FormatDate(date),
+		})
+	}
+	sort.SliceStable(pages, func(i, j int) bool {
+		return pages[i].TS < pages[j].TS
+	})
+	return pages, nil
+}
+
+func writeZipFile(archive *zip.Writer, path string, data []byte, modified time.Time) error {
+	writer, err := archive.CreateHeader(&zip.FileHeader{
+		Name:     path,
+		Method:   zip.Deflate,
+		Modified: modified,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = writer.Write(data)
+	return err
+}
+
+type countingWriter struct {
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	cw.n += int64(len(p))
+	return len(p), nil
+}
@@ -0,0 +1,144 @@
+package wacz
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"github.com/wolfgangmeyers/go-warc/warc"
+	. "gopkg.in/check.v1"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func Test(t *testing.T) {
+	TestingT(t)
+}
+
+type WACZSuite struct {
+	dir string
+}
+
+var waczSuite = Suite(&WACZSuite{})
+
+func (s *WACZSuite) SetUpTest(c *C) {
+	s.dir = c.MkDir()
+}
+
+// Writes a WARC file with a page and an image to dir, and returns its path.
+func writeWarc(c *C, dir string, name string, compression string, url string) string {
+	path := filepath.Join(dir, name)
+	f, err := os.Create(path)
+	c.Assert(err, IsNil)
+	defer f.Close()
+	buf := bytes.Buffer{}
+	writer := warc.NewWARCWriter(&buf, false)
+	_, err = writer.WriteRecord(warc.NewWARCRecordFromBytes(map[string]string{
+		"WARC-Target-URI": url,
+		"WARC-Date":       "2000-01-02T03:04:05Z",
+		"Content-Type":    warc.CONTENT_TYPES["response"],
+	}, []byte("HTTP/1.1 200 OK\r\nContent-Type: text/html\r\n\r\n<html><title>Hello</title></html>")))
+	c.Assert(err, IsNil)
+	_, err = writer.WriteRecord(warc.NewWARCRecordFromBytes(map[string]string{
+		"WARC-Target-URI": url + "image.png",
+		"WARC-Date":       "2000-01-02T03:04:06Z",
+		"Content-Type":    warc.CONTENT_TYPES["response"],
+	}, []byte("HTTP/1.1 200 OK\r\nContent-Type: image/png\r\n\r\nPNG")))
+	c.Assert(err, IsNil)
+	_, err = warc.Recompress(&buf, f, warc.RecompressOptions{Compression: compression})
+	c.Assert(err, IsNil)
+	return path
+}
+
+func readZipFile(c *C, file *zip.File) []byte {
+	reader, err := file.Open()
+	c.Assert(err, IsNil)
+	defer reader.Close()
+	data, err := io.ReadAll(reader)
+	c.Assert(err, IsNil)
+	return data
+}
+
+func (s *WACZSuite) TestCreate(c *C) {
+	files := []string{
+		writeWarc(c, s.dir, "one.warc", warc.COMPRESSION_NONE, "http://example.com/"),
+		writeWarc(c, s.dir, "two.warc.zst", warc.COMPRESSION_ZSTD, "http://example.org/"),
+	}
+	out := bytes.Buffer{}
+	err := Create(&out, files, Options{
+		Title:       "Sample",
+		MainPageURL: "http://example.org/",
+		Created:     time.Date(2001, 1, 1, 0, 0, 0, 0, time.UTC),
+	})
+	c.Assert(err, IsNil)
+
+	archive, err := zip.NewReader(bytes.NewReader(out.Bytes()), int64(out.Len()))
+	c.Assert(err, IsNil)
+	contents := map[string][]byte{}
+	for _, file := range archive.File {
+		contents[file.Name] = readZipFile(c, file)
+		if filepath.Dir(file.Name) == "archive" {
+			c.Assert(file.Method, Equals, zip.Store)
+		}
+	}
+	c.Assert(len(contents), Equals, 6)
+
+	pkg := &DataPackage{}
+	c.Assert(json.Unmarshal(contents[DATAPACKAGE_PATH], pkg), IsNil)
+	c.Assert(pkg.Profile, Equals, "data-package")
+	c.Assert(pkg.Title, Equals, "Sample")
+	c.Assert(pkg.Created, Equals, "2001-01-01T00:00:00Z")
+	c.Assert(pkg.MainPageDate, Equals, "2000-01-02T03:04:05Z")
+	c.Assert(len(pkg.Resources), Equals, 4)
+	for _, resource := range pkg.Resources {
+		c.Assert(resource.Hash, Equals, sha256Digest(contents[resource.Path]))
+		c.Assert(resource.Bytes, Equals, int64(len(contents[resource.Path])))
+	}
+	digest := &DataPackageDigest{}
+	c.Assert(json.Unmarshal(contents[DATAPACKAGE_DIGEST_PATH], digest), IsNil)
+	c.Assert(digest.Hash, Equals, sha256Digest(contents[DATAPACKAGE_PATH]))
+
+	// the index locates the records in the stored WARC files
+	scanner := bufio.NewScanner(bytes.NewReader(contents[INDEX_PATH]))
+	lines := 0
+	for scanner.Scan() {
+		entry, err := warc.ParseCDXEntry(scanner.Text())
+		c.Assert(err, IsNil)
+		offset, _, err := entry.Location()
+		c.Assert(err, IsNil)
+		data := contents[ARCHIVE_DIR+entry.Filename]
+		c.Assert(data, NotNil)
+		record, err := warc.ReadRecordAt(bytes.NewReader(data), offset)
+		c.Assert(err, IsNil)
+		c.Assert(record.GetUrl(), Equals, entry.URL)
+		lines++
+	}
+	c.Assert(lines, Equals, 4)
+	c.Assert(contents[ARCHIVE_DIR+"one.warc.gz"], NotNil)
+	c.Assert(contents[ARCHIVE_DIR+"two.warc.gz"], NotNil)
+
+	scanner = bufio.NewScanner(bytes.NewReader(contents[PAGES_PATH]))
+	c.Assert(scanner.Scan(), Equals, true)
+	c.Assert(scanner.Text(), Equals, PAGES_HEADER)
+	pages := []*Page{}
+	for scanner.Scan() {
+		page := &Page{}
+		c.Assert(json.Unmarshal(scanner.Bytes(), page), IsNil)
+		pages = append(pages, page)
+	}
+	c.Assert(len(pages), Equals, 2)
+	c.Assert(pages[0].TS, Equals, "2000-01-02T03:04:05Z")
+	c.Assert(pages[0].ID, Not(Equals), pages[1].ID)
+}
+
+func (s *WACZSuite) TestDuplicateNames(c *C) {
+	files := []string{
+		writeWarc(c, s.dir, "one.warc", warc.COMPRESSION_NONE, "http://example.com/"),
+		writeWarc(c, s.dir, "one.warc.gz", warc.COMPRESSION_GZIP, "http://example.com/"),
+	}
+	err := Create(&bytes.Buffer{}, files, Options{})
+	c.Assert(err, ErrorMatches, "Duplicate WARC file name: one.warc.gz")
+}
@@ -20,16 +20,20 @@ import (
 	"bufio"
 	"bytes"
 	"compress/gzip"
-//	"crypto/sha1"
-//	"encoding/hex"
+	"crypto/sha1"
+	"encoding/base32"
 	"errors"
 	"fmt"
-//	"github.com/nu7hatch/gouuid" // needed for read/write
+	"github.com/nu7hatch/gouuid"
 	"io"
+	"iter"
+	"log"
+	"math"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
-//	"time" // needed for read/write
+	"time"
 	"github.com/wolfgangmeyers/go-warc/warc/utils"
 )
 
@@ -38,6 +42,7 @@ var CONTENT_TYPES map[string]string = map[string]string{
 	"response": "application/http; msgtype=response",
 	"request":  "application/http; msgtype=request",
 	"metadata": "application/warc-fields",
+	"revisit":  "application/http; msgtype=response",
 }
 
 var KNOWN_HEADERS map[string]string = map[string]string{
@@ -50,11 +55,25 @@ var KNOWN_HEADERS map[string]string = map[string]string{
 	"request_uri":    "WARC-Request-URI",
 	"content_type":   "Content-Type",
 	"content_length": "Content-Length",
+	"block_digest":   "WARC-Block-Digest",
+	"payload_digest": "WARC-Payload-Digest",
+	"profile":        "WARC-Profile",
+	"refers_to":      "WARC-Refers-To",
+	"refers_to_uri":  "WARC-Refers-To-Target-URI",
+	"refers_to_date": "WARC-Refers-To-Date",
+}
+
+// Headers that are written first, in this order. All other headers
+// follow in alphabetical order, so that the output is reproducible.
+var HEADER_ORDER []string = []string{
+	"WARC-Type",
+	"WARC-Record-ID",
+	"WARC-Date",
 }
 
 var RE_VERSION *regexp.Regexp = regexp.MustCompile("WARC/(\\d+.\\d+)\r\n")
 var RE_HEADER *regexp.Regexp = regexp.MustCompile("([a-zA-Z_\\-]+): *(.*)\r\n")
-var SUPPORTED_VERSIONS map[string]bool = map[string]bool{"1.0": true}
+var SUPPORTED_VERSIONS map[string]bool = map[string]bool{"1.0": true, "1.1": true}
 
 //    The WARC Header object represents the headers of a WARC record.
 //    It provides dictionary like interface for accessing the headers.
@@ -70,70 +89,120 @@ var SUPPORTED_VERSIONS map[string]bool = map[string]bool{"1.0": true}
 //    :params defaults: If true, important headers like WARC-Record-ID,
 //                      WARC-Date, Content-Type and Content-Length are
 //                      initialized to automatically if not already present.
-//                      TODO: add this param back for read/write
 type WARCHeader struct {
 	version string
 	*utils.CIStringMap
 }
 
-// TODO: restore 'defaults' arg for read/write
-func NewWARCHeader(headers map[string]string/*, defaults bool*/) *WARCHeader {
+func NewWARCHeader(headers map[string]string, defaults bool) *WARCHeader {
 	warcHeader := &WARCHeader{
 		"WARC/1.0",
 		utils.NewCIStringMap(),
 	}
 	warcHeader.Update(headers)
-//	if defaults {
-//		warcHeader.InitDefaults()
-//	}
+	if defaults {
+		warcHeader.InitDefaults()
+	}
 	return warcHeader
 }
 
-// TODO: restore this when the warc file becomes read-write
+// Creates a new WARC record id of the form <urn:uuid:...>
+func NewRecordId() string {
+	recordUUID, err := uuid.NewV4()
+	if err != nil {
+		panic(err)
+	}
+	return fmt.Sprintf("<urn:uuid:%v>", recordUUID.String())
+}
+
+// Formats t as a WARC-Date value (UTC, second precision).
+func FormatDate(t time.Time) string {
+	return t.UTC().Format("2006-01-02T15:04:05Z")
+}
+
 // Initializes important headers to default values, if not already specified.
 //
 // The WARC-Record-ID header is set to a newly generated UUID.
 // The WARC-Date header is set to the current datetime.
 // The Content-Type is set based on the WARC-Type header.
 // The Content-Length is initialized to 0.
-//func (wh *WARCHeader) InitDefaults() {
-//	_, exists := wh.Get("WARC-Record-ID")
-//	if !exists {
-//		recordUUID, err := uuid.NewV4()
-//		if err != nil {
-//			panic(err)
-//		}
-//		wh.Set("WARC-Record-ID", fmt.Sprintf("<urn:uuid:%v>", recordUUID.String()))
-//	}
-//	_, exists = wh.Get("WARC-Date")
-//	if !exists {
-//		wh.Set("WARC-Date", time.Now().Format(time.RFC3339))
-//	}
-//	_, exists = wh.Get("Content-Type")
-//	if !exists {
-//		t := wh.GetType()
-//		t, exists = CONTENT_TYPES[t]
-//		if !exists {
-//			t = "application/octet-stream"
-//		}
-//		wh.Set("Content-Type", t)
-//	}
-//}
+func (wh *WARCHeader) InitDefaults() {
+	_, exists := wh.Get("WARC-Record-ID")
+	if !exists {
+		wh.Set("WARC-Record-ID", NewRecordId())
+	}
+	_, exists = wh.Get("WARC-Date")
+	if !exists {
+		wh.Set("WARC-Date", FormatDate(time.Now()))
+	}
+	_, exists = wh.Get("Content-Type")
+	if !exists {
+		t := wh.GetType()
+		t, exists = CONTENT_TYPES[t]
+		if !exists {
+			t = "application/octet-stream"
+		}
+		wh.Set("Content-Type", t)
+	}
+	_, exists = wh.Get("Content-Length")
+	if !exists {
+		wh.Set("Content-Length", "0")
+	}
+}
+
+// The WARC version of this header, e.g. "WARC/1.0"
+func (wh *WARCHeader) GetVersion() string {
+	return wh.version
+}
+
+func (wh *WARCHeader) SetVersion(version string) {
+	wh.version = version
+}
+
+// Converts a lower-cased header name back to its canonical form.
+func canonicalHeaderName(name string) string {
+	parts := strings.Split(name, "-")
+	for i, part := range parts {
+		switch part {
+		case "warc":
+			parts[i] = "WARC"
+		case "ip", "id", "uri":
+			parts[i] = strings.ToUpper(part)
+		default:
+			if part != "" {
+				parts[i] = strings.ToUpper(part[:1]) + part[1:]
+			}
+		}
+	}
+	return strings.Join(parts, "-")
+}
 
 // Writes this header to a file, in the format specified by WARC.
-func (wh *WARCHeader) WriteTo(f io.Writer) {
-	f.Write([]byte(wh.version + "\r\n"))
-	wh.Items(func(name string, value string) {
-		name = strings.Title(name)
-		// Use standard forms for commonly used patterns
-		name = strings.Replace(name, "Warc-", "WARC-", -1)
-		name = strings.Replace(name, "-Ip-", "-IP-", -1)
-		name = strings.Replace(name, "-Id", "-ID", -1)
-		name = strings.Replace(name, "-Uri", "-URI", -1)
-		f.Write([]byte(name + ": " + value + "\r\n"))
-	})
+func (wh *WARCHeader) WriteTo(f io.Writer) (int64, error) {
+	b := bytes.Buffer{}
+	b.WriteString(wh.version + "\r\n")
+	written := map[string]bool{}
+	writeHeader := func(name string) {
+		value, _ := wh.Get(name)
+		b.WriteString(canonicalHeaderName(strings.ToLower(name)) + ": " + value + "\r\n")
+		written[strings.ToLower(name)] = true
+	}
+	for _, name := range HEADER_ORDER {
+		if _, exists := wh.Get(name); exists {
+			writeHeader(name)
+		}
+	}
+	keys := wh.Keys()
+	sort.Strings(keys)
+	for _, name := range keys {
+		if !written[name] {
+			writeHeader(name)
+		}
+	}
 	// Header ends with an extra CRLF
-	f.Write([]byte("\r\n"))
+	b.WriteString("\r\n")
+	n, err := f.Write(b.Bytes())
+	return int64(n), err
 }
 
 // The Content-Length header as int.
@@ -142,7 +211,7 @@ func (wh *WARCHeader) GetContentLength() int {
 	if !exists {
 		return 0
 	}
-	result, err := strconv.ParseInt(v, 10, 32)
+	result, err := strconv.ParseInt(v, 10, 64)
 	if err != nil {
 		panic(err)
 	}
@@ -167,6 +236,16 @@ func (wh *WARCHeader) GetType() string {
 	return t
 }
 
+// Creates a copy of this header.
+func (wh *WARCHeader) Copy() *WARCHeader {
+	header := NewWARCHeader(map[string]string{}, false)
+	header.version = wh.version
+	wh.Items(func(name string, value string) {
+		header.Set(name, value)
+	})
+	return header
+}
+
 func (wh *WARCHeader) String() string {
 	b := bytes.Buffer{}
 	var f io.Writer = &b
@@ -178,24 +257,54 @@ func (wh *WARCHeader) String() string {
 type WARCRecord struct {
 	header  *WARCHeader
 	payload *utils.FilePart
+	offset  int
 }
 
 // Creates a new WARC record.
+//
+// If header is nil, a new header is created from headers with defaults
+// initialized. In that case WARC-Type defaults to "response", and the
+// Content-Length and WARC-Block-Digest headers are computed from the payload
+// if not already present.
 func NewWARCRecord(header *WARCHeader, payload *utils.FilePart, headers map[string]string) *WARCRecord {
-	warcRecord := &WARCRecord{}
+	warcRecord := &WARCRecord{offset: -1}
 	if header == nil {
-		// TODO: restore for read/write
-		header = NewWARCHeader(headers/*, true*/)
+		header = NewWARCHeader(headers, false)
+		if _, exists := header.Get("WARC-Type"); !exists {
+			header.Set("WARC-Type", "response")
+		}
+		data := []byte{}
+		if payload != nil {
+			data = payload.GetData()
+		}
+		if _, exists := header.Get("Content-Length"); !exists {
+			header.Set("Content-Length", strconv.Itoa(len(data)))
+		}
+		if _, exists := header.Get("WARC-Block-Digest"); !exists {
+			header.Set("WARC-Block-Digest", ComputeDigest(data))
+		}
+		header.InitDefaults()
 	}
 	warcRecord.header = header
 	warcRecord.payload = payload
 	return warcRecord
 }
 
-//func (wr *WARCRecord) computeDigest(payload []byte) string {
-//	hash := sha1.Sum(payload)
-//	return "sha1:" + hex.EncodeToString(hash[:20])
-//}
+// Creates a new WARC record with defaults initialized, using data as the payload.
+func NewWARCRecordFromBytes(headers map[string]string, data []byte) *WARCRecord {
+	payload, err := utils.NewFilePart(bytes.NewReader(data), len(data))
+	if err != nil {
+		panic(err)
+	}
+	return NewWARCRecord(nil, payload, headers)
+}
+
+// Computes a WARC digest value for data, in the form "sha1:<base32 digest>"
+// which is what most crawlers write in WARC-Block-Digest and WARC-Payload-Digest.
+func ComputeDigest(data []byte) string {
+	hash := sha1.Sum(data)
+	return "sha1:" + base32.StdEncoding.EncodeToString(hash[:])
+}
 
 // Record type
 func (wr *WARCRecord) GetType() string {
@@ -227,9 +336,10 @@ func (wr *WARCRecord) GetChecksum() string {
 }
 
 // Offset of this record in the warc file from which this record is read.
-// TODO: not yet implemented. Currently hard-coded to -1
+// For compressed files this is the offset of the gzip member holding the record.
+// Records that were not read from a file have an offset of -1.
 func (wr *WARCRecord) Offset() int {
-	return -1
+	return wr.offset
 }
 
 func (wr *WARCRecord) Get(name string) (string, bool) {
@@ -249,36 +359,104 @@ func (wr *WARCRecord) GetPayload() *utils.FilePart {
 	return wr.payload
 }
 
+// Returns a record holding the content of a revisit record.
+//
+// The original record is found through lookup by WARC-Refers-To, or if that
+// is missing or unknown, by WARC-Refers-To-Target-URI and WARC-Refers-To-Date
+// (falling back to the target URI and payload digest of the revisit).
+// The result is a synthetic response record with the headers of the revisit,
+// whose payload combines the HTTP headers of the revisit with the HTTP body
+// of the original. Records of other types are returned unchanged.
+func (wr *WARCRecord) ResolveRevisit(lookup RecordLookup) (*WARCRecord, error) {
+	if wr.GetType() != "revisit" {
+		return wr, nil
+	}
+	original, err := findOriginal(wr, lookup)
+	if err != nil {
+		return nil, err
+	}
+	return mergeRevisit(wr, original), nil
+}
+
+// Writes this record to a file, in the format specified by WARC.
+func (wr *WARCRecord) WriteTo(f io.Writer) (int64, error) {
+	total, err := wr.header.WriteTo(f)
+	if err != nil {
+		return total, err
+	}
+	if wr.payload != nil && wr.payload.IsStreaming() {
+		// copy streaming payloads without reading them into memory
+		n, err := io.Copy(f, wr.payload.GetReader())
+		total += n
+		if err != nil {
+			return total, err
+		}
+		if n < int64(wr.payload.GetLength()) {
+			return total, errors.New(fmt.Sprintf("Payload of record %v has %v of %v bytes",
+				wr.header.GetRecordId(), n, wr.payload.GetLength()))
+		}
+	} else if wr.payload != nil {
+		n, err := f.Write(wr.payload.GetData())
+		total += int64(n)
+		if err != nil {
+			return total, err
+		}
+	}
+	// Record ends with two CRLFs
+	n, err := f.Write([]byte("\r\n\r\n"))
+	total += int64(n)
+	return total, err
+}
+
 //TODO: port the convenience method to create from http response.
 // not sure yet how to port over the logic, or if it's
 
 type WARCFile struct {
 	filehandle io.ReadCloser
-	filebuf *bufio.Reader
-	gzipfile   *gzip.Reader
 	reader     *WARCReader
 }
 
 // Creates a new WARCFile
-// input should be a handle to a gzipped WARC file
+// input should be a handle to a WARC file, which is either uncompressed
+// or gzipped (usually with each record in a separate gzip member)
 func NewWARCFile(reader io.ReadCloser) (*WARCFile, error) {
-	filebuf := bufio.NewReader(reader)
-	gzipfile, err := gzip.NewReader(filebuf)
+	return newWARCFile(reader, nil)
+}
+
+func newWARCFile(reader io.ReadCloser, dictionary []byte) (*WARCFile, error) {
+	stream, err := newRecordStream(reader, dictionary)
 	if err != nil {
 		return nil, err
 	}
-	// make sure to read each gzipped record separately
-	gzipfile.Multistream(false)
 	// keep a handle to underlying file so that it can be closed.
 	wf := &WARCFile{
 		filehandle: reader,
-		filebuf: filebuf,
-		gzipfile:   gzipfile,
-		reader:     NewWARCReader(filebuf, gzipfile),
+		reader:     &WARCReader{stream: stream},
 	}
 	return wf, nil
 }
 
+// Reads the record stored at offset in a WARC file.
+// The offset is the one reported by WARCRecord.Offset()
+func ReadRecordAt(reader io.ReaderAt, offset int64) (*WARCRecord, error) {
+	// records in .warc.zst files may need the dictionary at the start of the file
+	dictionary, err := readZstdDictionaryAt(reader)
+	if err != nil {
+		return nil, err
+	}
+	section := io.NewSectionReader(reader, offset, math.MaxInt64-offset)
+	wf, err := newWARCFile(io.NopCloser(section), dictionary)
+	if err != nil {
+		return nil, err
+	}
+	record, err := wf.ReadRecord()
+	if err != nil {
+		return nil, err
+	}
+	record.offset = int(offset)
+	return record, nil
+}
+
 func (wf *WARCFile) GetReader() *WARCReader {
 	return wf.reader
 }
@@ -287,19 +465,47 @@ func (wf *WARCFile) ReadRecord() (*WARCRecord, error) {
 	return wf.reader.ReadRecord()
 }
 
+// Returns an iterator over the records of the file, see WARCReader.Records.
+func (wf *WARCFile) Records() iter.Seq2[*WARCRecord, error] {
+	return wf.reader.Records()
+}
+
 func (wf *WARCFile) Close() error {
 	return wf.filehandle.Close()
 }
 
 type WARCReader struct {
-	filehandle io.Reader
-	gzipfile   *gzip.Reader
+	stream *recordStream
+	// if set, segmented records are reassembled using this index
+	segments *RecordIndex
+	lenient  bool
+	onError  func(*ReadError)
 }
 
+// Creates a WARCReader for a gzipped WARC file. gzipfile must be a gzip
+// reader created on filehandle. Use NewWARCFile to read uncompressed files.
 func NewWARCReader(filehandle io.Reader, gzipfile *gzip.Reader) *WARCReader {
+	gzipfile.Multistream(false)
+	stream := &recordStream{
+		source:   filehandle,
+		gzipfile: gzipfile,
+		position: func() int64 {
+			// a reader that is not an io.ByteReader is buffered by the gzip reader,
+			// in which case its position is ahead of what has been decompressed.
+			if _, ok := filehandle.(io.ByteReader); ok {
+				if seeker, ok := filehandle.(io.Seeker); ok {
+					position, err := seeker.Seek(0, io.SeekCurrent)
+					if err == nil {
+						return position
+					}
+				}
+			}
+			return -1
+		},
+	}
+	stream.reader = bufio.NewReader(stream.guard(gzipfile))
 	warcReader := &WARCReader{
-		filehandle: filehandle,
-		gzipfile:   gzipfile,
+		stream: stream,
 	}
 	return warcReader
 }
@@ -335,8 +541,9 @@ func (wr *WARCReader) ReadHeader(reader *bufio.Reader) (*WARCHeader, error) {
 		name, value := match[1], match[2]
 		headers[name] = value
 	}
-	// TODO: restore for read/write
-	return NewWARCHeader(headers/*, false*/), nil
+	header := NewWARCHeader(headers, false)
+	header.SetVersion("WARC/" + version)
+	return header, nil
 }
 
 func (wr *WARCReader) Expect(reader *bufio.Reader, expectedLine string, message string) error {
@@ -354,36 +561,123 @@ func (wr *WARCReader) Expect(reader *bufio.Reader, expectedLine string, message
 	return nil
 }
 
+// Makes ReadRecord reassemble segmented records into a single logical record,
+// using index to locate the continuation records. The index must contain all
+// files that hold segments of records read by this reader. Continuation records
+// are skipped. Pass nil to read segments as separate records again.
+func (wr *WARCReader) SetSegmentIndex(index *RecordIndex) {
+	wr.segments = index
+}
+
+// Makes the reader skip records that cannot be read instead of returning
+// an error. After an error, the reader scans forward to the next line that
+// starts with "WARC/" or, if the gzip member or zstd frame holding the
+// record is corrupt, to the next gzip member or zstd frame. Each error is
+// passed to onError, with the number of bytes that were skipped, or
+// logged if onError is nil.
+func (wr *WARCReader) SetLenient(onError func(*ReadError)) {
+	wr.lenient = true
+	wr.onError = onError
+}
+
 func (wr *WARCReader) ReadRecord() (*WARCRecord, error) {
-	reader := bufio.NewReader(wr.gzipfile)
-	header, err := wr.ReadHeader(reader)
-	
-	if err != nil && strings.Index(err.Error(), "EOF") > -1 {
-		return nil, errors.New("EOF")
+	for {
+		record, err := wr.readRecord()
+		if err != nil || wr.segments == nil {
+			return record, err
+		}
+		if record.GetType() == "continuation" {
+			continue
+		}
+		if IsFirstSegment(record) {
+			return wr.segments.Reassemble(record)
+		}
+		return record, nil
+	}
+}
+
+func (wr *WARCReader) readRecord() (*WARCRecord, error) {
+	for {
+		offset, record, err := wr.parseRecord()
+		if err == nil {
+			return record, nil
+		}
+		if ctx := wr.stream.ctx; ctx != nil && ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if !wr.lenient {
+			if offset < 0 && err == io.EOF {
+				return nil, io.EOF
+			}
+			return nil, err
+		}
+		if offset < 0 {
+			// the end of the file
+			return nil, io.EOF
+		}
+		next, resyncErr := wr.stream.resync()
+		if resyncErr != nil && resyncErr != io.EOF {
+			return nil, resyncErr
+		}
+		if resyncErr == io.EOF {
+			next = wr.stream.position()
+		}
+		readError := &ReadError{Offset: offset, Skipped: next - offset, Err: err}
+		if wr.onError != nil {
+			wr.onError(readError)
+		} else {
+			log.Println(readError)
+		}
+		if resyncErr == io.EOF {
+			return nil, io.EOF
+		}
+	}
+}
+
+// Reads the next record, returning its offset. If the end of the file
+// is reached before a record starts, the offset is -1.
+func (wr *WARCReader) parseRecord() (int64, *WARCRecord, error) {
+	offset, err := wr.stream.next()
+	if err == io.EOF {
+		return -1, nil, err
 	}
 	if err != nil {
-		return nil, err
+		return wr.stream.offset(), nil, err
+	}
+	reader := wr.stream.reader
+	header, err := wr.ReadHeader(reader)
+	if err == io.EOF {
+		err = errors.New(fmt.Sprintf("Truncated header at offset %v: %v", offset, io.ErrUnexpectedEOF))
 	}
-	payload, err := utils.NewFilePart(reader, header.GetContentLength())
 	if err != nil {
-		panic(err)
+		return offset, nil, err
+	}
+	value, exists := header.Get("Content-Length")
+	length, err := strconv.Atoi(value)
+	if exists && (err != nil || length < 0) {
+		return offset, nil, errors.New(fmt.Sprintf("Bad Content-Length at offset %v: %v", offset, value))
+	}
+	payload, err := utils.NewFilePart(reader, length)
+	if err == nil && len(payload.GetData()) < length {
+		err = errors.New(fmt.Sprintf("%v of %v bytes", len(payload.GetData()), length))
 	}
-	// consume the footer from the previous record
-	wr.Expect(reader, "\r\n", "")
-	wr.Expect(reader, "\r\n", "")
-	// the last call advances to the end of the gzip file
-	wr.Expect(reader, "\r\n", "")
-	// start reading the next record in the gzip file
-	wr.gzipfile.Reset(wr.filehandle)
-	wr.gzipfile.Multistream(false)
-	
 	if err != nil {
-		return nil, err
+		return offset, nil, errors.New(fmt.Sprintf("Truncated record at offset %v: %v", offset, err))
 	}
+	// consume the CRLFCRLF that ends the record
+	for i := 0; i < 2; i++ {
+		if err := wr.Expect(reader, "\r\n", ""); err != nil {
+			return offset, nil, errors.New(fmt.Sprintf("Bad end of record at offset %v: %v", offset, err))
+		}
+	}
+
 	record := NewWARCRecord(header, payload, map[string]string{})
-	return record, nil
+	record.offset = int(offset)
+	return offset, record, nil
 }
 
+// Calls callback with each record, and then with a nil record and the
+// error that ended the iteration. Records is easier to use.
 func (wr *WARCReader) Iterate(callback func(*WARCRecord, error)) {
 	record, err := wr.ReadRecord()
 	callback(record, err)
@@ -392,3 +686,37 @@ func (wr *WARCReader) Iterate(callback func(*WARCRecord, error)) {
 		callback(record, err)
 	}
 }
+
+// Returns an iterator over the records of the reader, for use with range:
+//
+//	for record, err := range reader.Records() {
+//		if err != nil {
+//			return err
+//		}
+//		...
+//	}
+//
+// The iteration stops at the end of the file, or after an error that
+// ends the file is yielded. Payloads are read into memory as each record
+// is read, or streamed from other files for reassembled segments, so a
+// record stays valid after the loop moves on or breaks out early.
+func (wr *WARCReader) Records() iter.Seq2[*WARCRecord, error] {
+	return records(wr.ReadRecord)
+}
+
+func records(read func() (*WARCRecord, error)) iter.Seq2[*WARCRecord, error] {
+	return func(yield func(*WARCRecord, error) bool) {
+		for {
+			record, err := read()
+			if err != nil {
+				if err != io.EOF {
+					yield(nil, err)
+				}
+				return
+			}
+			if !yield(record, nil) {
+				return
+			}
+		}
+	}
+}
@@ -3,6 +3,7 @@ package warc
 import (
 	"bytes"
 	"compress/gzip"
+	"fmt"
 	. "gopkg.in/check.v1"
 	"testing"
 )
@@ -21,7 +22,7 @@ func (s *WARCHeaderSuite) TestAttrs(c *C) {
 		"WARC-Record-ID": "<record-1>",
 		"WARC-Date":      "2000-01-02T03:04:05Z",
 		"Content-Length": "10",
-	})
+	}, false)
 	c.Assert(h.GetType(), Equals, "response")
 	c.Assert(h.GetRecordId(), Equals, "<record-1>")
 	c.Assert(h.GetDate(), Equals, "2000-01-02T03:04:05Z")
@@ -32,7 +33,7 @@ func (s *WARCHeaderSuite) TestItemAccess(c *C) {
 	h := NewWARCHeader(map[string]string{
 		"WARC-Type":    "response",
 		"X-New-Header": "42",
-	})
+	}, false)
 	v, _ := h.Get("WARC-Type")
 	c.Assert(v, Equals, "response")
 	v, _ = h.Get("WARC-TYPE")
@@ -46,7 +47,51 @@ func (s *WARCHeaderSuite) TestItemAccess(c *C) {
 	c.Assert(v, Equals, "42")
 }
 
-// TODO: test String(), InitDefaults() and new content types once read/write is implemented
+func (s *WARCHeaderSuite) TestInitDefaults(c *C) {
+	h := NewWARCHeader(map[string]string{"WARC-Type": "revisit"}, true)
+	c.Assert(h.GetRecordId(), Matches, "<urn:uuid:[0-9a-f-]{36}>")
+	c.Assert(h.GetDate(), Matches, "\\d{4}-\\d{2}-\\d{2}T\\d{2}:\\d{2}:\\d{2}Z")
+	v, _ := h.Get("Content-Type")
+	c.Assert(v, Equals, "application/http; msgtype=response")
+	c.Assert(h.GetContentLength(), Equals, 0)
+
+	h = NewWARCHeader(map[string]string{"WARC-Type": "resource"}, true)
+	v, _ = h.Get("Content-Type")
+	c.Assert(v, Equals, "application/octet-stream")
+}
+
+func (s *WARCHeaderSuite) TestString(c *C) {
+	h := NewWARCHeader(map[string]string{
+		"Content-Length":               "10",
+		"WARC-Date":                    "2000-01-02T03:04:05Z",
+		"WARC-Type":                    "response",
+		"WARC-Record-ID":               "<record-1>",
+		"WARC-IP-Address":              "127.0.0.1",
+		"warc-target-uri":              "http://example.com/",
+		"WARC-Identified-Payload-Type": "text/html",
+	}, false)
+	c.Assert(h.String(), Equals, "WARC/1.0\r\n"+
+		"WARC-Type: response\r\n"+
+		"WARC-Record-ID: <record-1>\r\n"+
+		"WARC-Date: 2000-01-02T03:04:05Z\r\n"+
+		"Content-Length: 10\r\n"+
+		"WARC-Identified-Payload-Type: text/html\r\n"+
+		"WARC-IP-Address: 127.0.0.1\r\n"+
+		"WARC-Target-URI: http://example.com/\r\n"+
+		"\r\n")
+}
+
+type WARCRecordSuite struct{}
+
+var warcRecordSuite = Suite(&WARCRecordSuite{})
+
+func (s *WARCRecordSuite) TestDefaults(c *C) {
+	record := NewWARCRecordFromBytes(map[string]string{}, []byte("Helloworld"))
+	c.Assert(record.GetType(), Equals, "response")
+	c.Assert(record.GetHeader().GetContentLength(), Equals, 10)
+	v, _ := record.Get("WARC-Block-Digest")
+	c.Assert(v, Equals, "sha1:DQ6D7IFDFK7TI45D5CHQPI3XAJPCRQB6")
+}
 
 func getSampleWarcRecord(numRecords int) []byte {
 	text := "WARC/1.0\r\n" +
@@ -70,6 +115,33 @@ func getSampleWarcRecord(numRecords int) []byte {
 	return buf.Bytes()
 }
 
+// Returns count records for http://example.com/0, http://example.com/1 and so
+// on, each with the given headers and the block that block returns for it.
+func getSampleRecords(count int, headers map[string]string, block func(i int) []byte) []*WARCRecord {
+	records := []*WARCRecord{}
+	for i := 0; i < count; i++ {
+		header := map[string]string{"WARC-Target-URI": fmt.Sprintf("http://example.com/%v", i)}
+		for name, value := range headers {
+			header[name] = value
+		}
+		records = append(records, NewWARCRecordFromBytes(header, block(i)))
+	}
+	return records
+}
+
+// Writes records with writer, returning the offsets of the records.
+func writeSampleRecords(writer *WARCWriter, records []*WARCRecord) ([]int64, error) {
+	offsets := []int64{}
+	for _, record := range records {
+		offset, err := writer.WriteRecord(record)
+		if err != nil {
+			return nil, err
+		}
+		offsets = append(offsets, offset)
+	}
+	return offsets, nil
+}
+
 type WARCReaderSuite struct{}
 
 var warcReaderSuite = Suite(&WARCReaderSuite{})
@@ -156,5 +228,118 @@ func (w *WARCFileSuite) TestRead(c *C) {
 	c.Assert(record, IsNil)
 }
 
-// TODO: add tests for write gz and test long header when read/write is implemented
+func (w *WARCFileSuite) TestOffsets(c *C) {
+	data := getSampleWarcRecord(3)
+	f, err := NewWARCFile(&ClosingBuffer{bytes.NewReader(data)})
+	c.Assert(err, IsNil)
+	offsets := []int{}
+	for {
+		record, err := f.ReadRecord()
+		if err != nil {
+			break
+		}
+		offsets = append(offsets, record.Offset())
+	}
+	c.Assert(len(offsets), Equals, 3)
+	c.Assert(offsets[0], Equals, 0)
+	memberLength := len(data) / 3
+	c.Assert(offsets[1], Equals, memberLength)
+	c.Assert(offsets[2], Equals, 2*memberLength)
+
+	record, err := ReadRecordAt(bytes.NewReader(data), int64(offsets[2]))
+	c.Assert(err, IsNil)
+	c.Assert(record.Offset(), Equals, offsets[2])
+	c.Assert(record.GetUrl(), Equals, "http://example.com/")
+}
+
+func (w *WARCFileSuite) TestReadUncompressed(c *C) {
+	buf := bytes.Buffer{}
+	writer := NewWARCWriter(&buf, false)
+	for i := 0; i < 2; i++ {
+		writer.WriteRecord(NewWARCRecordFromBytes(map[string]string{}, []byte("Helloworld")))
+	}
+	f, err := NewWARCFile(&ClosingBuffer{bytes.NewReader(buf.Bytes())})
+	c.Assert(err, IsNil)
+	record, err := f.ReadRecord()
+	c.Assert(err, IsNil)
+	c.Assert(record.Offset(), Equals, 0)
+	record, err = f.ReadRecord()
+	c.Assert(err, IsNil)
+	c.Assert(record.Offset(), Equals, buf.Len()/2)
+	c.Assert(string(record.GetPayload().GetData()), Equals, "Helloworld")
+	record, _ = f.ReadRecord()
+	c.Assert(record, IsNil)
+}
+
+func (s *WARCReaderSuite) TestBadEndOfRecord(c *C) {
+	data := "WARC/1.0\r\nWARC-Type: resource\r\nContent-Length: 5\r\n\r\nHelloworld\r\n\r\n"
+	f, err := NewWARCFile(&ClosingBuffer{bytes.NewReader([]byte(data))})
+	c.Assert(err, IsNil)
+	_, err = f.ReadRecord()
+	c.Assert(err, ErrorMatches, "(?s)Bad end of record at offset 0: .*")
+
+	data = "WARC/1.0\r\nWARC-Type: resource\r\nContent-Length: 50\r\n\r\nHelloworld\r\n\r\n"
+	f, err = NewWARCFile(&ClosingBuffer{bytes.NewReader([]byte(data))})
+	c.Assert(err, IsNil)
+	_, err = f.ReadRecord()
+	c.Assert(err, ErrorMatches, "Truncated record at offset 0: .*")
+}
+
+func (s *WARCReaderSuite) TestTruncatedLastRecord(c *C) {
+	record := "WARC/1.0\r\nWARC-Type: resource\r\nContent-Length: 10\r\n\r\nHelloworld"
+	data := record + "\r\n\r\n" + record
+	f, err := NewWARCFile(&ClosingBuffer{bytes.NewReader([]byte(data))})
+	c.Assert(err, IsNil)
+	_, err = f.ReadRecord()
+	c.Assert(err, IsNil)
+	_, err = f.ReadRecord()
+	c.Assert(err, ErrorMatches, "Bad end of record at offset 67: EOF")
 
+	data = record + "\r\n\r\nWARC/1.0\r\nWARC-Type: reso"
+	f, err = NewWARCFile(&ClosingBuffer{bytes.NewReader([]byte(data))})
+	c.Assert(err, IsNil)
+	_, err = f.ReadRecord()
+	c.Assert(err, IsNil)
+	_, err = f.ReadRecord()
+	c.Assert(err, ErrorMatches, "Truncated header at offset 67: unexpected EOF")
+	_, err = f.ReadRecord()
+	c.Assert(err, ErrorMatches, "EOF")
+}
+
+func (w *WARCFileSuite) TestRecords(c *C) {
+	f, err := NewWARCFile(&ClosingBuffer{bytes.NewReader(getSampleWarcRecord(3))})
+	c.Assert(err, IsNil)
+	records := []*WARCRecord{}
+	for record, err := range f.Records() {
+		c.Assert(err, IsNil)
+		records = append(records, record)
+		if len(records) == 2 {
+			break
+		}
+	}
+	// the records stay valid, and the file can be read on
+	c.Assert(string(records[0].GetPayload().GetData()), Equals, "Helloworld")
+	c.Assert(string(records[1].GetPayload().GetData()), Equals, "Helloworld")
+	for record, err := range f.Records() {
+		c.Assert(err, IsNil)
+		records = append(records, record)
+	}
+	c.Assert(len(records), Equals, 3)
+	c.Assert(records[2].Offset(), Equals, 2*records[1].Offset())
+	for range f.Records() {
+		c.Fail()
+	}
+}
+
+func (s *WARCReaderSuite) TestRecordsError(c *C) {
+	data := "WARC/1.0\r\nWARC-Type: resource\r\nContent-Length: 5\r\n\r\nHelloworld\r\n\r\n"
+	f, err := NewWARCFile(&ClosingBuffer{bytes.NewReader([]byte(data))})
+	c.Assert(err, IsNil)
+	errors := []error{}
+	for record, err := range f.Records() {
+		c.Assert(record, IsNil)
+		errors = append(errors, err)
+	}
+	c.Assert(len(errors), Equals, 1)
+	c.Assert(errors[0], ErrorMatches, "(?s)Bad end of record at offset 0: .*")
+}
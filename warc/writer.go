@@ -0,0 +1,184 @@
+package warc
+
+/*
+	Copyright (C) 2015  Wolfgang Meyers
+
+    This program is free software; you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation; either version 2 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License along
+    with this program; if not, write to the Free Software Foundation, Inc.,
+    51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+*/
+import (
+	"compress/gzip"
+	"fmt"
+	"github.com/klauspost/compress/zstd"
+	"io"
+	"os"
+)
+
+// WARCWriter writes WARC records to an underlying file.
+// If compress is true, each record is written as a separate gzip member,
+// which is what WARCReader expects and allows random access by offset.
+// Writers created by NewZstdWARCWriter write a zstd frame per record instead.
+type WARCWriter struct {
+	filehandle io.Writer
+	compress   bool
+	encoder    *zstd.Encoder
+	offset     int64
+}
+
+// Creates a new WARCWriter
+func NewWARCWriter(filehandle io.Writer, compress bool) *WARCWriter {
+	return &WARCWriter{
+		filehandle: filehandle,
+		compress:   compress,
+	}
+}
+
+// Writes a record, returning the offset at which it starts.
+func (ww *WARCWriter) WriteRecord(record *WARCRecord) (int64, error) {
+	return ww.writeMember(func(w io.Writer) error {
+		_, err := record.WriteTo(w)
+		return err
+	})
+}
+
+// Writes what write produces as a single gzip member or zstd frame,
+// or as is for uncompressed files, returning the offset at which it starts.
+func (ww *WARCWriter) writeMember(write func(io.Writer) error) (int64, error) {
+	offset := ww.offset
+	counter := &countingWriter{w: ww.filehandle}
+	if ww.encoder != nil {
+		if err := ww.writeZstdFrame(write, counter); err != nil {
+			return offset, err
+		}
+	} else if ww.compress {
+		gzout := gzip.NewWriter(counter)
+		if err := write(gzout); err != nil {
+			return offset, err
+		}
+		if err := gzout.Close(); err != nil {
+			return offset, err
+		}
+	} else {
+		if err := write(counter); err != nil {
+			return offset, err
+		}
+	}
+	ww.offset += counter.n
+	return offset, nil
+}
+
+// The number of bytes written so far, which is the offset of the next record.
+func (ww *WARCWriter) Tell() int64 {
+	return ww.offset
+}
+
+// RotatingWARCWriter writes records to a series of WARC files, starting a
+// new file once the current one has reached maxSize bytes. File names are
+// created by formatting pattern with a serial number, e.g. "crawl-%05d.warc.gz".
+//
+// Records with a block larger than maxSize bytes are segmented, and each
+// segment is written to a file of its own.
+type RotatingWARCWriter struct {
+	pattern   string
+	maxSize   int64
+	compress  bool
+	file      *os.File
+	writer    *WARCWriter
+	filenames []string
+}
+
+// Creates a new RotatingWARCWriter. The first file is created on the first write.
+func NewRotatingWARCWriter(pattern string, maxSize int64, compress bool) *RotatingWARCWriter {
+	return &RotatingWARCWriter{
+		pattern:  pattern,
+		maxSize:  maxSize,
+		compress: compress,
+	}
+}
+
+// Writes a record, returning the name of the file and the offset at which
+// it starts. For segmented records, the location of the first segment is returned.
+func (rw *RotatingWARCWriter) WriteRecord(record *WARCRecord) (string, int64, error) {
+	segments := SegmentRecord(record, int(rw.maxSize))
+	var filename string
+	var offset int64
+	for i, segment := range segments {
+		if rw.writer != nil && len(segments) > 1 && rw.writer.Tell() > 0 {
+			if err := rw.closeFile(); err != nil {
+				return filename, offset, err
+			}
+		}
+		if rw.writer == nil {
+			if err := rw.openFile(); err != nil {
+				return filename, offset, err
+			}
+		}
+		segmentOffset, err := rw.writer.WriteRecord(segment)
+		if err != nil {
+			return filename, offset, err
+		}
+		if i == 0 {
+			filename, offset = rw.file.Name(), segmentOffset
+		}
+		if rw.writer.Tell() >= rw.maxSize {
+			if err := rw.closeFile(); err != nil {
+				return filename, offset, err
+			}
+		}
+	}
+	return filename, offset, nil
+}
+
+// The names of all files written so far, in order.
+func (rw *RotatingWARCWriter) Filenames() []string {
+	return rw.filenames
+}
+
+func (rw *RotatingWARCWriter) openFile() error {
+	filename := fmt.Sprintf(rw.pattern, len(rw.filenames))
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	rw.file = file
+	rw.writer = NewWARCWriter(file, rw.compress)
+	rw.filenames = append(rw.filenames, filename)
+	return nil
+}
+
+func (rw *RotatingWARCWriter) closeFile() error {
+	err := rw.file.Close()
+	rw.file = nil
+	rw.writer = nil
+	return err
+}
+
+// Closes the current file.
+func (rw *RotatingWARCWriter) Close() error {
+	if rw.file == nil {
+		return nil
+	}
+	return rw.closeFile()
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,76 @@
+package warc
+
+import (
+	"bytes"
+	. "gopkg.in/check.v1"
+	"strings"
+)
+
+type WARCWriterSuite struct{}
+
+var warcWriterSuite = Suite(&WARCWriterSuite{})
+
+func (s *WARCWriterSuite) TestWriteGz(c *C) {
+	buf := bytes.Buffer{}
+	writer := NewWARCWriter(&buf, true)
+	for i := 0; i < 3; i++ {
+		record := NewWARCRecordFromBytes(map[string]string{
+			"WARC-Target-URI": "http://example.com/",
+		}, []byte("Helloworld"))
+		offset, err := writer.WriteRecord(record)
+		c.Assert(err, IsNil)
+		if i == 0 {
+			c.Assert(offset, Equals, int64(0))
+		} else {
+			c.Assert(offset > 0, Equals, true)
+		}
+	}
+	c.Assert(writer.Tell(), Equals, int64(buf.Len()))
+
+	f, err := NewWARCFile(&ClosingBuffer{bytes.NewReader(buf.Bytes())})
+	c.Assert(err, IsNil)
+	for i := 0; i < 3; i++ {
+		record, err := f.ReadRecord()
+		c.Assert(err, IsNil)
+		c.Assert(record.GetUrl(), Equals, "http://example.com/")
+		c.Assert(string(record.GetPayload().GetData()), Equals, "Helloworld")
+	}
+	record, _ := f.ReadRecord()
+	c.Assert(record, IsNil)
+}
+
+func (s *WARCWriterSuite) TestWriteUncompressed(c *C) {
+	buf := bytes.Buffer{}
+	writer := NewWARCWriter(&buf, false)
+	header := NewWARCHeader(map[string]string{
+		"WARC-Type":      "resource",
+		"WARC-Record-ID": "<record-1>",
+		"WARC-Date":      "2000-01-02T03:04:05Z",
+		"Content-Length": "10",
+	}, false)
+	record := NewWARCRecord(header, NewWARCRecordFromBytes(nil, []byte("Helloworld")).GetPayload(), nil)
+	_, err := writer.WriteRecord(record)
+	c.Assert(err, IsNil)
+	c.Assert(buf.String(), Equals, "WARC/1.0\r\n"+
+		"WARC-Type: resource\r\n"+
+		"WARC-Record-ID: <record-1>\r\n"+
+		"WARC-Date: 2000-01-02T03:04:05Z\r\n"+
+		"Content-Length: 10\r\n"+
+		"\r\n"+
+		"Helloworld\r\n\r\n")
+}
+
+func (s *WARCWriterSuite) TestLongHeader(c *C) {
+	buf := bytes.Buffer{}
+	writer := NewWARCWriter(&buf, true)
+	url := "http://example.com/" + strings.Repeat("a", 8192)
+	_, err := writer.WriteRecord(NewWARCRecordFromBytes(map[string]string{
+		"WARC-Target-URI": url,
+	}, []byte("Helloworld")))
+	c.Assert(err, IsNil)
+	f, err := NewWARCFile(&ClosingBuffer{bytes.NewReader(buf.Bytes())})
+	c.Assert(err, IsNil)
+	record, err := f.ReadRecord()
+	c.Assert(err, IsNil)
+	c.Assert(record.GetUrl(), Equals, url)
+}
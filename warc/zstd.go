@@ -0,0 +1,276 @@
+package warc
+
+/*
+	Copyright (C) 2015  Wolfgang Meyers
+
+    This program is free software; you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation; either version 2 of the License, or
+    (at your option) any later version.
+
+    This program is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License along
+    with this program; if not, write to the Free Software Foundation, Inc.,
+    51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+*/
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/klauspost/compress/zstd"
+	"io"
+)
+
+// Magic numbers of the zstd format, as used by .warc.zst files
+var ZSTD_MAGIC uint32 = 0xFD2FB528
+var ZSTD_DICTIONARY_MAGIC uint32 = 0xEC30A437
+
+// The skippable frame holding the dictionary of a .warc.zst file
+var ZSTD_DICTIONARY_FRAME_MAGIC uint32 = 0x184D2A5D
+
+// The largest dictionary that is read from a .warc.zst file, compressed
+// or not. Larger dictionary frames are taken for corrupt data.
+var MAX_ZSTD_DICTIONARY_SIZE int = 16 << 20
+
+func isSkippableFrame(magic uint32) bool {
+	return magic&0xFFFFFFF0 == 0x184D2A50
+}
+
+func peekMagic(reader *bufio.Reader) (uint32, error) {
+	b, err := reader.Peek(4)
+	if err != nil {
+		return 0, err
+	}
+	return binary.LittleEndian.Uint32(b), nil
+}
+
+func isZstd(reader *bufio.Reader) bool {
+	magic, err := peekMagic(reader)
+	return err == nil && (magic == ZSTD_MAGIC || isSkippableFrame(magic))
+}
+
+// Reads the header of a skippable frame, returning its magic number
+// and the length of its content.
+func readSkippableFrameHeader(reader io.Reader) (uint32, int64, error) {
+	header := make([]byte, 8)
+	if _, err := io.ReadFull(reader, header); err != nil {
+		return 0, 0, err
+	}
+	return binary.LittleEndian.Uint32(header), int64(binary.LittleEndian.Uint32(header[4:])), nil
+}
+
+// Reads a skippable frame, returning its magic number and content,
+// which may be at most maxSize bytes.
+func readSkippableFrame(reader io.Reader, maxSize int) (uint32, []byte, error) {
+	magic, length, err := readSkippableFrameHeader(reader)
+	if err != nil {
+		return 0, nil, err
+	}
+	if length > int64(maxSize) {
+		return 0, nil, errors.New(fmt.Sprintf("Skippable frame of %v bytes is larger than %v bytes", length, maxSize))
+	}
+	content := make([]byte, length)
+	if _, err := io.ReadFull(reader, content); err != nil {
+		return 0, nil, err
+	}
+	return magic, content, nil
+}
+
+// Skips a skippable frame without reading its content into memory.
+func skipSkippableFrame(reader io.Reader) error {
+	_, length, err := readSkippableFrameHeader(reader)
+	if err != nil {
+		return err
+	}
+	if _, err := io.CopyN(io.Discard, reader, length); err != nil {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+
+// Checks the content of a dictionary frame, decompressing it if needed.
+func loadZstdDictionary(content []byte) ([]byte, error) {
+	if len(content) >= 4 && binary.LittleEndian.Uint32(content) == ZSTD_MAGIC {
+		decoder, err := zstd.NewReader(nil, zstd.WithDecoderMaxMemory(uint64(MAX_ZSTD_DICTIONARY_SIZE)))
+		if err != nil {
+			return nil, err
+		}
+		defer decoder.Close()
+		content, err = decoder.DecodeAll(content, nil)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(content) < 4 || binary.LittleEndian.Uint32(content) != ZSTD_DICTIONARY_MAGIC {
+		return nil, errors.New("Unsupported zstd dictionary")
+	}
+	return content, nil
+}
+
+// Reads the dictionary stored at the start of a .warc.zst file, if any.
+// Returns nil if the file does not start with a dictionary frame.
+func readZstdDictionaryAt(reader io.ReaderAt) ([]byte, error) {
+	magic := make([]byte, 4)
+	if _, err := reader.ReadAt(magic, 0); err != nil {
+		return nil, nil
+	}
+	if binary.LittleEndian.Uint32(magic) != ZSTD_DICTIONARY_FRAME_MAGIC {
+		return nil, nil
+	}
+	_, content, err := readSkippableFrame(io.NewSectionReader(reader, 0, 1<<62), MAX_ZSTD_DICTIONARY_SIZE)
+	if err != nil {
+		return nil, err
+	}
+	return loadZstdDictionary(content)
+}
+
+func newZstdDecoder(dictionary []byte) (*zstd.Decoder, error) {
+	options := []zstd.DOption{zstd.WithDecoderConcurrency(1)}
+	if dictionary != nil {
+		options = append(options, zstd.WithDecoderDicts(dictionary))
+	}
+	return zstd.NewReader(nil, options...)
+}
+
+// zstdFrameReader passes through the bytes of exactly one zstd frame,
+// so that the decoder does not read beyond the frame and the offset of
+// the next frame is known. Block headers are parsed to find the end of the frame.
+type zstdFrameReader struct {
+	source *bufio.Reader
+	// bytes to pass through before the rest of the current block
+	pending []byte
+	// bytes of the current block that are left
+	remaining int
+	last      bool
+	checksum  bool
+	done      bool
+}
+
+func newZstdFrameReader(source *bufio.Reader) (*zstdFrameReader, error) {
+	header, err := source.Peek(5)
+	if err != nil {
+		return nil, err
+	}
+	if binary.LittleEndian.Uint32(header) != ZSTD_MAGIC {
+		return nil, errors.New(fmt.Sprintf("Bad zstd frame magic: %x", header[:4]))
+	}
+	descriptor := header[4]
+	singleSegment := descriptor&0x20 != 0
+	size := 5
+	if !singleSegment {
+		// window descriptor
+		size++
+	}
+	size += []int{0, 1, 2, 4}[descriptor&0x03]
+	contentSizeFlag := descriptor >> 6
+	if contentSizeFlag == 0 && singleSegment {
+		size++
+	} else {
+		size += []int{0, 2, 4, 8}[contentSizeFlag]
+	}
+	pending := make([]byte, size)
+	if _, err := io.ReadFull(source, pending); err != nil {
+		return nil, io.ErrUnexpectedEOF
+	}
+	return &zstdFrameReader{
+		source:   source,
+		pending:  pending,
+		checksum: descriptor&0x04 != 0,
+	}, nil
+}
+
+func (fr *zstdFrameReader) Read(p []byte) (int, error) {
+	for len(fr.pending) == 0 && fr.remaining == 0 {
+		if fr.done {
+			return 0, io.EOF
+		}
+		if fr.last {
+			fr.done = true
+			if fr.checksum {
+				fr.remaining = 4
+			}
+			continue
+		}
+		blockHeader := make([]byte, 3)
+		if _, err := io.ReadFull(fr.source, blockHeader); err != nil {
+			return 0, io.ErrUnexpectedEOF
+		}
+		value := uint32(blockHeader[0]) | uint32(blockHeader[1])<<8 | uint32(blockHeader[2])<<16
+		fr.last = value&1 == 1
+		blockType := (value >> 1) & 3
+		fr.remaining = int(value >> 3)
+		if blockType == 1 {
+			// RLE blocks hold a single byte
+			fr.remaining = 1
+		} else if blockType == 3 {
+			return 0, errors.New("Bad zstd block type")
+		}
+		fr.pending = blockHeader
+	}
+	if len(fr.pending) > 0 {
+		n := copy(p, fr.pending)
+		fr.pending = fr.pending[n:]
+		return n, nil
+	}
+	if len(p) > fr.remaining {
+		p = p[:fr.remaining]
+	}
+	n, err := fr.source.Read(p)
+	fr.remaining -= n
+	if n > 0 {
+		return n, nil
+	}
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+// Creates a WARCWriter that writes each record as a separate zstd frame,
+// following the .warc.zst convention. If dictionary is not nil, it is
+// written to the start of the file in a skippable frame and used to
+// compress all records. It must be in the zstd dictionary format,
+// as created by "zstd --train".
+func NewZstdWARCWriter(filehandle io.Writer, dictionary []byte) (*WARCWriter, error) {
+	options := []zstd.EOption{zstd.WithEncoderConcurrency(1)}
+	if dictionary != nil {
+		if _, err := loadZstdDictionary(dictionary); err != nil {
+			return nil, err
+		}
+		options = append(options, zstd.WithEncoderDict(dictionary))
+	}
+	encoder, err := zstd.NewWriter(nil, options...)
+	if err != nil {
+		return nil, err
+	}
+	ww := &WARCWriter{
+		filehandle: filehandle,
+		encoder:    encoder,
+	}
+	if dictionary != nil {
+		header := make([]byte, 8)
+		binary.LittleEndian.PutUint32(header, ZSTD_DICTIONARY_FRAME_MAGIC)
+		binary.LittleEndian.PutUint32(header[4:], uint32(len(dictionary)))
+		n, err := filehandle.Write(append(header, dictionary...))
+		ww.offset += int64(n)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return ww, nil
+}
+
+// Compresses what write produces into a single frame as it is written,
+// so that records are never held in memory as a whole.
+func (ww *WARCWriter) writeZstdFrame(write func(io.Writer) error, writer io.Writer) error {
+	ww.encoder.Reset(writer)
+	if err := write(ww.encoder); err != nil {
+		return err
+	}
+	return ww.encoder.Close()
+}
@@ -0,0 +1,162 @@
+package warc
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/klauspost/compress/zstd"
+	. "gopkg.in/check.v1"
+	"strings"
+)
+
+type ZstdSuite struct{}
+
+var zstdSuite = Suite(&ZstdSuite{})
+
+func getZstdRecords() []*WARCRecord {
+	return getSampleRecords(50, map[string]string{
+		"Content-Type": CONTENT_TYPES["response"],
+	}, func(i int) []byte {
+		return []byte(fmt.Sprintf("HTTP/1.1 200 OK\r\nContent-Type: text/html\r\n\r\n<html><body>Page %v</body></html>", i))
+	})
+}
+
+func getZstdDictionary(c *C) []byte {
+	samples := [][]byte{}
+	for _, record := range getZstdRecords() {
+		buf := bytes.Buffer{}
+		record.WriteTo(&buf)
+		samples = append(samples, buf.Bytes())
+	}
+	dictionary, err := zstd.BuildDict(zstd.BuildDictOptions{
+		ID:       1234,
+		Contents: samples[1:],
+		History:  samples[0][:len(samples[0])/2],
+		Offsets:  [3]int{1, 4, 8},
+	})
+	c.Assert(err, IsNil)
+	return dictionary
+}
+
+func writeZstdFile(c *C, dictionary []byte, records []*WARCRecord) ([]byte, []int64) {
+	buf := bytes.Buffer{}
+	writer, err := NewZstdWARCWriter(&buf, dictionary)
+	c.Assert(err, IsNil)
+	offsets, err := writeSampleRecords(writer, records)
+	c.Assert(err, IsNil)
+	c.Assert(writer.Tell(), Equals, int64(buf.Len()))
+	return buf.Bytes(), offsets
+}
+
+func checkZstdFile(c *C, data []byte, records []*WARCRecord, offsets []int64) {
+	f, err := NewWARCFile(&ClosingBuffer{bytes.NewReader(data)})
+	c.Assert(err, IsNil)
+	for i, expected := range records {
+		record, err := f.ReadRecord()
+		c.Assert(err, IsNil)
+		c.Assert(record.GetUrl(), Equals, expected.GetUrl())
+		c.Assert(record.GetPayload().GetData(), DeepEquals, expected.GetPayload().GetData())
+		c.Assert(record.Offset(), Equals, int(offsets[i]))
+	}
+	record, _ := f.ReadRecord()
+	c.Assert(record, IsNil)
+}
+
+func (s *ZstdSuite) TestRoundTrip(c *C) {
+	records := getZstdRecords()
+	data, offsets := writeZstdFile(c, nil, records)
+	c.Assert(offsets[0], Equals, int64(0))
+	checkZstdFile(c, data, records, offsets)
+}
+
+func (s *ZstdSuite) TestDictionary(c *C) {
+	records := getZstdRecords()
+	dictionary := getZstdDictionary(c)
+	data, offsets := writeZstdFile(c, dictionary, records)
+	c.Assert(data[:4], DeepEquals, []byte{0x5D, 0x2A, 0x4D, 0x18})
+	c.Assert(offsets[0], Equals, int64(8+len(dictionary)))
+	plain, _ := writeZstdFile(c, nil, records)
+	c.Assert(len(data)-len(dictionary) < len(plain), Equals, true)
+	checkZstdFile(c, data, records, offsets)
+
+	// the frames cannot be read without the dictionary
+	_, err := NewWARCFile(&ClosingBuffer{bytes.NewReader(data[offsets[0]:])})
+	c.Assert(err, IsNil)
+	record, err := ReadRecordAt(bytes.NewReader(data[offsets[0]:]), 0)
+	c.Assert(record, IsNil)
+	c.Assert(err, NotNil)
+}
+
+func (s *ZstdSuite) TestCompressedDictionary(c *C) {
+	records := getZstdRecords()
+	dictionary := getZstdDictionary(c)
+	data, offsets := writeZstdFile(c, dictionary, records)
+	encoder, err := zstd.NewWriter(nil)
+	c.Assert(err, IsNil)
+	compressed := encoder.EncodeAll(dictionary, nil)
+	header := []byte{0x5D, 0x2A, 0x4D, 0x18, 0, 0, 0, 0}
+	header[4] = byte(len(compressed))
+	header[5] = byte(len(compressed) >> 8)
+	shift := int64(len(compressed) - len(dictionary))
+	data = append(append(header, compressed...), data[8+len(dictionary):]...)
+	for i := range offsets {
+		offsets[i] += shift
+	}
+	checkZstdFile(c, data, records, offsets)
+}
+
+func (s *ZstdSuite) TestReadRecordAt(c *C) {
+	records := getZstdRecords()
+	for _, dictionary := range [][]byte{nil, getZstdDictionary(c)} {
+		data, offsets := writeZstdFile(c, dictionary, records)
+		for _, i := range []int{0, 7, 49} {
+			record, err := ReadRecordAt(bytes.NewReader(data), offsets[i])
+			c.Assert(err, IsNil)
+			c.Assert(record.GetUrl(), Equals, records[i].GetUrl())
+			c.Assert(record.Offset(), Equals, int(offsets[i]))
+		}
+	}
+}
+
+func (s *ZstdSuite) TestSkippableFrames(c *C) {
+	records := getZstdRecords()[:2]
+	data, offsets := writeZstdFile(c, nil, records)
+	skippable := []byte{0x50, 0x2A, 0x4D, 0x18, 3, 0, 0, 0, 'a', 'b', 'c'}
+	data = append(append(append([]byte{}, data[:offsets[1]]...), skippable...), data[offsets[1]:]...)
+	offsets[1] += int64(len(skippable))
+	checkZstdFile(c, data, records, offsets)
+}
+
+func (s *ZstdSuite) TestLargeRecord(c *C) {
+	// spans several zstd blocks
+	content := strings.Repeat("0123456789abcdefghijklmnopqrstuvwxyz", 20000)
+	records := []*WARCRecord{
+		NewWARCRecordFromBytes(map[string]string{"WARC-Target-URI": "http://example.com/large"}, []byte(content)),
+		NewWARCRecordFromBytes(map[string]string{"WARC-Target-URI": "http://example.com/small"}, []byte("Helloworld")),
+	}
+	data, offsets := writeZstdFile(c, nil, records)
+	checkZstdFile(c, data, records, offsets)
+}
+
+func (s *ZstdSuite) TestTruncated(c *C) {
+	records := getZstdRecords()[:2]
+	data, _ := writeZstdFile(c, nil, records)
+	f, err := NewWARCFile(&ClosingBuffer{bytes.NewReader(data[:len(data)-5])})
+	c.Assert(err, IsNil)
+	record, err := f.ReadRecord()
+	c.Assert(err, IsNil)
+	c.Assert(record.GetUrl(), Equals, records[0].GetUrl())
+	_, err = f.ReadRecord()
+	c.Assert(err, NotNil)
+}
+
+func (s *ZstdSuite) TestHugeDictionaryFrame(c *C) {
+	records := getZstdRecords()[:1]
+	data, _ := writeZstdFile(c, nil, records)
+	// a dictionary frame claiming 4 GiB of content
+	frame := []byte{0x5D, 0x2A, 0x4D, 0x18, 0xff, 0xff, 0xff, 0xff, 0x37, 0xA4, 0x30, 0xEC}
+	data = append(frame, data...)
+	_, err := NewWARCFile(&ClosingBuffer{bytes.NewReader(data)})
+	c.Assert(err, ErrorMatches, "Skippable frame of 4294967295 bytes is larger than 16777216 bytes")
+	_, err = readZstdDictionaryAt(bytes.NewReader(data))
+	c.Assert(err, ErrorMatches, "Skippable frame of 4294967295 bytes is larger than 16777216 bytes")
+}